@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/chelmertz/elly/internal/github"
+	"github.com/chelmertz/elly/internal/storage"
+)
+
+// runCommand runs a subcommand, like "elly export", instead of the server.
+func runCommand(store storage.Storage, githubBaseURL string, args []string, stdin io.Reader, stdout io.Writer, logger *slog.Logger) error {
+	switch args[0] {
+	case "export":
+		if len(args) > 2 {
+			return fmt.Errorf("usage: elly export [file]")
+		}
+		if len(args) == 1 || args[1] == "-" {
+			return exportState(store, stdout)
+		}
+		f, err := os.OpenFile(args[1], os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+		if err != nil {
+			return err
+		}
+		if err := exportState(store, f); err != nil {
+			f.Close() //nolint:errcheck // the export error is more interesting
+			return err
+		}
+		return f.Close()
+	case "import":
+		if len(args) > 2 {
+			return fmt.Errorf("usage: elly import [file]")
+		}
+		in := stdin
+		if len(args) == 2 && args[1] != "-" {
+			f, err := os.Open(args[1])
+			if err != nil {
+				return err
+			}
+			defer f.Close() //nolint:errcheck // read only
+			in = f
+		}
+		return importState(store, in)
+	case "doctor":
+		if len(args) > 1 {
+			return fmt.Errorf("usage: elly doctor")
+		}
+		token := os.Getenv("GITHUB_PAT")
+		if token == "" {
+			pat, found, err := store.GetPAT()
+			if err != nil {
+				return fmt.Errorf("could not read PAT: %w", err)
+			}
+			if !found {
+				return fmt.Errorf("no PAT to check, set GITHUB_PAT or store one in the settings")
+			}
+			token = pat.Token
+		}
+		return doctor(context.Background(), githubBaseURL, token, stdout, logger)
+	default:
+		return fmt.Errorf("unknown command %q, expected export, import or doctor", args[0])
+	}
+}
+
+func exportState(store storage.Storage, out io.Writer) error {
+	state, err := storage.Export(store, time.Now())
+	if err != nil {
+		return fmt.Errorf("could not export state: %w", err)
+	}
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(state)
+}
+
+func importState(store storage.Storage, in io.Reader) error {
+	var state storage.ExportedState
+	if err := json.NewDecoder(in).Decode(&state); err != nil {
+		return fmt.Errorf("could not read state: %w", err)
+	}
+	if _, err := storage.Import(store, state, time.Now()); err != nil {
+		return fmt.Errorf("could not import state: %w", err)
+	}
+	return nil
+}
+
+// doctor prints what the PAT may do, and returns an error unless it has every
+// permission elly needs.
+func doctor(ctx context.Context, githubBaseURL, token string, out io.Writer, logger *slog.Logger) error {
+	d, err := github.DiagnosePAT(ctx, githubBaseURL, token, logger)
+	if err != nil {
+		return fmt.Errorf("could not diagnose PAT: %w", err)
+	}
+	fmt.Fprintf(out, "user:       %s\n", d.Username)  //nolint:errcheck // best-effort output
+	fmt.Fprintf(out, "token type: %s\n", d.TokenType) //nolint:errcheck // best-effort output
+	if len(d.Scopes) > 0 {
+		fmt.Fprintf(out, "scopes:     %s\n", strings.Join(d.Scopes, ", ")) //nolint:errcheck // best-effort output
+	}
+	if !d.ExpiresAt.IsZero() {
+		fmt.Fprintf(out, "expires:    %s\n", d.ExpiresAt.Format(time.DateOnly)) //nolint:errcheck // best-effort output
+	}
+	if d.Repo != "" {
+		fmt.Fprintf(out, "probed in:  %s\n", d.Repo) //nolint:errcheck // best-effort output
+	}
+	for _, p := range d.Permissions {
+		status := "ok"
+		if p.Skipped {
+			status = "skipped: " + p.Detail
+		} else if !p.Ok {
+			status = "MISSING: " + p.Detail
+		}
+		fmt.Fprintf(out, "  %-15s %s\n", p.Permission, status) //nolint:errcheck // best-effort output
+	}
+	for _, w := range d.Warnings {
+		fmt.Fprintf(out, "warning: %s\n", w) //nolint:errcheck // best-effort output
+	}
+	if missing := d.Missing(); len(missing) > 0 {
+		return fmt.Errorf("the PAT lacks permissions: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/chelmertz/elly/internal/types"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 )
@@ -19,10 +20,38 @@ var (
 		Name: "elly_backoff_multiplier",
 		Help: "Current backoff multiplier (1.0 = normal, >1.0 = backing off).",
 	})
+
+	nextPollTimestamp = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "elly_next_poll_timestamp_seconds",
+		Help: "Unix time of the next scheduled poll.",
+	})
+
+	circuitOpenGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "elly_circuit_breaker_open",
+		Help: "1 while polling is paused since GitHub keeps failing (or a probe is due), 0 otherwise.",
+	})
+
+	needsAttentionGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "elly_needs_attention",
+		Help: "1 while polling is paused until the user does something (like storing a new PAT), 0 otherwise.",
+	})
+
+	pollReason = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "elly_poll_reason",
+		Help: "Why the next poll is scheduled when it is: 1 for the current reason, 0 for the others.",
+	}, []string{"reason"})
 )
 
 // Tracker owns the polling timer and handles all GitHub fetch outcome
-// side effects: metrics, logging, and adaptive backoff.
+// side effects: metrics, logging, and adaptive backoff. Between errors, the
+// interval follows its Schedule.
+//
+// After failureThreshold consecutive failures, the circuit breaker opens:
+// nothing is polled for circuitOpenFor. The first tick after that is a probe,
+// which either closes the circuit or opens it again.
+//
+// Errors that retrying can't fix, like a PAT lacking permissions, pause
+// polling until Resume: the tracker needs attention.
 //
 // External code receives "time to poll" signals by calling Tick(), which
 // blocks until the next signal (or Stop). Manual refreshes are requested
@@ -35,30 +64,105 @@ type Tracker struct {
 	maxMultiplier     float64
 	consecutiveOK     int
 	cooldownThreshold int
+	// lowBudgetThreshold is the fraction of Github's rate limit below which
+	// polling is slowed down, as if backing off as much as possible.
+	lowBudgetThreshold float64
+	lowBudget          bool
+
+	consecutiveFailures int
+	failureThreshold    int
+	circuitOpenFor      time.Duration
+	circuitOpenUntil    time.Time // zero while closed
+
+	needsAttention string // why polling is paused until Resume, empty while polling
+
+	schedule     Schedule
+	guiSeenAt    time.Time
+	prsUpdatedAt time.Time
+	scheduledAt  time.Time // when decision was made
+	decision     Decision
 
-	c       chan struct{} // "time to refresh" signals
-	refresh chan struct{} // manual refresh requests
-	done    chan struct{} // closed by Stop()
-	stopped sync.Once
+	c          chan struct{} // "time to refresh" signals
+	refresh    chan struct{} // manual refresh requests
+	reschedule chan struct{} // the GUI was opened, poll sooner
+	done       chan struct{} // closed by Stop()
+	stopped    sync.Once
 }
 
-func New(logger *slog.Logger, baseInterval time.Duration) *Tracker {
+// New starts polling right away, unless restored (from State, before a
+// restart) says to wait.
+func New(logger *slog.Logger, baseInterval time.Duration, schedule Schedule, restored types.BackoffState) *Tracker {
 	t := &Tracker{
-		logger:            logger,
-		baseInterval:      baseInterval,
-		multiplier:        1.0,
-		maxMultiplier:     4.0,
-		cooldownThreshold: 3,
-		c:                 make(chan struct{}, 1),
-		refresh:           make(chan struct{}, 1),
-		done:              make(chan struct{}),
+		logger:             logger,
+		baseInterval:       baseInterval,
+		multiplier:         1.0,
+		maxMultiplier:      4.0,
+		cooldownThreshold:  3,
+		lowBudgetThreshold: 0.1,
+		failureThreshold:   5,
+		schedule:           schedule,
+		c:                  make(chan struct{}, 1),
+		refresh:            make(chan struct{}, 1),
+		reschedule:         make(chan struct{}, 1),
+		done:               make(chan struct{}),
 	}
+	// twice the longest backoff
+	t.circuitOpenFor = 2 * time.Duration(float64(baseInterval)*t.maxMultiplier)
 	pollIntervalSeconds.Set(baseInterval.Seconds())
-	backoffMultiplierGauge.Set(1.0)
-	go t.run()
+
+	t.restore(restored)
+	t.syncGauges()
+	now := time.Now()
+	if restored.NextPollAt.After(now) {
+		t.scheduledAt = now
+		t.setDecisionLocked(Decision{Interval: restored.NextPollAt.Sub(now), Reason: restored.NextPollReason})
+		go t.run(false, t.decision.Interval)
+	} else {
+		go t.run(true, t.scheduleNext())
+	}
 	return t
 }
 
+// restore takes over what's still relevant of a state from before a restart.
+func (t *Tracker) restore(state types.BackoffState) {
+	if state.Multiplier > 1 {
+		t.multiplier = min(state.Multiplier, t.maxMultiplier)
+		t.consecutiveOK = state.ConsecutiveOK
+	}
+	t.consecutiveFailures = state.ConsecutiveFailures
+	t.circuitOpenUntil = state.CircuitOpenUntil
+	if t.multiplier > 1 || !t.circuitOpenUntil.IsZero() {
+		t.logger.Info("restored backoff from before the restart",
+			slog.Float64("multiplier", t.multiplier),
+			slog.Int("consecutive_failures", t.consecutiveFailures),
+			slog.Time("circuit_open_until", t.circuitOpenUntil))
+	}
+}
+
+// State returns what's needed to restore the tracker after a restart.
+func (t *Tracker) State() types.BackoffState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state := types.BackoffState{
+		Multiplier:          t.multiplier,
+		ConsecutiveOK:       t.consecutiveOK,
+		ConsecutiveFailures: t.consecutiveFailures,
+		CircuitOpenUntil:    t.circuitOpenUntil,
+		NextPollAt:          t.decision.NextPollAt,
+		NextPollReason:      t.decision.Reason,
+	}
+	// the decision may have been made before the circuit opened
+	if t.circuitOpenUntil.After(state.NextPollAt) {
+		state.NextPollAt = t.circuitOpenUntil
+		state.NextPollReason = ReasonCircuitOpen
+	}
+	// restarting is retrying, as far as the user is concerned
+	if t.needsAttention != "" {
+		state.NextPollAt, state.NextPollReason = time.Time{}, ""
+	}
+	return state
+}
+
 // Tick blocks until it is time to refresh, then returns true.
 // Returns false when Stop() has been called (the tracker is done).
 func (t *Tracker) Tick() bool {
@@ -97,26 +201,110 @@ func (t *Tracker) RateLimited() {
 	t.syncGauges()
 	t.logger.Warn("rate limited by github, backing off",
 		slog.Duration("interval", t.currentIntervalLocked()))
+	t.failedLocked()
 }
 
 // ServerErrored handles a server error: 1.5x backoff, timer reset, log.
 func (t *Tracker) ServerErrored() {
 	t.mu.Lock()
 	defer t.mu.Unlock()
+	t.erroredLocked("server error from github, backing off")
+}
+
+// NetworkErrored handles Github not being reached, e.g. during an outage,
+// like a server error.
+func (t *Tracker) NetworkErrored() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.erroredLocked("could not reach github, backing off")
+}
+
+// erroredLocked backs off 1.5x and counts the failure. Must be called with mu
+// held.
+func (t *Tracker) erroredLocked(msg string) {
 	t.consecutiveOK = 0
 	t.multiplier *= 1.5
 	if t.multiplier > t.maxMultiplier {
 		t.multiplier = t.maxMultiplier
 	}
 	t.syncGauges()
-	t.logger.Warn("server error from github, backing off",
-		slog.Duration("interval", t.currentIntervalLocked()))
+	t.logger.Warn(msg, slog.Duration("interval", t.currentIntervalLocked()))
+	t.failedLocked()
+}
+
+// failedLocked opens the circuit after too many failures in a row, or when
+// the probe failed. Must be called with mu held.
+func (t *Tracker) failedLocked() {
+	t.consecutiveFailures++
+	if t.circuitOpenUntil.IsZero() && t.consecutiveFailures < t.failureThreshold {
+		return
+	}
+	t.circuitOpenUntil = time.Now().Add(t.circuitOpenFor)
+	t.syncGauges()
+	t.logger.Warn("github keeps failing, pausing polling",
+		slog.Int("consecutive_failures", t.consecutiveFailures),
+		slog.Time("until", t.circuitOpenUntil))
+}
+
+// NeedsAttention pauses polling until Resume, since retrying won't help.
+// reason is shown to the user, who is the one who can fix it.
+func (t *Tracker) NeedsAttention(reason string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.needsAttention = reason
+	t.syncGauges()
+	t.setDecisionLocked(Decision{Interval: t.decision.Interval, Reason: ReasonNeedsAttention})
+	t.logger.Error("polling paused until resumed", slog.String("reason", reason))
+}
+
+// Resume polls right away after NeedsAttention, e.g. when the user has stored
+// a new PAT or wants to retry. Does nothing but refresh if polling wasn't
+// paused.
+func (t *Tracker) Resume() {
+	t.mu.Lock()
+	if t.needsAttention != "" {
+		t.needsAttention = ""
+		t.syncGauges()
+		t.logger.Info("polling resumed")
+	}
+	t.mu.Unlock()
+	t.RequestRefresh()
+}
+
+// Attention returns why polling is paused until Resume, or "" while polling.
+func (t *Tracker) Attention() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.needsAttention
+}
+
+// CircuitClosed returns false while polling is paused after too many
+// failures, and when the paused time is over but no probe has succeeded yet.
+// A tick while the circuit isn't closed should be a single request, to see if
+// Github is back, before anything else.
+func (t *Tracker) CircuitClosed() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.circuitOpenUntil.IsZero()
+}
+
+// paused returns true while the circuit is open, or the tracker needs
+// attention.
+func (t *Tracker) paused(now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return now.Before(t.circuitOpenUntil) || t.needsAttention != ""
 }
 
 // Succeeded handles a successful fetch and may reduce backoff.
 func (t *Tracker) Succeeded() {
 	t.mu.Lock()
 	defer t.mu.Unlock()
+	t.consecutiveFailures = 0
+	if !t.circuitOpenUntil.IsZero() {
+		t.circuitOpenUntil = time.Time{}
+		t.logger.Info("github is back, resuming polling")
+	}
 	t.consecutiveOK++
 	if t.consecutiveOK >= t.cooldownThreshold && t.multiplier > 1.0 {
 		t.multiplier /= 2
@@ -128,9 +316,70 @@ func (t *Tracker) Succeeded() {
 	t.syncGauges()
 }
 
-// BaseInterval returns the configured base polling interval (before backoff).
-func (t *Tracker) BaseInterval() time.Duration {
-	return t.baseInterval
+// RateLimitBudget slows polling down while the remaining points of Github's
+// rate limit are below the threshold, so that they last until the reset,
+// instead of waiting to be rate limited.
+func (t *Tracker) RateLimitBudget(remaining, limit int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	low := limit > 0 && float64(remaining) < float64(limit)*t.lowBudgetThreshold
+	if low == t.lowBudget {
+		return
+	}
+	t.lowBudget = low
+	t.syncGauges()
+	if low {
+		t.logger.Warn("github rate limit is running low, slowing down",
+			slog.Int("remaining", remaining), slog.Int("limit", limit),
+			slog.Duration("interval", t.currentIntervalLocked()))
+	} else {
+		t.logger.Info("github rate limit is no longer low",
+			slog.Int("remaining", remaining), slog.Int("limit", limit),
+			slog.Duration("interval", t.currentIntervalLocked()))
+	}
+}
+
+// GuiSeen tells the tracker that the GUI is open, which makes an adaptive
+// schedule poll faster, starting with the poll that's already scheduled.
+func (t *Tracker) GuiSeen() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	wasOpen := !t.guiSeenAt.IsZero() && now.Sub(t.guiSeenAt) < guiOpenWindow
+	t.guiSeenAt = now
+	if !wasOpen && t.schedule.Adaptive {
+		select {
+		case t.reschedule <- struct{}{}:
+		default: // already pending
+		}
+	}
+}
+
+// PrsUpdated tells the tracker when a PR was last updated, an adaptive
+// schedule polls faster for a while after that.
+func (t *Tracker) PrsUpdated(at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if at.After(t.prsUpdatedAt) {
+		t.prsUpdatedAt = at
+	}
+}
+
+// Decision returns when the next poll is scheduled, and why.
+func (t *Tracker) Decision() Decision {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.decision
+}
+
+// MinInterval returns the shortest interval the schedule may pick between two
+// polls.
+func (t *Tracker) MinInterval() time.Duration {
+	interval := float64(t.baseInterval)
+	if t.schedule.Adaptive {
+		interval *= activeFactor
+	}
+	return time.Duration(interval * (1 - max(t.schedule.Jitter, 0)))
 }
 
 // currentInterval returns the current effective polling interval.
@@ -142,36 +391,106 @@ func (t *Tracker) currentInterval() time.Duration {
 
 // currentIntervalLocked returns the interval. Must be called with mu held.
 func (t *Tracker) currentIntervalLocked() time.Duration {
-	return time.Duration(float64(t.baseInterval) * t.multiplier)
+	return time.Duration(float64(t.baseInterval) * t.effectiveMultiplierLocked())
+}
+
+// effectiveMultiplierLocked is the multiplier, or the max multiplier while the
+// rate limit budget is low. Must be called with mu held.
+func (t *Tracker) effectiveMultiplierLocked() float64 {
+	if t.lowBudget {
+		return max(t.multiplier, t.maxMultiplier)
+	}
+	return t.multiplier
 }
 
 // syncGauges updates Prometheus gauges. Must be called with mu held.
 func (t *Tracker) syncGauges() {
-	backoffMultiplierGauge.Set(t.multiplier)
-	pollIntervalSeconds.Set(t.currentIntervalLocked().Seconds())
+	backoffMultiplierGauge.Set(t.effectiveMultiplierLocked())
+	if t.circuitOpenUntil.IsZero() {
+		circuitOpenGauge.Set(0)
+	} else {
+		circuitOpenGauge.Set(1)
+	}
+	if t.needsAttention == "" {
+		needsAttentionGauge.Set(0)
+	} else {
+		needsAttentionGauge.Set(1)
+	}
+}
+
+// scheduleNext decides when to poll next, as of now, and returns the interval
+// until then.
+func (t *Tracker) scheduleNext() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	interval, reason := t.decideLocked(now)
+	t.scheduledAt = now
+	t.setDecisionLocked(Decision{Interval: jitter(interval, t.schedule.Jitter), Reason: reason})
+	return t.decision.Interval
 }
 
-func (t *Tracker) run() {
+// rescheduleSooner decides again, as if it was when the current decision was
+// made. Returns the interval from now, and false if the current decision is
+// sooner.
+func (t *Tracker) rescheduleSooner() (time.Duration, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	interval, reason := t.decideLocked(time.Now())
+	if interval >= t.decision.Interval {
+		return 0, false
+	}
+	t.setDecisionLocked(Decision{Interval: interval, Reason: reason})
+	return max(time.Until(t.decision.NextPollAt), 0), true
+}
+
+// setDecisionLocked sets NextPollAt, logs and updates gauges. Must be called
+// with mu held.
+func (t *Tracker) setDecisionLocked(d Decision) {
+	d.NextPollAt = t.scheduledAt.Add(d.Interval)
+	if d.Reason != t.decision.Reason {
+		t.logger.Debug("polling schedule changed", slog.String("decision", d.String()))
+	}
+	t.decision = d
+	pollIntervalSeconds.Set(d.Interval.Seconds())
+	nextPollTimestamp.Set(float64(d.NextPollAt.Unix()))
+	for _, r := range reasons {
+		if r == d.Reason {
+			pollReason.WithLabelValues(r).Set(1)
+		} else {
+			pollReason.WithLabelValues(r).Set(0)
+		}
+	}
+}
+
+// run sends the first signal right away, unless told not to, and the next one
+// after firstInterval.
+func (t *Tracker) run(immediately bool, firstInterval time.Duration) {
 	defer close(t.c)
 
-	// Send immediate first signal.
-	select {
-	case t.c <- struct{}{}:
-	case <-t.done:
-		return
+	if immediately {
+		select {
+		case t.c <- struct{}{}:
+		case <-t.done:
+			return
+		}
 	}
 
-	timer := time.NewTimer(t.currentInterval())
+	timer := time.NewTimer(firstInterval)
 	defer timer.Stop()
 
 	for {
 		select {
 		case <-timer.C:
-			select {
-			case t.c <- struct{}{}:
-			default: // don't block if pending
+			// scheduled before the circuit opened, or before needing
+			// attention
+			if !t.paused(time.Now()) {
+				select {
+				case t.c <- struct{}{}:
+				default: // don't block if pending
+				}
 			}
-			timer.Reset(t.currentInterval())
+			timer.Reset(t.scheduleNext())
 		case <-t.refresh:
 			// Drain timer so the next tick is a full interval from now.
 			if !timer.Stop() {
@@ -184,7 +503,17 @@ func (t *Tracker) run() {
 			case t.c <- struct{}{}:
 			default:
 			}
-			timer.Reset(t.currentInterval())
+			timer.Reset(t.scheduleNext())
+		case <-t.reschedule:
+			if interval, sooner := t.rescheduleSooner(); sooner {
+				if !timer.Stop() {
+					select {
+					case <-timer.C:
+					default:
+					}
+				}
+				timer.Reset(interval)
+			}
 		case <-t.done:
 			return
 		}
@@ -6,6 +6,8 @@ import (
 	"testing"
 	"testing/synctest"
 	"time"
+
+	"github.com/chelmertz/elly/internal/types"
 )
 
 func discardLogger() *slog.Logger {
@@ -14,7 +16,7 @@ func discardLogger() *slog.Logger {
 
 func TestRateLimitedDoublesInterval(t *testing.T) {
 	synctest.Test(t, func(t *testing.T) {
-		bt := New(discardLogger(), 5*time.Minute)
+		bt := New(discardLogger(), 5*time.Minute, Schedule{}, types.BackoffState{})
 		defer bt.Stop()
 
 		bt.RateLimited()
@@ -37,7 +39,7 @@ func TestRateLimitedDoublesInterval(t *testing.T) {
 
 func TestServerErroredIncreasesInterval(t *testing.T) {
 	synctest.Test(t, func(t *testing.T) {
-		bt := New(discardLogger(), 10*time.Minute)
+		bt := New(discardLogger(), 10*time.Minute, Schedule{}, types.BackoffState{})
 		defer bt.Stop()
 
 		bt.ServerErrored()
@@ -47,9 +49,27 @@ func TestServerErroredIncreasesInterval(t *testing.T) {
 	})
 }
 
+func TestNetworkErroredCountsAsAFailure(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		bt := New(discardLogger(), 10*time.Minute, Schedule{}, types.BackoffState{})
+		defer bt.Stop()
+
+		bt.NetworkErrored()
+		if got, want := bt.currentInterval(), 15*time.Minute; got != want {
+			t.Fatalf("after 1 network error: got %v, want %v", got, want)
+		}
+		for range 4 {
+			bt.NetworkErrored()
+		}
+		if bt.CircuitClosed() {
+			t.Fatal("expected the circuit to open after 5 network errors")
+		}
+	})
+}
+
 func TestSucceededGraduallyReducesMultiplier(t *testing.T) {
 	synctest.Test(t, func(t *testing.T) {
-		bt := New(discardLogger(), 5*time.Minute)
+		bt := New(discardLogger(), 5*time.Minute, Schedule{}, types.BackoffState{})
 		defer bt.Stop()
 
 		// Back off first
@@ -81,7 +101,7 @@ func TestSucceededGraduallyReducesMultiplier(t *testing.T) {
 
 func TestSucceededDoesNotGoBelowBase(t *testing.T) {
 	synctest.Test(t, func(t *testing.T) {
-		bt := New(discardLogger(), 5*time.Minute)
+		bt := New(discardLogger(), 5*time.Minute, Schedule{}, types.BackoffState{})
 		defer bt.Stop()
 
 		for range 10 {
@@ -95,7 +115,7 @@ func TestSucceededDoesNotGoBelowBase(t *testing.T) {
 
 func TestRateLimitResetsConsecutiveSuccesses(t *testing.T) {
 	synctest.Test(t, func(t *testing.T) {
-		bt := New(discardLogger(), 5*time.Minute)
+		bt := New(discardLogger(), 5*time.Minute, Schedule{}, types.BackoffState{})
 		defer bt.Stop()
 
 		bt.RateLimited() // 2x
@@ -114,7 +134,7 @@ func TestRateLimitResetsConsecutiveSuccesses(t *testing.T) {
 
 func TestTickDeliversSignalAndStopCloses(t *testing.T) {
 	synctest.Test(t, func(t *testing.T) {
-		bt := New(discardLogger(), 5*time.Minute)
+		bt := New(discardLogger(), 5*time.Minute, Schedule{}, types.BackoffState{})
 
 		// First Tick should return immediately (initial signal).
 		if !bt.Tick() {
@@ -136,7 +156,7 @@ func TestTickDeliversSignalAndStopCloses(t *testing.T) {
 
 func TestRequestRefreshDeliversTick(t *testing.T) {
 	synctest.Test(t, func(t *testing.T) {
-		bt := New(discardLogger(), 1*time.Hour)
+		bt := New(discardLogger(), 1*time.Hour, Schedule{}, types.BackoffState{})
 
 		// Consume the initial signal.
 		if !bt.Tick() {
@@ -156,7 +176,7 @@ func TestRequestRefreshDeliversTick(t *testing.T) {
 func TestTimerResetsOnBackoff(t *testing.T) {
 	synctest.Test(t, func(t *testing.T) {
 		base := 5 * time.Minute
-		bt := New(discardLogger(), base)
+		bt := New(discardLogger(), base, Schedule{}, types.BackoffState{})
 
 		// Consume initial signal.
 		if !bt.Tick() {
@@ -199,3 +219,160 @@ func TestTimerResetsOnBackoff(t *testing.T) {
 		bt.Stop()
 	})
 }
+
+func TestLowRateLimitBudgetSlowsDown(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		bt := New(discardLogger(), 5*time.Minute, Schedule{}, types.BackoffState{})
+		defer bt.Stop()
+
+		bt.RateLimitBudget(600, 5000)
+		if got, want := bt.currentInterval(), 5*time.Minute; got != want {
+			t.Fatalf("with plenty of budget left: got %v, want %v", got, want)
+		}
+
+		bt.RateLimitBudget(400, 5000)
+		if got, want := bt.currentInterval(), 20*time.Minute; got != want {
+			t.Fatalf("with a low budget (should be 4x): got %v, want %v", got, want)
+		}
+
+		// successes don't speed it up, a reset budget does
+		bt.Succeeded()
+		bt.Succeeded()
+		bt.Succeeded()
+		if got, want := bt.currentInterval(), 20*time.Minute; got != want {
+			t.Fatalf("after successes with a low budget: got %v, want %v", got, want)
+		}
+		bt.RateLimitBudget(5000, 5000)
+		if got, want := bt.currentInterval(), 5*time.Minute; got != want {
+			t.Fatalf("after the budget is reset: got %v, want %v", got, want)
+		}
+	})
+}
+
+func TestCircuitOpensAfterConsecutiveFailures(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		bt := New(discardLogger(), 5*time.Minute, Schedule{}, types.BackoffState{})
+		defer bt.Stop()
+		if !bt.Tick() {
+			t.Fatal("first Tick() should return true")
+		}
+
+		for range 4 {
+			bt.ServerErrored()
+		}
+		if !bt.CircuitClosed() {
+			t.Fatal("expected the circuit to stay closed before 5 failures")
+		}
+		bt.ServerErrored()
+		if bt.CircuitClosed() {
+			t.Fatal("expected the circuit to open after 5 failures")
+		}
+
+		// twice the longest backoff, 2*4*5 minutes
+		done := make(chan bool, 1)
+		go func() {
+			done <- bt.Tick()
+		}()
+		time.Sleep(39 * time.Minute)
+		synctest.Wait()
+		select {
+		case <-done:
+			t.Fatal("nothing should be polled while the circuit is open")
+		default:
+		}
+		time.Sleep(time.Minute)
+		if !<-done {
+			t.Fatal("Tick() should return true, for the probe")
+		}
+
+		// a failed probe opens the circuit again, at once
+		bt.ServerErrored()
+		if got := bt.State().CircuitOpenUntil; !got.Equal(time.Now().Add(40 * time.Minute)) {
+			t.Errorf("expected the circuit to be open for another 40m, until %v", got)
+		}
+
+		bt.Succeeded()
+		if !bt.CircuitClosed() {
+			t.Error("expected a success to close the circuit")
+		}
+	})
+}
+
+func TestRestoredStateDelaysFirstPoll(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		restored := types.BackoffState{
+			Multiplier:     4,
+			NextPollAt:     time.Now().Add(10 * time.Minute),
+			NextPollReason: ReasonBackingOff,
+		}
+		bt := New(discardLogger(), 5*time.Minute, Schedule{}, restored)
+		defer bt.Stop()
+
+		if got, want := bt.currentInterval(), 20*time.Minute; got != want {
+			t.Errorf("restored interval: got %v, want %v", got, want)
+		}
+		if d := bt.Decision(); !d.NextPollAt.Equal(restored.NextPollAt) || d.Reason != ReasonBackingOff {
+			t.Errorf("expected the restored decision, got %+v", d)
+		}
+
+		done := make(chan bool, 1)
+		go func() {
+			done <- bt.Tick()
+		}()
+		synctest.Wait()
+		select {
+		case <-done:
+			t.Fatal("the first poll should wait until the restored time")
+		default:
+		}
+		time.Sleep(10 * time.Minute)
+		if !<-done {
+			t.Fatal("Tick() should return true at the restored time")
+		}
+
+		if got := bt.State(); got.Multiplier != 4 || !got.NextPollAt.Equal(time.Now().Add(20*time.Minute)) {
+			t.Errorf("expected the state to be saved with the next poll in 20m, got %+v", got)
+		}
+	})
+}
+
+func TestNeedsAttentionPausesUntilResumed(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		bt := New(discardLogger(), 5*time.Minute, Schedule{}, types.BackoffState{})
+		defer bt.Stop()
+		if !bt.Tick() {
+			t.Fatal("first Tick() should return true")
+		}
+
+		bt.NeedsAttention("github response code 403")
+		if got := bt.Attention(); got != "github response code 403" {
+			t.Errorf("expected the reason to be kept, got %q", got)
+		}
+		if d := bt.Decision(); d.Reason != ReasonNeedsAttention {
+			t.Errorf("expected the decision to say why, got %+v", d)
+		}
+		if got := bt.State(); !got.NextPollAt.IsZero() {
+			t.Errorf("expected a restart to poll right away, got %+v", got)
+		}
+
+		done := make(chan bool, 1)
+		go func() {
+			done <- bt.Tick()
+		}()
+		time.Sleep(time.Hour)
+		synctest.Wait()
+		select {
+		case <-done:
+			t.Fatal("nothing should be polled until resumed")
+		default:
+		}
+
+		bt.Resume()
+		if !<-done {
+			t.Fatal("Tick() should return true right after resuming")
+		}
+		if got := bt.Attention(); got != "" {
+			t.Errorf("expected no reason after resuming, got %q", got)
+		}
+	})
+}
@@ -0,0 +1,172 @@
+package backoff
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Why the tracker polls when it does, as shown in Decision.Reason.
+const (
+	ReasonBaseInterval        = "base interval" // not adaptive
+	ReasonBackingOff          = "backing off"
+	ReasonCircuitOpen         = "circuit open"    // Github kept failing
+	ReasonNeedsAttention      = "needs attention" // e.g. the PAT lacks permissions
+	ReasonLowBudget           = "low rate limit budget"
+	ReasonGuiOpen             = "GUI open"
+	ReasonActivePrs           = "active PRs"
+	ReasonWorkingHours        = "working hours"
+	ReasonOutsideWorkingHours = "outside working hours"
+	ReasonDayOff              = "day off" // e.g. the weekend
+)
+
+var reasons = []string{ReasonBaseInterval, ReasonBackingOff, ReasonCircuitOpen, ReasonNeedsAttention, ReasonLowBudget, ReasonGuiOpen, ReasonActivePrs, ReasonWorkingHours, ReasonOutsideWorkingHours, ReasonDayOff}
+
+const (
+	// activeFactor is applied to the interval while the GUI is open or PRs
+	// are changing, quietFactor outside of working hours.
+	activeFactor = 0.5
+	quietFactor  = 4.0
+
+	// guiOpenWindow is how long the GUI counts as open after being seen. The
+	// GUI says it's still open every minute, while visible.
+	guiOpenWindow = 3 * time.Minute
+	// activeWindow is how long PRs count as changing after one was updated.
+	activeWindow = 30 * time.Minute
+)
+
+// Schedule adapts the polling interval to when PRs are likely to need
+// attention. The zero Schedule always polls at the base interval.
+type Schedule struct {
+	// Adaptive polls faster while the GUI is open or PRs are changing, and
+	// slower outside of WorkingHours.
+	Adaptive     bool
+	WorkingHours WorkingHours
+	// Jitter randomizes every interval by up to this fraction, e.g. 0.1 for
+	// ±10%, so that several elly instances don't poll in lockstep.
+	Jitter float64
+}
+
+// Decision is when the tracker polls next, and why.
+type Decision struct {
+	Interval   time.Duration // jitter included
+	NextPollAt time.Time
+	Reason     string
+}
+
+func (d Decision) String() string {
+	return fmt.Sprintf("next poll in %s: %s", time.Until(d.NextPollAt).Round(time.Second), d.Reason)
+}
+
+// decideLocked picks the interval from now, and why. Must be called with mu
+// held.
+func (t *Tracker) decideLocked(now time.Time) (time.Duration, string) {
+	interval := t.currentIntervalLocked()
+	switch {
+	case t.needsAttention != "":
+		// ticks are skipped until resumed, this is when it's looked at again
+		return interval, ReasonNeedsAttention
+	case now.Before(t.circuitOpenUntil):
+		return t.circuitOpenUntil.Sub(now), ReasonCircuitOpen
+	// errors and a low budget only ever slow down
+	case t.lowBudget:
+		return interval, ReasonLowBudget
+	case t.multiplier > 1:
+		return interval, ReasonBackingOff
+	case !t.schedule.Adaptive:
+		return interval, ReasonBaseInterval
+	case !t.guiSeenAt.IsZero() && now.Sub(t.guiSeenAt) < guiOpenWindow:
+		return time.Duration(float64(interval) * activeFactor), ReasonGuiOpen
+	case !t.prsUpdatedAt.IsZero() && now.Sub(t.prsUpdatedAt) < activeWindow:
+		return time.Duration(float64(interval) * activeFactor), ReasonActivePrs
+	}
+	if reason := t.schedule.WorkingHours.outside(now); reason != "" {
+		return time.Duration(float64(interval) * quietFactor), reason
+	}
+	return interval, ReasonWorkingHours
+}
+
+// jitter randomizes interval by up to ±fraction.
+func jitter(interval time.Duration, fraction float64) time.Duration {
+	if fraction <= 0 {
+		return interval
+	}
+	return time.Duration(float64(interval) * (1 + fraction*(2*rand.Float64()-1)))
+}
+
+// WorkingHours are the days of the week, and the hours of those days, when
+// PRs are polled for at the base interval. The zero WorkingHours is always.
+type WorkingHours struct {
+	Days [7]bool // indexed by time.Weekday
+	From int     // hour of the day, local time
+	To   int     // exclusive
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// ParseWorkingHours parses e.g. "mon-fri 8-18" or "mon,wed,sun 9-17". An
+// empty string is always working hours.
+func ParseWorkingHours(s string) (WorkingHours, error) {
+	var w WorkingHours
+	if strings.TrimSpace(s) == "" {
+		return w, nil
+	}
+	days, hours, found := strings.Cut(strings.TrimSpace(s), " ")
+	if !found {
+		return w, fmt.Errorf("working hours must be days and hours, e.g. \"mon-fri 8-18\"")
+	}
+
+	for _, part := range strings.Split(strings.ToLower(days), ",") {
+		firstName, lastName, isRange := strings.Cut(part, "-")
+		first, ok := weekdays[firstName]
+		if !ok {
+			return w, fmt.Errorf("unknown day %q, use mon, tue, wed, thu, fri, sat or sun", firstName)
+		}
+		last := first
+		if isRange {
+			if last, ok = weekdays[lastName]; !ok {
+				return w, fmt.Errorf("unknown day %q, use mon, tue, wed, thu, fri, sat or sun", lastName)
+			}
+		}
+		// ranges may wrap around the week, e.g. "sun-thu" or "fri-mon"
+		for d := first; ; d = (d + 1) % 7 {
+			w.Days[d] = true
+			if d == last {
+				break
+			}
+		}
+	}
+
+	fromStr, toStr, found := strings.Cut(strings.TrimSpace(hours), "-")
+	from, fromErr := strconv.Atoi(fromStr)
+	to, toErr := strconv.Atoi(toStr)
+	if !found || fromErr != nil || toErr != nil || from < 0 || to > 24 || from >= to {
+		return w, fmt.Errorf("working hours must be like 8-18, from 0 to 24")
+	}
+	w.From, w.To = from, to
+	return w, nil
+}
+
+// outside returns why t is outside of the working hours, or "" if it isn't.
+func (w WorkingHours) outside(t time.Time) string {
+	if w == (WorkingHours{}) {
+		return ""
+	}
+	if !w.Days[t.Weekday()] {
+		return ReasonDayOff
+	}
+	if t.Hour() < w.From || t.Hour() >= w.To {
+		return ReasonOutsideWorkingHours
+	}
+	return ""
+}
@@ -0,0 +1,126 @@
+package backoff
+
+import (
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/chelmertz/elly/internal/types"
+)
+
+func TestParseWorkingHours(t *testing.T) {
+	weekdays := WorkingHours{Days: [7]bool{false, true, true, true, true, true, false}, From: 8, To: 18}
+	for _, tt := range []struct {
+		in      string
+		want    WorkingHours
+		wantErr bool
+	}{
+		{in: "", want: WorkingHours{}},
+		{in: "mon-fri 8-18", want: weekdays},
+		{in: "Mon,Tue,Wed,Thu,Fri 8-18", want: weekdays},
+		{in: "fri-mon 0-24", want: WorkingHours{Days: [7]bool{true, true, false, false, false, true, true}, From: 0, To: 24}},
+		{in: "mon-fri", wantErr: true},
+		{in: "monday 8-18", wantErr: true},
+		{in: "mon-fri 18-8", wantErr: true},
+		{in: "mon-fri 8-25", wantErr: true},
+	} {
+		got, err := ParseWorkingHours(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseWorkingHours(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("ParseWorkingHours(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestAdaptiveScheduleDecisions(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		workingHours, err := ParseWorkingHours("mon-fri 8-18")
+		if err != nil {
+			t.Fatal(err)
+		}
+		bt := New(discardLogger(), 10*time.Minute, Schedule{Adaptive: true, WorkingHours: workingHours}, types.BackoffState{})
+		defer bt.Stop()
+
+		monday := time.Date(2025, 6, 23, 10, 0, 0, 0, time.UTC)
+		decide := func(now time.Time) (time.Duration, string) {
+			bt.mu.Lock()
+			defer bt.mu.Unlock()
+			return bt.decideLocked(now)
+		}
+
+		for _, tt := range []struct {
+			now          time.Time
+			wantInterval time.Duration
+			wantReason   string
+		}{
+			{monday, 10 * time.Minute, ReasonWorkingHours},
+			{monday.Add(10 * time.Hour), 40 * time.Minute, ReasonOutsideWorkingHours},
+			{monday.Add(-2 * 24 * time.Hour), 40 * time.Minute, ReasonDayOff},
+		} {
+			if interval, reason := decide(tt.now); interval != tt.wantInterval || reason != tt.wantReason {
+				t.Errorf("at %v: got %v (%s), want %v (%s)", tt.now, interval, reason, tt.wantInterval, tt.wantReason)
+			}
+		}
+
+		bt.PrsUpdated(monday.Add(-10 * time.Minute))
+		if interval, reason := decide(monday); interval != 5*time.Minute || reason != ReasonActivePrs {
+			t.Errorf("with a recently updated PR: got %v (%s)", interval, reason)
+		}
+		if _, reason := decide(monday.Add(time.Hour)); reason != ReasonWorkingHours {
+			t.Errorf("long after a PR was updated: got %s", reason)
+		}
+
+		bt.GuiSeen()
+		if interval, reason := decide(time.Now()); interval != 5*time.Minute || reason != ReasonGuiOpen {
+			t.Errorf("with the GUI open: got %v (%s)", interval, reason)
+		}
+
+		// errors are never polled for faster
+		bt.ServerErrored()
+		if interval, reason := decide(time.Now()); interval != 15*time.Minute || reason != ReasonBackingOff {
+			t.Errorf("while backing off: got %v (%s)", interval, reason)
+		}
+	})
+}
+
+func TestGuiSeenPollsSooner(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		// every day is a day off
+		workingHours := WorkingHours{From: 8, To: 18}
+		bt := New(discardLogger(), 10*time.Minute, Schedule{Adaptive: true, WorkingHours: workingHours}, types.BackoffState{})
+		defer bt.Stop()
+
+		if !bt.Tick() {
+			t.Fatal("first Tick() should return true")
+		}
+		synctest.Wait()
+		if d := bt.Decision(); d.Interval != 40*time.Minute || d.Reason != ReasonDayOff {
+			t.Fatalf("expected a slow poll on a day off, got %+v", d)
+		}
+
+		time.Sleep(2 * time.Minute)
+		bt.GuiSeen()
+		synctest.Wait()
+		if d := bt.Decision(); d.Interval != 5*time.Minute || d.Reason != ReasonGuiOpen {
+			t.Fatalf("expected a fast poll with the GUI open, got %+v", d)
+		}
+
+		// 5 minutes after the previous poll, not after the GUI was opened
+		time.Sleep(3 * time.Minute)
+		if !bt.Tick() {
+			t.Fatal("Tick() should return true")
+		}
+	})
+}
+
+func TestJitterStaysWithinFraction(t *testing.T) {
+	for range 100 {
+		got := jitter(10*time.Minute, 0.1)
+		if got < 9*time.Minute || got > 11*time.Minute {
+			t.Fatalf("got %v, want 9m-11m", got)
+		}
+	}
+}
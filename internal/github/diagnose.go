@@ -0,0 +1,269 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// The repository permissions elly needs, as listed in the README.
+const (
+	PermissionMetadata     = "metadata"
+	PermissionContents     = "contents"
+	PermissionCommitStatus = "commit status"
+	PermissionPullRequests = "pull requests"
+)
+
+const (
+	TokenClassic     = "classic"
+	TokenFineGrained = "fine-grained"
+	TokenOAuth       = "OAuth" // e.g. from "gh auth token"
+	TokenUnknown     = "unknown"
+)
+
+// Diagnosis tells what a PAT may do, permission by permission.
+type Diagnosis struct {
+	Username  string
+	TokenType string    // TokenClassic, TokenFineGrained, ...
+	Scopes    []string  // of classic and OAuth tokens, fine-grained ones have none
+	ExpiresAt time.Time // zero if the token doesn't expire
+	// Repo is where the permissions were probed, a repo with a PR involving
+	// Username, private if there is one. Empty if no repo was found, and
+	// nothing could be probed.
+	Repo        string
+	Permissions []PermissionCheck
+	Warnings    []string
+}
+
+// PermissionCheck is whether a request that needs Permission worked.
+type PermissionCheck struct {
+	Permission string
+	Ok         bool
+	Skipped    bool   // it couldn't be probed in the repo, e.g. since it's empty
+	Detail     string // why not, e.g. the response from Github
+}
+
+// Ok returns true if every permission that could be probed worked, and at
+// least one could.
+func (d Diagnosis) Ok() bool {
+	probed := false
+	for _, p := range d.Permissions {
+		if p.Skipped {
+			continue
+		}
+		if !p.Ok {
+			return false
+		}
+		probed = true
+	}
+	return probed
+}
+
+// Missing returns the permissions that didn't work, leaving out those that
+// couldn't be probed.
+func (d Diagnosis) Missing() []string {
+	var missing []string
+	for _, p := range d.Permissions {
+		if !p.Ok && !p.Skipped {
+			missing = append(missing, p.Permission)
+		}
+	}
+	return missing
+}
+
+// DiagnosePAT probes each permission elly needs, through Github's REST API.
+// Returns an error if the token can't be used at all, e.g. when it's invalid.
+func DiagnosePAT(ctx context.Context, baseURL, token string, logger *slog.Logger) (Diagnosis, error) {
+	d := Diagnosis{TokenType: tokenType(token)}
+
+	var user struct {
+		Login string
+	}
+	response, err := restRequest(ctx, baseURL, "/user", token, &user)
+	if err != nil {
+		return d, err
+	}
+	if response.StatusCode == http.StatusUnauthorized {
+		return d, fmt.Errorf("%w: github response code %d", ErrInvalidToken, response.StatusCode)
+	}
+	if response.err != nil {
+		return d, response.err
+	}
+	d.Username = user.Login
+	if scopes := response.Header.Get("X-OAuth-Scopes"); scopes != "" {
+		for _, scope := range strings.Split(scopes, ",") {
+			d.Scopes = append(d.Scopes, strings.TrimSpace(scope))
+		}
+	}
+	if expiration := response.Header.Get("Github-Authentication-Token-Expiration"); expiration != "" {
+		if d.ExpiresAt, err = time.Parse("2006-01-02 15:04:05 -0700", expiration); err != nil {
+			logger.Warn("could not parse github token expiration header", slog.Any("error", err), slog.String("expiration", expiration))
+		}
+	}
+	if (d.TokenType == TokenClassic || d.TokenType == TokenOAuth) && !slices.Contains(d.Scopes, "repo") {
+		d.Warnings = append(d.Warnings, "without the repo scope, PRs in private repos can't be read")
+	}
+
+	d.Repo, err = repoToProbe(ctx, baseURL, token, d.Username)
+	if err != nil {
+		return d, err
+	}
+	if d.Repo == "" {
+		d.Warnings = append(d.Warnings, "found no repo with a PR involving "+d.Username+", to probe the permissions in")
+		return d, nil
+	}
+
+	var repo struct {
+		DefaultBranch string `json:"default_branch"`
+		Private       bool
+	}
+	var commits []struct {
+		Sha string
+	}
+	metadata := probe(ctx, baseURL, token, PermissionMetadata, "/repos/"+d.Repo, &repo)
+	contents := probe(ctx, baseURL, token, PermissionContents, "/repos/"+d.Repo+"/commits?per_page=1", &commits)
+	d.Permissions = append(d.Permissions, metadata, contents)
+	if metadata.Ok && !repo.Private {
+		// any token may read public repos, whatever its permissions
+		d.Warnings = append(d.Warnings, d.Repo+" is public, so whether the token may read private repos is unknown")
+	}
+	ref := repo.DefaultBranch
+	if len(commits) > 0 {
+		ref = commits[0].Sha
+	}
+	if ref == "" || contents.Skipped {
+		d.Permissions = append(d.Permissions, PermissionCheck{Permission: PermissionCommitStatus, Skipped: true, Detail: "no commit to read the status of"})
+	} else {
+		d.Permissions = append(d.Permissions, probe(ctx, baseURL, token, PermissionCommitStatus, "/repos/"+d.Repo+"/commits/"+url.PathEscape(ref)+"/status", nil))
+	}
+	d.Permissions = append(d.Permissions, probe(ctx, baseURL, token, PermissionPullRequests, "/repos/"+d.Repo+"/pulls?state=all&per_page=1", nil))
+	return d, nil
+}
+
+func tokenType(token string) string {
+	switch {
+	case strings.HasPrefix(token, "ghp_"):
+		return TokenClassic
+	case strings.HasPrefix(token, "github_pat_"):
+		return TokenFineGrained
+	case strings.HasPrefix(token, "gho_"):
+		return TokenOAuth
+	}
+	return TokenUnknown
+}
+
+// repoToProbe returns "owner/name" of the repo of the latest updated PR
+// involving username, or "" if there is none. Private repos are preferred,
+// since a token that may read only public repos passes every probe in a
+// public one.
+func repoToProbe(ctx context.Context, baseURL, token, username string) (string, error) {
+	for _, query := range []string{"is:pr involves:" + username + " is:private", "is:pr involves:" + username} {
+		var result struct {
+			Items []struct {
+				RepositoryUrl string `json:"repository_url"`
+			}
+		}
+		response, err := restRequest(ctx, baseURL, "/search/issues?sort=updated&per_page=1&q="+url.QueryEscape(query), token, &result)
+		if err != nil {
+			return "", err
+		}
+		if response.err != nil {
+			return "", fmt.Errorf("could not search for a PR: %w", response.err)
+		}
+		if len(result.Items) == 0 {
+			continue
+		}
+		_, repo, found := strings.Cut(result.Items[0].RepositoryUrl, "/repos/")
+		if !found {
+			return "", fmt.Errorf("unexpected repository url %q", result.Items[0].RepositoryUrl)
+		}
+		return repo, nil
+	}
+	return "", nil
+}
+
+// probe requests path, which needs permission, and decodes the response into
+// v (unless nil) if it worked.
+func probe(ctx context.Context, baseURL, token, permission, path string, v any) PermissionCheck {
+	check := PermissionCheck{Permission: permission}
+	response, err := restRequest(ctx, baseURL, path, token, v)
+	if err != nil {
+		check.Detail = err.Error()
+		return check
+	}
+	if response.StatusCode == http.StatusConflict {
+		// e.g. listing the commits of an empty repo
+		check.Skipped = true
+		check.Detail = "can't be probed, the repo is empty"
+		return check
+	}
+	if response.err != nil {
+		check.Detail = response.err.Error()
+		// fine-grained tokens are told what they lack
+		if accepted := response.Header.Get("X-Accepted-GitHub-Permissions"); accepted != "" {
+			check.Detail += " (needs " + accepted + ")"
+		}
+		return check
+	}
+	check.Ok = true
+	return check
+}
+
+type restResponse struct {
+	*http.Response
+	err error // from the response code, wrapping ErrClient or ErrGithubServer
+}
+
+// restRequest GETs path from Github's REST API. Returns an error if there was
+// no response, and the response with an error if it wasn't successful.
+func restRequest(ctx context.Context, baseURL, path, token string, v any) (restResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Minute)
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+path, nil)
+	if err != nil {
+		return restResponse{}, fmt.Errorf("could not construct github request: %w", err)
+	}
+	request.Header.Add("Authorization", "bearer "+token)
+	request.Header.Add("Accept", "application/vnd.github+json")
+	request.Header.Add("X-GitHub-Api-Version", "2022-11-28")
+
+	response, err := (&http.Client{}).Do(request)
+	if err != nil {
+		return restResponse{}, fmt.Errorf("%w: %w", ErrNetwork, err)
+	}
+	defer response.Body.Close() //nolint:errcheck // error on close is not actionable
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return restResponse{}, fmt.Errorf("could not read github response: %w", err)
+	}
+
+	r := restResponse{Response: response}
+	if response.StatusCode >= 400 {
+		var message struct {
+			Message string
+		}
+		json.Unmarshal(body, &message) //nolint:errcheck // the message is only a nicety
+		sentinel := ErrClient
+		if response.StatusCode >= 500 {
+			sentinel = ErrGithubServer
+		}
+		r.err = fmt.Errorf("%w: github response code %d", sentinel, response.StatusCode)
+		if message.Message != "" {
+			r.err = fmt.Errorf("%w: %s", r.err, message.Message)
+		}
+		return r, nil
+	}
+	if v != nil {
+		if err := json.Unmarshal(body, v); err != nil {
+			return r, fmt.Errorf("could not unmarshal github response: %w", err)
+		}
+	}
+	return r, nil
+}
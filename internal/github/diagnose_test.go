@@ -0,0 +1,210 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// githubWithoutPullRequests is a Github where the token may do everything but
+// read pull requests.
+func githubWithoutPullRequests(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /graphql", func(w http.ResponseWriter, r *http.Request) {
+		var request struct{ Query string }
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("could not decode request: %v", err)
+		}
+		if !strings.Contains(request.Query, "search(") {
+			io.WriteString(w, `{"data": {"viewer": {"login": "me"}}}`) //nolint:errcheck // test server
+			return
+		}
+		w.WriteHeader(http.StatusForbidden)
+		io.WriteString(w, `{"message": "Resource not accessible by personal access token"}`) //nolint:errcheck // test server
+	})
+	mux.HandleFunc("GET /user", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Github-Authentication-Token-Expiration", "2026-11-01 12:00:00 +0000")
+		io.WriteString(w, `{"login": "me"}`) //nolint:errcheck // test server
+	})
+	mux.HandleFunc("GET /search/issues", func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("q"); got != "is:pr involves:me is:private" {
+			t.Errorf("unexpected search %q", got)
+		}
+		io.WriteString(w, `{"items": [{"repository_url": "https://api.github.com/repos/acme/web"}]}`) //nolint:errcheck // test server
+	})
+	mux.HandleFunc("GET /repos/acme/web", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"default_branch": "main", "private": true}`) //nolint:errcheck // test server
+	})
+	mux.HandleFunc("GET /repos/acme/web/commits", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `[{"sha": "abc123"}]`) //nolint:errcheck // test server
+	})
+	mux.HandleFunc("GET /repos/acme/web/commits/abc123/status", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"state": "success"}`) //nolint:errcheck // test server
+	})
+	mux.HandleFunc("GET /repos/acme/web/pulls", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Accepted-GitHub-Permissions", "pull_requests=read")
+		w.WriteHeader(http.StatusForbidden)
+		io.WriteString(w, `{"message": "Resource not accessible by personal access token"}`) //nolint:errcheck // test server
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func Test_DiagnosePAT_ReportsEachPermission(t *testing.T) {
+	srv := githubWithoutPullRequests(t)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	d, err := DiagnosePAT(context.Background(), srv.URL, "github_pat_123", logger)
+	if err != nil {
+		t.Fatalf("DiagnosePAT failed: %v", err)
+	}
+	if d.Username != "me" || d.TokenType != TokenFineGrained || d.Repo != "acme/web" || d.ExpiresAt.IsZero() {
+		t.Errorf("unexpected diagnosis %+v", d)
+	}
+	if d.Ok() {
+		t.Error("expected the diagnosis to fail")
+	}
+	if got, want := d.Missing(), []string{PermissionPullRequests}; !slices.Equal(got, want) {
+		t.Errorf("expected %v to be missing, got %v", want, got)
+	}
+	for _, p := range d.Permissions {
+		if p.Permission == PermissionPullRequests && !strings.Contains(p.Detail, "needs pull_requests=read") {
+			t.Errorf("expected the detail to tell the needed permission, got %q", p.Detail)
+		}
+	}
+	if len(d.Warnings) > 0 {
+		t.Errorf("expected no warnings in a private repo, got %v", d.Warnings)
+	}
+}
+
+func Test_DiagnosePAT_WarnsWhenOnlyAPublicRepoIsFound(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/user":
+			io.WriteString(w, `{"login": "me"}`) //nolint:errcheck // test server
+		case "/search/issues":
+			// like a token that may only read public repos
+			if strings.Contains(r.URL.Query().Get("q"), "is:private") {
+				io.WriteString(w, `{"items": []}`) //nolint:errcheck // test server
+				return
+			}
+			io.WriteString(w, `{"items": [{"repository_url": "https://api.github.com/repos/acme/oss"}]}`) //nolint:errcheck // test server
+		case "/repos/acme/oss":
+			io.WriteString(w, `{"default_branch": "main", "private": false}`) //nolint:errcheck // test server
+		case "/repos/acme/oss/commits":
+			io.WriteString(w, `[{"sha": "abc123"}]`) //nolint:errcheck // test server
+		default:
+			io.WriteString(w, `{}`) //nolint:errcheck // test server
+		}
+	}))
+	defer srv.Close()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	d, err := DiagnosePAT(context.Background(), srv.URL, "github_pat_123", logger)
+	if err != nil {
+		t.Fatalf("DiagnosePAT failed: %v", err)
+	}
+	if d.Repo != "acme/oss" || !d.Ok() {
+		t.Errorf("expected every permission to work in the public repo, got %+v", d)
+	}
+	if len(d.Warnings) != 1 || !strings.Contains(d.Warnings[0], "acme/oss is public") {
+		t.Errorf("expected a warning about the repo being public, got %v", d.Warnings)
+	}
+}
+
+func Test_DiagnosePAT_SkipsWhatCantBeProbedInAnEmptyRepo(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/user":
+			io.WriteString(w, `{"login": "me"}`) //nolint:errcheck // test server
+		case "/search/issues":
+			io.WriteString(w, `{"items": [{"repository_url": "https://api.github.com/repos/acme/new"}]}`) //nolint:errcheck // test server
+		case "/repos/acme/new":
+			io.WriteString(w, `{"default_branch": "main", "private": true}`) //nolint:errcheck // test server
+		case "/repos/acme/new/commits":
+			w.WriteHeader(http.StatusConflict)
+			io.WriteString(w, `{"message": "Git Repository is empty."}`) //nolint:errcheck // test server
+		case "/repos/acme/new/pulls":
+			io.WriteString(w, `[]`) //nolint:errcheck // test server
+		default:
+			t.Errorf("unexpected request %s", r.URL.Path)
+		}
+	}))
+	defer srv.Close()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	d, err := DiagnosePAT(context.Background(), srv.URL, "github_pat_123", logger)
+	if err != nil {
+		t.Fatalf("DiagnosePAT failed: %v", err)
+	}
+	if missing := d.Missing(); len(missing) > 0 || !d.Ok() {
+		t.Errorf("expected nothing to be missing, got %v", missing)
+	}
+	var skipped []string
+	for _, p := range d.Permissions {
+		if p.Skipped {
+			skipped = append(skipped, p.Permission)
+		}
+	}
+	if want := []string{PermissionContents, PermissionCommitStatus}; !slices.Equal(skipped, want) {
+		t.Errorf("expected %v to be skipped, got %v", want, skipped)
+	}
+}
+
+func Test_DiagnosePAT_WarnsAboutClassicTokensWithoutRepoScope(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/user":
+			w.Header().Set("X-OAuth-Scopes", "read:org, public_repo")
+			io.WriteString(w, `{"login": "me"}`) //nolint:errcheck // test server
+		case "/search/issues":
+			io.WriteString(w, `{"items": []}`) //nolint:errcheck // test server
+		default:
+			t.Errorf("unexpected request %s", r.URL.Path)
+		}
+	}))
+	defer srv.Close()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	d, err := DiagnosePAT(context.Background(), srv.URL, "ghp_123", logger)
+	if err != nil {
+		t.Fatalf("DiagnosePAT failed: %v", err)
+	}
+	if !slices.Equal(d.Scopes, []string{"read:org", "public_repo"}) {
+		t.Errorf("unexpected scopes %v", d.Scopes)
+	}
+	// one for the scope, one for not finding a repo to probe
+	if len(d.Warnings) != 2 || d.Ok() {
+		t.Errorf("expected warnings and no probed permissions, got %+v", d)
+	}
+}
+
+func Test_DiagnosePAT_InvalidToken(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	if _, err := DiagnosePAT(context.Background(), srv.URL, "ghp_123", logger); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("expected an invalid token, got %v", err)
+	}
+}
+
+func Test_ValidatePAT_TellsTheMissingPermissions(t *testing.T) {
+	srv := githubWithoutPullRequests(t)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	_, _, err := ValidatePAT(srv.URL, "github_pat_123", logger)
+	if !errors.Is(err, ErrInvalidToken) || !strings.Contains(err.Error(), "lacks required permissions (pull requests)") {
+		t.Errorf("expected the missing permission in the error, got %v", err)
+	}
+}
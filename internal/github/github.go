@@ -8,8 +8,10 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"regexp"
 	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"log/slog"
@@ -20,6 +22,7 @@ import (
 var ErrClient = errors.New("github returned client error")
 var ErrGithubServer = errors.New("github returned server error")
 var ErrInvalidToken = errors.New("github token is invalid")
+var ErrNetwork = errors.New("could not request github")
 
 const DefaultAPIURL = "https://api.github.com"
 
@@ -31,6 +34,23 @@ func (e *ErrRateLimited) Error() string {
 	return fmt.Sprintf("%v: rate limited, next allowed after %s", ErrClient, e.UnblockedAt)
 }
 
+// ErrorClass tells what kind of error a query failed with, as one of the
+// types.ErrorClass consts.
+func ErrorClass(err error) string {
+	var rl *ErrRateLimited
+	switch {
+	case errors.As(err, &rl):
+		return types.ErrorClassRateLimited
+	case errors.Is(err, ErrClient), errors.Is(err, ErrInvalidToken):
+		return types.ErrorClassClient
+	case errors.Is(err, ErrGithubServer):
+		return types.ErrorClassServer
+	case errors.Is(err, ErrNetwork):
+		return types.ErrorClassNetwork
+	}
+	return types.ErrorClassOther
+}
+
 type querySearchPrsInvolvingMeGraphQl struct {
 	Data struct {
 		Search struct {
@@ -42,6 +62,7 @@ type querySearchPrsInvolvingMeGraphQl struct {
 }
 
 type prSearchResultGraphQl struct {
+	Id             string
 	Url            string
 	Title          string
 	IsDraft        bool
@@ -68,20 +89,8 @@ type prSearchResultGraphQl struct {
 
 	Additions int
 	Deletions int
-	Comments  struct {
-		Edges []struct {
-			Node struct {
-				UpdatedAt string
-				Author    struct {
-					Login string
-				}
-				Url       string
-				Body      string
-				Reactions prReviewThreadCommentReactionGraphQl
-			}
-		}
-	}
-	Commits struct {
+	Comments  prCommentConnectionGraphQl
+	Commits   struct {
 		Nodes []struct {
 			Commit struct {
 				Author struct {
@@ -92,43 +101,81 @@ type prSearchResultGraphQl struct {
 			}
 		}
 	}
-	ReviewThreads struct {
-		Edges []struct {
-			Node prReviewThreadGraphQl
-		}
-	}
-	Reviews struct {
+	ReviewThreads prReviewThreadConnectionGraphQl
+	Reviews       struct {
 		Edges []struct {
 			Node struct {
-				Author struct {
-					Login string
-				}
-				Url   string
-				Body  string
-				State string
+				Author actorGraphQl
+				Url    string
+				Body   string
+				State  string
 			}
 		}
 	}
 }
 
+// prCommentConnectionGraphQl are the last comments on the PR itself, not the
+// ones in review threads.
+type prCommentConnectionGraphQl struct {
+	PageInfo pageInfoGraphQl
+	Edges    []struct {
+		Node prCommentGraphQl
+	}
+}
+
+type prCommentGraphQl struct {
+	UpdatedAt string
+	Author    actorGraphQl
+	Url       string
+	Body      string
+	Reactions prReviewThreadCommentReactionGraphQl
+}
+
+type prReviewThreadConnectionGraphQl struct {
+	PageInfo pageInfoGraphQl
+	Edges    []struct {
+		Node prReviewThreadGraphQl
+	}
+}
+
 type prReviewThreadGraphQl struct {
+	Id          string
 	IsResolved  bool
 	IsOutdated  bool
 	IsCollapsed bool
-	Comments    struct {
-		Nodes []prReviewThreadCommentGraphQl
-	}
+	Comments    prReviewThreadCommentConnectionGraphQl
+}
+
+type prReviewThreadCommentConnectionGraphQl struct {
+	PageInfo pageInfoGraphQl
+	Nodes    []prReviewThreadCommentGraphQl
 }
 
 type prReviewThreadCommentGraphQl struct {
-	Author struct {
-		Login string
-	}
+	Author    actorGraphQl
 	Body      string
 	Url       string
 	Reactions prReviewThreadCommentReactionGraphQl
 }
 
+// actorGraphQl is the author of a comment or a review.
+type actorGraphQl struct {
+	Login string
+	// Typename is "Bot" for Github Apps, like github-actions and dependabot.
+	Typename string `json:"__typename"`
+}
+
+// Bots recognizes the authors whose comments and reviews never make a PR
+// actionable: the accounts that Github says are bots, and the ones matching
+// Logins, e.g. a linter running as an ordinary user.
+type Bots struct {
+	Logins *regexp.Regexp // may be nil
+}
+
+func (b Bots) isBot(author actorGraphQl) bool {
+	return author.Typename == "Bot" || (b.Logins != nil && b.Logins.MatchString(author.Login))
+}
+
 type prReviewThreadCommentReactionGraphQl struct {
 	Edges []struct {
 		Node struct {
@@ -150,18 +197,20 @@ func checkExpiration(expiration string, logger *slog.Logger) {
 	}
 }
 
-func graphqlRequest(baseURL, query, token string, logger *slog.Logger) ([]byte, error) {
+func graphqlRequest(ctx context.Context, baseURL, query string, variables map[string]any, token string, rl *RateLimitCollector, logger *slog.Logger) ([]byte, error) {
 	payload := struct {
-		Query string `json:"query"`
+		Query     string         `json:"query"`
+		Variables map[string]any `json:"variables,omitempty"`
 	}{
-		Query: query,
+		Query:     query,
+		Variables: variables,
 	}
 	jsonBytes, err := json.Marshal(payload)
 	if err != nil {
 		return nil, fmt.Errorf("could not marshal graphql json: %w", err)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Minute)
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Minute)
 	defer cancel()
 
 	httpClient := &http.Client{}
@@ -175,7 +224,7 @@ func graphqlRequest(baseURL, query, token string, logger *slog.Logger) ([]byte,
 	logger.Debug("querying github api")
 	response, err := httpClient.Do(request)
 	if err != nil {
-		return nil, fmt.Errorf("could not request github: %w", err)
+		return nil, fmt.Errorf("%w: %w", ErrNetwork, err)
 	}
 	defer response.Body.Close() //nolint:errcheck // error on close is not actionable
 
@@ -187,6 +236,7 @@ func graphqlRequest(baseURL, query, token string, logger *slog.Logger) ([]byte,
 	if err != nil {
 		return nil, fmt.Errorf("could not read github username response: %w", err)
 	}
+	rl.observe(respBody, logger)
 
 	// since graphql returns 200 but still possibly errors, we need to check for
 	// those somewhere, and it seems more proper to do it close to the actual request
@@ -198,7 +248,11 @@ func graphqlRequest(baseURL, query, token string, logger *slog.Logger) ([]byte,
 	}
 	jsonErr := json.Unmarshal(respBody, &errorResponse)
 	if jsonErr != nil {
-		return nil, fmt.Errorf("%v: json unmarshal error", ErrClient)
+		// e.g. a proxy's HTML error page
+		if response.StatusCode >= 500 {
+			return nil, fmt.Errorf("%w: github response code %d", ErrGithubServer, response.StatusCode)
+		}
+		return nil, fmt.Errorf("%w: json unmarshal error", ErrClient)
 	}
 	if len(errorResponse.Errors) > 0 {
 		for _, e := range errorResponse.Errors {
@@ -237,7 +291,7 @@ func graphqlRequest(baseURL, query, token string, logger *slog.Logger) ([]byte,
 				}
 				if earliestRetry.IsZero() {
 					logger.Warn("github rate limited, no retry time found", slog.Any("response_body_graphql_errors", errorResponse.Errors), slog.Any("response_headers", response.Header))
-					return nil, fmt.Errorf("%v: github rate limited, no retry time found", ErrClient)
+					return nil, fmt.Errorf("%w: github rate limited, no retry time found", ErrClient)
 				} else {
 					logger.Error("github rate limited", slog.Any("response_body_graphql_errors", errorResponse.Errors), slog.Time("earliest_retry", earliestRetry), slog.String("header_x-ratelimit-reset", xRateLimitReset), slog.String("header_retry-after", retryAfter))
 					return nil, &ErrRateLimited{UnblockedAt: earliestRetry}
@@ -251,9 +305,9 @@ func graphqlRequest(baseURL, query, token string, logger *slog.Logger) ([]byte,
 	if response.StatusCode >= 400 {
 		logger.Warn("response", slog.Int("response_code", response.StatusCode), slog.String("body", string(respBody)))
 		if response.StatusCode < 500 {
-			return nil, fmt.Errorf("%v: github response code %d", ErrClient, response.StatusCode)
+			return nil, fmt.Errorf("%w: github response code %d", ErrClient, response.StatusCode)
 		}
-		return nil, fmt.Errorf("%v: github response code %d", ErrGithubServer, response.StatusCode)
+		return nil, fmt.Errorf("%w: github response code %d", ErrGithubServer, response.StatusCode)
 	}
 	return respBody, nil
 }
@@ -266,13 +320,18 @@ func ValidatePAT(baseURL, token string, logger *slog.Logger) (username string, e
 		return "", time.Time{}, fmt.Errorf("token authentication failed: %w", err)
 	}
 
-	// Validate scopes by attempting a PR query
-	_, err = QueryGithub(baseURL, token, username, logger)
+	// Validate scopes by attempting a PR query. The budget isn't collected,
+	// since the token may not be the one refreshing.
+	_, err = QueryGithub(context.Background(), baseURL, token, username, Bots{}, nil, logger)
 	if err != nil {
 		// Client errors (except rate limiting) indicate the token lacks
 		// required permissions — treat as invalid token.
 		var rl *ErrRateLimited
 		if errors.Is(err, ErrClient) && !errors.As(err, &rl) {
+			// say which ones, if they can be told
+			if d, diagnoseErr := DiagnosePAT(context.Background(), baseURL, token, logger); diagnoseErr == nil && len(d.Missing()) > 0 {
+				return "", time.Time{}, fmt.Errorf("%w: token lacks required permissions (%s): %w", ErrInvalidToken, strings.Join(d.Missing(), ", "), err)
+			}
 			return "", time.Time{}, fmt.Errorf("%w: token lacks required permissions: %w", ErrInvalidToken, err)
 		}
 		// Transient errors (rate limit, server error, network) — propagate as-is.
@@ -285,7 +344,7 @@ func ValidatePAT(baseURL, token string, logger *slog.Logger) (username string, e
 // UsernameFromPat returns the username and expiration date for the given PAT.
 // The expiration time is zero if the token doesn't expire.
 func UsernameFromPat(baseURL, token string, logger *slog.Logger) (username string, expiresAt time.Time, err error) {
-	query := `query { viewer { login } }`
+	query := `query { viewer { login } ...rateLimitFields }` + rateLimitFieldsFragment
 	payload := struct {
 		Query string `json:"query"`
 	}{
@@ -308,7 +367,7 @@ func UsernameFromPat(baseURL, token string, logger *slog.Logger) (username strin
 
 	response, err := httpClient.Do(request)
 	if err != nil {
-		return "", time.Time{}, fmt.Errorf("could not request github: %w", err)
+		return "", time.Time{}, fmt.Errorf("%w: %w", ErrNetwork, err)
 	}
 	defer response.Body.Close() //nolint:errcheck // error on close is not actionable
 
@@ -361,28 +420,39 @@ func UsernameFromPat(baseURL, token string, logger *slog.Logger) (username strin
 	return typedResponse.Data.Viewer.Login, expiresAt, nil
 }
 
-var ignoredLastPrCommenters = []string{"github-actions", "vercel"}
-
-func QueryGithub(baseURL, token string, username string, logger *slog.Logger) ([]types.ViewPr, error) {
-	prs, err := queryGithub(baseURL, token, username, logger)
+// QueryGithub fetches all PRs involving username. Comments and reviews by bots
+// are ignored. Cancelling ctx aborts the request, and returns an error
+// wrapping context.Canceled.
+func QueryGithub(ctx context.Context, baseURL, token string, username string, bots Bots, rl *RateLimitCollector, logger *slog.Logger) ([]types.ViewPr, error) {
+	prs, err := queryGithub(ctx, baseURL, token, username, bots, rl, logger)
+	countRequest(err)
 	if err != nil {
-		var rl *ErrRateLimited
-		if errors.As(err, &rl) {
-			githubRequestsTotal.WithLabelValues("rate_limited").Inc()
-			rateLimitEventsTotal.Inc()
-		} else if errors.Is(err, ErrGithubServer) {
-			githubRequestsTotal.WithLabelValues("server_error").Inc()
-		} else {
-			githubRequestsTotal.WithLabelValues("client_error").Inc()
-		}
 		return nil, err
 	}
-	githubRequestsTotal.WithLabelValues("success").Inc()
+	prDetailsTotal.WithLabelValues("fetched").Add(float64(len(prs)))
 	return prs, nil
 }
 
-func queryGithub(baseURL, token string, username string, logger *slog.Logger) ([]types.ViewPr, error) {
-	respBody, err := graphqlRequest(baseURL, querySearchPrsInvolvingUser(username), token, logger)
+// countRequest records the outcome of a refresh, however many requests it
+// took.
+func countRequest(err error) {
+	var rl *ErrRateLimited
+	if err == nil {
+		githubRequestsTotal.WithLabelValues("success").Inc()
+	} else if errors.Is(err, context.Canceled) {
+		// we're shutting down, github did nothing wrong
+	} else if errors.As(err, &rl) {
+		githubRequestsTotal.WithLabelValues("rate_limited").Inc()
+		rateLimitEventsTotal.Inc()
+	} else if errors.Is(err, ErrGithubServer) {
+		githubRequestsTotal.WithLabelValues("server_error").Inc()
+	} else {
+		githubRequestsTotal.WithLabelValues("client_error").Inc()
+	}
+}
+
+func queryGithub(ctx context.Context, baseURL, token string, username string, bots Bots, rl *RateLimitCollector, logger *slog.Logger) ([]types.ViewPr, error) {
+	respBody, err := graphqlRequest(ctx, baseURL, querySearchPrsInvolvingUser(username), nil, token, rl, logger)
 	if err != nil {
 		return nil, fmt.Errorf("could not query github for PRs: %w", err)
 	}
@@ -399,72 +469,89 @@ func queryGithub(baseURL, token string, username string, logger *slog.Logger) ([
 	viewPrs := make([]types.ViewPr, 0)
 
 	for _, prEdge := range rawResponse.Data.Search.Edges {
-		var pr prSearchResultGraphQl
-		err = json.Unmarshal(prEdge.Node, &pr)
+		viewPr, err := toViewPr(ctx, baseURL, token, username, bots, prEdge.Node, rl, logger)
 		if err != nil {
-			return nil, fmt.Errorf("could not re-marshal github PR, to store raw json for debugging (url=%s): %w", pr.Url, err)
+			return nil, err
 		}
-		reviewStatus := pr.ReviewDecision
+		viewPrs = append(viewPrs, viewPr)
+	}
 
-		updatedAt, err := time.Parse(time.RFC3339, pr.UpdatedAt)
-		if err != nil {
-			// not really a fatal error, just log it
-			logger.Warn("could not parse time", slog.String("updatedAt", pr.UpdatedAt), slog.String("pr_url", pr.Url))
-			updatedAt = time.Time{}
-		}
+	return viewPrs, nil
+}
 
-		lastPrCommenter := ""
-		for _, c := range pr.Comments.Edges {
-			if slices.Contains(ignoredLastPrCommenters, c.Node.Author.Login) {
-				continue
-			}
-			lastPrCommenter = c.Node.Author.Login
-		}
+// toViewPr converts a PR, as selected by prFieldsFragment, after fetching what
+// didn't fit in the query.
+func toViewPr(ctx context.Context, baseURL, token string, username string, bots Bots, rawPr json.RawMessage, rl *RateLimitCollector, logger *slog.Logger) (types.ViewPr, error) {
+	var pr prSearchResultGraphQl
+	err := json.Unmarshal(rawPr, &pr)
+	if err != nil {
+		return types.ViewPr{}, fmt.Errorf("could not re-marshal github PR, to store raw json for debugging (url=%s): %w", pr.Url, err)
+	}
+	// the raw json is still the PR as it was found, without the pages
+	// fetched here
+	if err := fetchRemainingPages(ctx, baseURL, token, &pr, bots, rl, logger); err != nil {
+		return types.ViewPr{}, fmt.Errorf("could not fetch the rest of PR %s: %w", pr.Url, err)
+	}
+	reviewStatus := pr.ReviewDecision
 
-		threadsActionable, threadsWaiting := actionableThreads(pr, username)
+	updatedAt, err := time.Parse(time.RFC3339, pr.UpdatedAt)
+	if err != nil {
+		// not really a fatal error, just log it
+		logger.Warn("could not parse time", slog.String("updatedAt", pr.UpdatedAt), slog.String("pr_url", pr.Url))
+		updatedAt = time.Time{}
+	}
 
-		reviewUsers := make([]string, 0)
-		for _, u := range pr.ReviewRequests.Nodes {
-			reviewUsers = append(reviewUsers, u.RequestedReviewer.Login)
+	lastPrCommenter := ""
+	for _, c := range pr.Comments.Edges {
+		if bots.isBot(c.Node.Author) {
+			continue
 		}
+		lastPrCommenter = c.Node.Author.Login
+	}
 
-		for _, a := range pr.Reviews.Edges {
-			// For some reason, the "Reviews" graph can contain a separate
-			// approval that is _not_ registered as the ReviewDecision,
-			// something that went unnoticed for ~5 months of using this API.
-			//
-			// Note that the general "reviewDecision" can be "CHANGES_REQUESTED"
-			// which weighs higher. Only set "APPROVED" if the reviewDecision is
-			// empty.
-			if a.Node.State == "APPROVED" && reviewStatus == "" {
-				reviewStatus = "APPROVED"
-				break
-			}
-		}
+	threads := reviewThreads(pr, username, bots)
+	threadsActionable, threadsWaiting := countThreads(threads)
+
+	reviewUsers := make([]string, 0)
+	for _, u := range pr.ReviewRequests.Nodes {
+		reviewUsers = append(reviewUsers, u.RequestedReviewer.Login)
+	}
 
-		viewPr := types.ViewPr{
-			ReviewStatus:             reviewStatus,
-			Url:                      pr.Url,
-			Title:                    pr.Title,
-			Author:                   pr.Author.Login,
-			RepoName:                 pr.Repository.Name,
-			RepoOwner:                pr.Repository.Owner.Login,
-			RepoUrl:                  pr.Repository.Url,
-			IsDraft:                  pr.IsDraft,
-			LastUpdated:              updatedAt,
-			LastPrCommenter:          lastPrCommenter,
-			ThreadsActionable:        threadsActionable,
-			ThreadsWaiting:           threadsWaiting,
-			Additions:                pr.Additions,
-			Deletions:                pr.Deletions,
-			ReviewRequestedFromUsers: reviewUsers,
-			RawJsonResponse:          prEdge.Node,
+	for _, a := range pr.Reviews.Edges {
+		// For some reason, the "Reviews" graph can contain a separate
+		// approval that is _not_ registered as the ReviewDecision,
+		// something that went unnoticed for ~5 months of using this API.
+		//
+		// Note that the general "reviewDecision" can be "CHANGES_REQUESTED"
+		// which weighs higher. Only set "APPROVED" if the reviewDecision is
+		// empty.
+		if a.Node.State == "APPROVED" && reviewStatus == "" && !bots.isBot(a.Node.Author) {
+			reviewStatus = "APPROVED"
+			break
 		}
-		logger.Debug("fetched a pr", slog.Any("pr", viewPr))
-		viewPrs = append(viewPrs, viewPr)
 	}
 
-	return viewPrs, nil
+	viewPr := types.ViewPr{
+		ReviewStatus:             reviewStatus,
+		Url:                      pr.Url,
+		Title:                    pr.Title,
+		Author:                   pr.Author.Login,
+		RepoName:                 pr.Repository.Name,
+		RepoOwner:                pr.Repository.Owner.Login,
+		RepoUrl:                  pr.Repository.Url,
+		IsDraft:                  pr.IsDraft,
+		LastUpdated:              updatedAt,
+		LastPrCommenter:          lastPrCommenter,
+		ThreadsActionable:        threadsActionable,
+		ThreadsWaiting:           threadsWaiting,
+		ReviewThreads:            threads,
+		Additions:                pr.Additions,
+		Deletions:                pr.Deletions,
+		ReviewRequestedFromUsers: reviewUsers,
+		RawJsonResponse:          rawPr,
+	}
+	logger.Debug("fetched a pr", slog.Any("pr", viewPr))
+	return viewPr, nil
 }
 
 func userReactedToComment(reactions prReviewThreadCommentReactionGraphQl, username string) bool {
@@ -485,50 +572,97 @@ func someoneElseReactedToComment(reactions prReviewThreadCommentReactionGraphQl,
 	return false
 }
 
-func actionableThreads(pr prSearchResultGraphQl, myUsername string) (actionable int, waiting int) {
+func actionableThreads(pr prSearchResultGraphQl, myUsername string, bots Bots) (actionable int, waiting int) {
+	return countThreads(reviewThreads(pr, myUsername, bots))
+}
+
+func countThreads(threads []types.ReviewThread) (actionable int, waiting int) {
+	for _, t := range threads {
+		if t.Actionable {
+			actionable++
+		} else {
+			waiting++
+		}
+	}
+	return
+}
+
+const excerptLength = 140
+
+// excerpt shortens a comment to a single line, suitable for a link text.
+func excerpt(body string) string {
+	oneLine := strings.Join(strings.Fields(body), " ")
+	runes := []rune(oneLine)
+	if len(runes) <= excerptLength {
+		return oneLine
+	}
+	return string(runes[:excerptLength-1]) + "…"
+}
+
+func reviewThreads(pr prSearchResultGraphQl, myUsername string, bots Bots) []types.ReviewThread {
+	threads := make([]types.ReviewThread, 0)
 	ownPr := pr.Author.Login == myUsername
 	for _, t := range pr.ReviewThreads.Edges {
 		if t.Node.IsCollapsed || t.Node.IsOutdated || t.Node.IsResolved {
 			continue
 		}
 
-		if len(t.Node.Comments.Nodes) == 0 {
-			// the types say this is possible, I haven't seen it in the wild though
+		comments := slices.DeleteFunc(slices.Clone(t.Node.Comments.Nodes), func(c prReviewThreadCommentGraphQl) bool {
+			return bots.isBot(c.Author)
+		})
+		if len(comments) == 0 {
+			// only bots have commented, or no one has: the types say this is
+			// possible, I haven't seen it in the wild though
 			continue
 		}
 
-		lastComment := t.Node.Comments.Nodes[len(t.Node.Comments.Nodes)-1]
+		lastComment := comments[len(comments)-1]
 		lastCommenter := lastComment.Author.Login
 		iCommentedLast := lastCommenter == myUsername
 		iReactedToLastComment := userReactedToComment(lastComment.Reactions, myUsername)
 		someoneElseReactedMyLastComment := iCommentedLast && someoneElseReactedToComment(lastComment.Reactions, myUsername)
+		threadStarter := comments[0].Author.Login
+
+		thread := types.ReviewThread{
+			Url:                lastComment.Url,
+			FirstCommenter:     threadStarter,
+			LastCommenter:      lastCommenter,
+			LastCommentExcerpt: excerpt(lastComment.Body),
+			Comments:           len(comments),
+		}
 
 		if ownPr && !iCommentedLast && !iReactedToLastComment {
 			// someone else commented last, and this is our pr, and we haven't
 			// acknowledged it yet with a reaction (emoji)
-			actionable++
+			thread.Actionable = true
+			thread.Reason = "Someone else commented last on our PR"
+			threads = append(threads, thread)
 			continue
 		}
 
 		if ownPr && someoneElseReactedMyLastComment {
 			// we commented last, and this is our pr, and they reacted to it
 			// (thumbs up etc.) acknowledged it yet
-			actionable++
+			thread.Actionable = true
+			thread.Reason = "Someone reacted to our comment on our PR"
+			threads = append(threads, thread)
 			continue
 		}
 
 		if !ownPr && lastCommenter == myUsername {
 			// we have the currently last word, the owner should reply or resolve the thread
-			waiting++
+			thread.Reason = "We commented last, waiting for a reply or a resolve"
+			threads = append(threads, thread)
 			continue
 		}
 
-		threadStarter := t.Node.Comments.Nodes[0].Author.Login
 		if threadStarter == myUsername && !iCommentedLast && !iReactedToLastComment {
 			// we started the thread, and it's still open (and someone else has
 			// the last word), and we haven't acknowledged it yet with a
 			// reaction (emoji)
-			actionable++
+			thread.Actionable = true
+			thread.Reason = "Someone replied in a thread we started"
+			threads = append(threads, thread)
 			continue
 		}
 
@@ -536,7 +670,106 @@ func actionableThreads(pr prSearchResultGraphQl, myUsername string) (actionable
 		// commented in the middle and someone else has the last word
 	}
 
-	return
+	return threads
+}
+
+// prFieldsFragment is everything about a PR, used by both the search for all
+// PRs and the one for the PRs that changed.
+const prFieldsFragment = `
+fragment prFields on PullRequest {
+  id
+  title
+  url
+  isDraft
+  reviewRequests(first: 100) {
+    nodes {
+      requestedReviewer {
+        ... on User {
+          login
+        }
+      }
+    }
+  }
+  repository {
+    url
+    name
+    owner {
+      login
+    }
+  }
+  reviewDecision
+  updatedAt
+  author {
+    login
+  }
+  additions
+  deletions
+  comments(last: 5) {
+    pageInfo {
+      hasPreviousPage
+      startCursor
+    }
+    edges {
+      node {
+        ...prCommentFields
+      }
+    }
+  }
+  commits(last: 1) {
+    nodes {
+      commit {
+        author {
+          date
+          email
+          name
+        }
+        status {
+          contexts {
+            state
+            context
+            description
+            createdAt
+            targetUrl
+          }
+        }
+      }
+    }
+  }
+  # sigh, here we can't filter on the isResolved status, so we need to
+  # overfetch (a lot, potentially). The rest of the threads, and of
+  # their comments, are fetched per PR by fetchRemainingPages().
+  reviewThreads(first: 15) {
+    pageInfo {
+      hasNextPage
+      endCursor
+    }
+    edges {
+      node {
+        ...reviewThreadFields
+      }
+    }
+  }
+  reviews(first: 20) {
+    edges {
+        node {
+            author {
+                __typename
+                login
+            }
+            body
+            url
+            state
+        }
+    }
+  }
+}
+`
+
+// prFieldsFragments are prFieldsFragment, and the fragments it uses.
+const prFieldsFragments = prFieldsFragment + prCommentFieldsFragment + reviewThreadFieldsFragment + reviewThreadCommentFieldsFragment
+
+func searchPrsInvolvingUser(username string) string {
+	return fmt.Sprintf("state:open involves:%s type:pr archived:false", username)
 }
 
 func querySearchPrsInvolvingUser(username string) string {
@@ -544,123 +777,15 @@ func querySearchPrsInvolvingUser(username string) string {
 	// calibrated - if everything is too high, github will complain with a
 	// MAX_NODE_LIMIT_EXCEEDED error
 	query := `query {
-  search(type: ISSUE, query: "state:open involves:%s type:pr archived:false", first: 100) {
+  ...rateLimitFields
+  search(type: ISSUE, query: "%s", first: 100) {
     edges {
       node {
-        ... on PullRequest {
-          title
-          url
-          isDraft
-          reviewRequests(first: 100) {
-            nodes {
-              requestedReviewer {
-                ... on User {
-                  login
-                }
-              }
-            }
-          }
-          repository {
-            url
-            name
-            owner {
-              login
-            }
-          }
-          reviewDecision
-          updatedAt
-          author {
-            login
-          }
-          additions
-          deletions
-          comments(last: 5) {
-            edges {
-              node {
-                updatedAt
-                author {
-                  login
-                }
-                url
-                body
-                reactions(first: 7) {
-                    edges {
-                        node {
-                            content
-                            user {
-                                login
-                            }
-                        }
-                    }
-                }
-              }
-            }
-          }
-          commits(last: 1) {
-            nodes {
-              commit {
-                author {
-                  date
-                  email
-                  name
-                }
-                status {
-                  contexts {
-                    state
-                    context
-                    description
-                    createdAt
-                    targetUrl
-                  }
-                }
-              }
-            }
-          }
-		  # sigh, here we can't filter on the isResolved status, so we need to overfetch (a lot, potentially)
-          reviewThreads(first: 15) {
-            edges {
-              node {
-                isResolved
-                isOutdated
-                isCollapsed
-                comments(first: 30) {
-                  nodes {
-                    author {
-                      login
-                    }
-                    body
-                    url
-                    reactions(first: 7) {
-                        edges {
-                            node {
-                                content
-                                user {
-                                    login
-                                }
-                            }
-                        }
-                    }
-                  }
-                }
-              }
-            }
-          }
-          reviews(first: 20) {
-            edges {
-                node {
-                    author {
-                        login
-                    }
-                    body
-                    url
-                    state
-                }
-            }
-          }
-        }
+        ...prFields
       }
     }
   }
-}`
-	return fmt.Sprintf(query, username)
+}
+`
+	return fmt.Sprintf(query, searchPrsInvolvingUser(username)) + prFieldsFragments + rateLimitFieldsFragment
 }
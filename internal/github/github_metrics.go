@@ -15,4 +15,43 @@ var (
 		Name: "elly_rate_limit_events_total",
 		Help: "Total number of rate limit events from GitHub.",
 	})
+
+	prDetailsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "elly_github_pr_details_total",
+		Help: "Total number of PRs whose details were fetched from GitHub, or reused since they hadn't changed.",
+	}, []string{"result"})
+
+	rateLimitRemaining = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "elly_github_rate_limit_remaining",
+		Help: "Points left of GitHub's GraphQL rate limit, as of the latest query.",
+	})
+
+	rateLimitLimit = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "elly_github_rate_limit_limit",
+		Help: "Points per hour of GitHub's GraphQL rate limit.",
+	})
+
+	rateLimitResetTimestamp = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "elly_github_rate_limit_reset_timestamp_seconds",
+		Help: "Unix time when GitHub's GraphQL rate limit is reset.",
+	})
+
+	rateLimitCostTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "elly_github_rate_limit_cost_total",
+		Help: "Total number of GitHub GraphQL rate limit points spent by elly's queries.",
+	})
+
+	rateLimitSavedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "elly_github_rate_limit_points_saved_total",
+		Help: "Estimated GitHub GraphQL rate limit points saved by only fetching the changed PRs: the cost of the latest full refresh, minus the cost of each refresh of the changed PRs.",
+	})
 )
+
+// CountSavedPoints estimates how many rate limit points a refresh of only the
+// changed PRs (changedCost) saved, compared to the latest full refresh
+// (fullCost), and counts them.
+func CountSavedPoints(fullCost, changedCost int) int {
+	saved := max(fullCost-changedCost, 0)
+	rateLimitSavedTotal.Add(float64(saved))
+	return saved
+}
@@ -1,25 +1,31 @@
 package github
 
 import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
 	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
 	"testing"
+
+	"github.com/chelmertz/elly/internal/types"
 )
 
 func Test_WhenReviewThreadIsEmpty_WillNotRequireAction(t *testing.T) {
-	constructedButEmpty, _ := actionableThreads(prSearchResultGraphQl{ReviewThreads: struct {
-		Edges []struct{ Node prReviewThreadGraphQl }
-	}{
-		Edges: []struct{ Node prReviewThreadGraphQl }{{Node: prReviewThreadGraphQl{Comments: struct {
-			Nodes []prReviewThreadCommentGraphQl
-		}{}}}},
+	constructedButEmpty, _ := actionableThreads(prSearchResultGraphQl{ReviewThreads: prReviewThreadConnectionGraphQl{
+		Edges: []struct{ Node prReviewThreadGraphQl }{{Node: prReviewThreadGraphQl{Comments: prReviewThreadCommentConnectionGraphQl{}}}},
 	},
-	}, "currentUser")
+	}, "currentUser", Bots{})
 
 	if constructedButEmpty != 0 {
 		t.Fatalf("expected 0 actionable threads on an empty struct, got %d", constructedButEmpty)
 	}
 
-	actuallyEmpty, _ := actionableThreads(prSearchResultGraphQl{}, "currentUser")
+	actuallyEmpty, _ := actionableThreads(prSearchResultGraphQl{}, "currentUser", Bots{})
 
 	if actuallyEmpty != 0 {
 		t.Fatalf("expected 0 actionable threads for an empty pr, got %d", actuallyEmpty)
@@ -27,16 +33,12 @@ func Test_WhenReviewThreadIsEmpty_WillNotRequireAction(t *testing.T) {
 }
 
 func Test_WhenHavingUnansweredComments_WillCountTowardsWaiting(t *testing.T) {
-	_, got := actionableThreads(prSearchResultGraphQl{ReviewThreads: struct {
-		Edges []struct{ Node prReviewThreadGraphQl }
-	}{
-		Edges: []struct{ Node prReviewThreadGraphQl }{{Node: prReviewThreadGraphQl{Comments: struct {
-			Nodes []prReviewThreadCommentGraphQl
-		}{
-			[]prReviewThreadCommentGraphQl{{Author: struct{ Login string }{Login: "currentUser"}, Body: "a question"}},
+	_, got := actionableThreads(prSearchResultGraphQl{ReviewThreads: prReviewThreadConnectionGraphQl{
+		Edges: []struct{ Node prReviewThreadGraphQl }{{Node: prReviewThreadGraphQl{Comments: prReviewThreadCommentConnectionGraphQl{
+			Nodes: []prReviewThreadCommentGraphQl{{Author: actorGraphQl{Login: "currentUser"}, Body: "a question"}},
 		}}}},
 	},
-	}, "currentUser")
+	}, "currentUser", Bots{})
 
 	if wanted := 1; wanted != got {
 		t.Fatalf("expected %d waiting threads, got %d", wanted, got)
@@ -44,7 +46,7 @@ func Test_WhenHavingUnansweredComments_WillCountTowardsWaiting(t *testing.T) {
 }
 
 func commentBy(username string) prReviewThreadCommentGraphQl {
-	return prReviewThreadCommentGraphQl{Author: struct{ Login string }{Login: username}}
+	return prReviewThreadCommentGraphQl{Author: actorGraphQl{Login: username}}
 }
 
 func HangingFuzz_WhenReviewThreadsExist_WillCountUnresponded(f *testing.F) {
@@ -90,18 +92,14 @@ func HangingFuzz_WhenReviewThreadsExist_WillCountUnresponded(f *testing.F) {
 		}
 		threads := prSearchResultGraphQl{
 			Author: struct{ Login string }{Login: prAuthor},
-			ReviewThreads: struct {
-				Edges []struct{ Node prReviewThreadGraphQl }
-			}{
-				Edges: []struct{ Node prReviewThreadGraphQl }{{Node: prReviewThreadGraphQl{Comments: struct {
-					Nodes []prReviewThreadCommentGraphQl
-				}{
-					allComments,
+			ReviewThreads: prReviewThreadConnectionGraphQl{
+				Edges: []struct{ Node prReviewThreadGraphQl }{{Node: prReviewThreadGraphQl{Comments: prReviewThreadCommentConnectionGraphQl{
+					Nodes: allComments,
 				}}}},
 			},
 		}
 
-		actionableThreads, _ := actionableThreads(threads, myUsername)
+		actionableThreads, _ := actionableThreads(threads, myUsername, Bots{})
 
 		if numberOfComments == 0 {
 			if actionableThreads != 0 {
@@ -149,3 +147,158 @@ func countCommentsByUser(pr prSearchResultGraphQl, username string) map[int]stru
 
 	return myCommentIndexes
 }
+
+func Test_ReviewThreads_DescribesEachThread(t *testing.T) {
+	raw := []byte(`{
+		"author": {"login": "currentUser"},
+		"reviewThreads": {"edges": [
+			{"node": {"comments": {"nodes": [
+				{"author": {"login": "reviewer"}, "url": "https://github.com/o/r/pull/1#discussion_r1"},
+				{"author": {"login": "currentUser"}, "url": "https://github.com/o/r/pull/1#discussion_r2"},
+				{"author": {"login": "reviewer"}, "url": "https://github.com/o/r/pull/1#discussion_r3", "body": "  what about\n\nthis?  "}
+			]}}},
+			{"node": {"isResolved": true, "comments": {"nodes": [
+				{"author": {"login": "reviewer"}, "url": "https://github.com/o/r/pull/1#discussion_r4"}
+			]}}}
+		]}
+	}`)
+
+	var pr prSearchResultGraphQl
+	if err := json.Unmarshal(raw, &pr); err != nil {
+		t.Fatal(err)
+	}
+	threads := reviewThreads(pr, "currentUser", Bots{})
+	if len(threads) != 1 {
+		t.Fatalf("expected 1 thread (the other one is resolved), got %d: %+v", len(threads), threads)
+	}
+
+	got := threads[0]
+	if !got.Actionable {
+		t.Error("expected the thread to be actionable")
+	}
+	if got.Url != "https://github.com/o/r/pull/1#discussion_r3" {
+		t.Errorf("expected the url of the last comment, got %s", got.Url)
+	}
+	if got.FirstCommenter != "reviewer" || got.LastCommenter != "reviewer" || got.Comments != 3 {
+		t.Errorf("unexpected thread details: %+v", got)
+	}
+	if got.LastCommentExcerpt != "what about this?" {
+		t.Errorf("expected the last comment on a single line, got %q", got.LastCommentExcerpt)
+	}
+}
+
+func Test_Excerpt_ShortensLongComments(t *testing.T) {
+	long := strings.Repeat("å", excerptLength+10)
+	got := []rune(excerpt(long))
+	if len(got) != excerptLength {
+		t.Fatalf("expected %d runes, got %d", excerptLength, len(got))
+	}
+	if got[len(got)-1] != '…' {
+		t.Errorf("expected an ellipsis at the end, got %q", string(got))
+	}
+}
+
+func Test_ReviewThreads_IgnoresBots(t *testing.T) {
+	raw := []byte(`{
+		"author": {"login": "author"},
+		"reviewThreads": {"edges": [
+			{"node": {"comments": {"nodes": [
+				{"author": {"login": "author", "__typename": "User"}, "url": "https://github.com/o/r/pull/1#discussion_r1"},
+				{"author": {"login": "currentUser", "__typename": "User"}, "url": "https://github.com/o/r/pull/1#discussion_r2"},
+				{"author": {"login": "coderabbitai", "__typename": "Bot"}, "url": "https://github.com/o/r/pull/1#discussion_r3"}
+			]}}},
+			{"node": {"comments": {"nodes": [
+				{"author": {"login": "sonar-linter", "__typename": "User"}, "url": "https://github.com/o/r/pull/1#discussion_r4"}
+			]}}}
+		]}
+	}`)
+
+	var pr prSearchResultGraphQl
+	if err := json.Unmarshal(raw, &pr); err != nil {
+		t.Fatal(err)
+	}
+	threads := reviewThreads(pr, "currentUser", Bots{Logins: regexp.MustCompile(`-linter$`)})
+	if len(threads) != 1 {
+		t.Fatalf("expected 1 thread (the other one only has a bot's comment), got %d: %+v", len(threads), threads)
+	}
+	got := threads[0]
+	if got.Actionable || got.LastCommenter != "currentUser" || got.Comments != 2 {
+		t.Errorf("expected the bot's reply to be ignored, got %+v", got)
+	}
+}
+
+func Test_QueryGithub_IgnoresBotCommentsAndReviews(t *testing.T) {
+	response := `{"data": {"search": {"edges": [{"node": {
+		"url": "https://github.com/o/r/pull/1",
+		"updatedAt": "2025-06-20T12:00:00Z",
+		"author": {"login": "currentUser"},
+		"comments": {"edges": [
+			{"node": {"author": {"login": "reviewer", "__typename": "User"}}},
+			{"node": {"author": {"login": "vercel", "__typename": "Bot"}}},
+			{"node": {"author": {"login": "ci-user", "__typename": "User"}}}
+		]},
+		"reviews": {"edges": [
+			{"node": {"author": {"login": "auto-approver", "__typename": "Bot"}, "state": "APPROVED"}}
+		]}
+	}}]}}}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, response) //nolint:errcheck // test server
+	}))
+	defer srv.Close()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	prs, err := QueryGithub(context.Background(), srv.URL, "token", "currentUser", Bots{Logins: regexp.MustCompile(`^ci-user$`)}, nil, logger)
+	if err != nil {
+		t.Fatalf("QueryGithub failed: %v", err)
+	}
+	if len(prs) != 1 {
+		t.Fatalf("expected 1 PR, got %d", len(prs))
+	}
+	if prs[0].LastPrCommenter != "reviewer" {
+		t.Errorf("expected the last human commenter, got %q", prs[0].LastPrCommenter)
+	}
+	if prs[0].ReviewStatus != "" {
+		t.Errorf("expected a bot's approval to be ignored, got %q", prs[0].ReviewStatus)
+	}
+}
+
+func Test_QueryGithub_ClassifiesErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		status int
+		header map[string]string
+		body   string
+		want   string
+	}{
+		{name: "forbidden", status: http.StatusForbidden, body: `{"message": "Resource not accessible by personal access token"}`, want: types.ErrorClassClient},
+		{name: "proxy error page", status: http.StatusBadGateway, body: `<html>bad gateway</html>`, want: types.ErrorClassServer},
+		{name: "rate limited", status: http.StatusOK, header: map[string]string{"retry-after": "60"}, body: `{"errors": [{"type": "RATE_LIMITED"}]}`, want: types.ErrorClassRateLimited},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				for k, v := range tt.header {
+					w.Header().Set(k, v)
+				}
+				w.WriteHeader(tt.status)
+				io.WriteString(w, tt.body) //nolint:errcheck // test server
+			}))
+			defer srv.Close()
+
+			logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+			_, err := QueryGithub(context.Background(), srv.URL, "token", "currentUser", Bots{}, nil, logger)
+			if got := ErrorClass(err); got != tt.want {
+				t.Errorf("expected %q, got %q for %v", tt.want, got, err)
+			}
+		})
+	}
+
+	t.Run("unreachable", func(t *testing.T) {
+		srv := httptest.NewServer(http.NotFoundHandler())
+		srv.Close()
+		logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+		_, err := QueryGithub(context.Background(), srv.URL, "token", "currentUser", Bots{}, nil, logger)
+		if got := ErrorClass(err); got != types.ErrorClassNetwork {
+			t.Errorf("expected %q, got %q for %v", types.ErrorClassNetwork, got, err)
+		}
+	})
+}
@@ -0,0 +1,144 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/chelmertz/elly/internal/types"
+)
+
+// A PR's updatedAt is bumped by commits, comments, reviews and review
+// requests, which is (almost) everything the points are calculated from. So
+// instead of fetching everything about every PR, QueryChangedPrs first asks
+// for the updatedAt of each PR, which is cheap, and then only fetches the
+// details of the PRs that changed since they were stored.
+
+func queryPrUpdates(username string) string {
+	query := `query prUpdates {
+  ...rateLimitFields
+  search(type: ISSUE, query: "%s", first: 100) {
+    edges {
+      node {
+        ... on PullRequest {
+          id
+          url
+          updatedAt
+        }
+      }
+    }
+  }
+}`
+	return fmt.Sprintf(query, searchPrsInvolvingUser(username)) + rateLimitFieldsFragment
+}
+
+// queryPrsByIds is limited to 100 ids, like the search.
+const queryPrsByIds = `query prsByIds($ids: [ID!]!) {
+  ...rateLimitFields
+  nodes(ids: $ids) {
+    ...prFields
+  }
+}
+` + prFieldsFragments + rateLimitFieldsFragment
+
+// QueryChangedPrs returns the same PRs as QueryGithub, but only fetches the
+// ones that aren't in stored, or that have been updated since they were
+// stored. The others are returned as they were stored.
+func QueryChangedPrs(ctx context.Context, baseURL, token string, username string, bots Bots, stored []types.ViewPr, rl *RateLimitCollector, logger *slog.Logger) ([]types.ViewPr, error) {
+	prs, fetched, err := queryChangedPrs(ctx, baseURL, token, username, bots, stored, rl, logger)
+	countRequest(err)
+	if err != nil {
+		return nil, err
+	}
+	prDetailsTotal.WithLabelValues("fetched").Add(float64(fetched))
+	prDetailsTotal.WithLabelValues("reused").Add(float64(len(prs) - fetched))
+	return prs, nil
+}
+
+func queryChangedPrs(ctx context.Context, baseURL, token string, username string, bots Bots, stored []types.ViewPr, rl *RateLimitCollector, logger *slog.Logger) (prs []types.ViewPr, fetched int, err error) {
+	respBody, err := graphqlRequest(ctx, baseURL, queryPrUpdates(username), nil, token, rl, logger)
+	if err != nil {
+		return nil, 0, fmt.Errorf("could not query github for updated PRs: %w", err)
+	}
+	var updates struct {
+		Data struct {
+			Search struct {
+				Edges []struct {
+					Node struct {
+						Id        string
+						Url       string
+						UpdatedAt string
+					}
+				}
+			}
+		}
+	}
+	if err := json.Unmarshal(respBody, &updates); err != nil {
+		return nil, 0, fmt.Errorf("could not unmarshal github response: %w", err)
+	}
+
+	storedPerUrl := make(map[string]types.ViewPr, len(stored))
+	for _, pr := range stored {
+		storedPerUrl[pr.Url] = pr
+	}
+
+	// search order is kept, the changed PRs are filled in below
+	prs = make([]types.ViewPr, 0, len(updates.Data.Search.Edges))
+	changed := make(map[string]int)
+	var changedIds []string
+	for _, edge := range updates.Data.Search.Edges {
+		pr, found := storedPerUrl[edge.Node.Url]
+		updatedAt, err := time.Parse(time.RFC3339, edge.Node.UpdatedAt)
+		if found && err == nil && updatedAt.Equal(pr.LastUpdated) {
+			prs = append(prs, pr)
+			continue
+		}
+		changed[edge.Node.Url] = len(prs)
+		changedIds = append(changedIds, edge.Node.Id)
+		prs = append(prs, types.ViewPr{Url: edge.Node.Url})
+	}
+	logger.Debug("found changed prs", slog.Int("prs", len(prs)), slog.Int("changed", len(changedIds)))
+
+	for ids := range slices.Chunk(changedIds, 100) {
+		respBody, err := graphqlRequest(ctx, baseURL, queryPrsByIds, map[string]any{"ids": ids}, token, rl, logger)
+		if err != nil {
+			return nil, 0, fmt.Errorf("could not query github for changed PRs: %w", err)
+		}
+		var details struct {
+			Data struct {
+				Nodes []json.RawMessage
+			}
+		}
+		if err := json.Unmarshal(respBody, &details); err != nil {
+			return nil, 0, fmt.Errorf("could not unmarshal github response: %w", err)
+		}
+		for _, rawPr := range details.Data.Nodes {
+			if string(rawPr) == "null" {
+				// closed or deleted in between the queries
+				continue
+			}
+			pr, err := toViewPr(ctx, baseURL, token, username, bots, rawPr, rl, logger)
+			if err != nil {
+				return nil, 0, err
+			}
+			if i, ok := changed[pr.Url]; ok {
+				prs[i] = pr
+				fetched++
+				delete(changed, pr.Url)
+			}
+		}
+	}
+
+	// what's left is gone since the search, and left out like it would have
+	// been if it was gone before
+	if len(changed) > 0 {
+		prs = slices.DeleteFunc(prs, func(pr types.ViewPr) bool {
+			_, missing := changed[pr.Url]
+			return missing
+		})
+	}
+	return prs, fetched, nil
+}
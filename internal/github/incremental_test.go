@@ -0,0 +1,75 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chelmertz/elly/internal/types"
+)
+
+func Test_QueryChangedPrs_OnlyFetchesUpdatedPrs(t *testing.T) {
+	updatedAt := time.Date(2025, 6, 20, 12, 0, 0, 0, time.UTC)
+	var requestedIds []any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Query     string
+			Variables map[string]any
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("could not decode request: %v", err)
+			return
+		}
+		var response string
+		switch {
+		case strings.HasPrefix(request.Query, "query prUpdates {"):
+			response = `{"data": {"search": {"edges": [
+				{"node": {"id": "PR_1", "url": "https://github.com/o/r/pull/1", "updatedAt": "2025-06-20T12:00:00Z"}},
+				{"node": {"id": "PR_2", "url": "https://github.com/o/r/pull/2", "updatedAt": "2025-06-20T13:00:00Z"}},
+				{"node": {"id": "PR_3", "url": "https://github.com/o/r/pull/3", "updatedAt": "2025-06-20T13:00:00Z"}},
+				{"node": {"id": "PR_4", "url": "https://github.com/o/r/pull/4", "updatedAt": "2025-06-20T13:00:00Z"}}
+			]}}}`
+		case strings.HasPrefix(request.Query, "query prsByIds("):
+			requestedIds = request.Variables["ids"].([]any)
+			// PR 4 was closed in between
+			response = `{"data": {"nodes": [
+				{"id": "PR_2", "url": "https://github.com/o/r/pull/2", "title": "changed", "updatedAt": "2025-06-20T13:00:00Z", "author": {"login": "you"}},
+				{"id": "PR_3", "url": "https://github.com/o/r/pull/3", "title": "new", "updatedAt": "2025-06-20T13:00:00Z", "author": {"login": "you"}},
+				null
+			]}}`
+		default:
+			t.Errorf("unexpected query: %s", request.Query)
+		}
+		io.WriteString(w, response) //nolint:errcheck // test server
+	}))
+	defer srv.Close()
+
+	stored := []types.ViewPr{
+		{Url: "https://github.com/o/r/pull/1", Title: "unchanged", LastUpdated: updatedAt},
+		{Url: "https://github.com/o/r/pull/2", Title: "stale", LastUpdated: updatedAt},
+		{Url: "https://github.com/o/r/pull/5", Title: "closed", LastUpdated: updatedAt},
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	prs, err := QueryChangedPrs(context.Background(), srv.URL, "token", "me", Bots{}, stored, nil, logger)
+	if err != nil {
+		t.Fatalf("QueryChangedPrs failed: %v", err)
+	}
+
+	if want := []any{"PR_2", "PR_3", "PR_4"}; !slices.Equal(requestedIds, want) {
+		t.Errorf("expected the details of %v to be fetched, got %v", want, requestedIds)
+	}
+	var titles []string
+	for _, pr := range prs {
+		titles = append(titles, pr.Title)
+	}
+	if want := []string{"unchanged", "changed", "new"}; !slices.Equal(titles, want) {
+		t.Errorf("expected the PRs %v, in search order, got %v", want, titles)
+	}
+}
@@ -0,0 +1,241 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+)
+
+// The search query fetches 100 PRs at once, so it can only ask for the first
+// few review threads (and comments) of each PR before hitting Github's node
+// limit. The PRs with more than that are completed here, with follow-up
+// queries per PR and per thread, so that the actionable threads are counted
+// on every thread.
+
+// maxFollowUpPages is per connection, so that a PR with thousands of comments
+// can't eat the whole rate limit. What's left after that is logged.
+const maxFollowUpPages = 10
+
+type pageInfoGraphQl struct {
+	HasNextPage     bool
+	EndCursor       string
+	HasPreviousPage bool
+	StartCursor     string
+}
+
+// The fragments are shared by the search query and the follow-up queries, so
+// that a thread looks the same no matter which query found it. Github rejects
+// queries with unused fragments, so each query only appends the ones it uses.
+
+const prCommentFieldsFragment = `
+fragment prCommentFields on IssueComment {
+  updatedAt
+  author {
+    __typename
+    login
+  }
+  url
+  body
+  reactions(first: 7) {
+    edges {
+      node {
+        content
+        user {
+          login
+        }
+      }
+    }
+  }
+}
+`
+
+// reviewThreadFieldsFragment uses reviewThreadCommentFieldsFragment.
+const reviewThreadFieldsFragment = `
+fragment reviewThreadFields on PullRequestReviewThread {
+  id
+  isResolved
+  isOutdated
+  isCollapsed
+  comments(first: 30) {
+    pageInfo {
+      hasNextPage
+      endCursor
+    }
+    nodes {
+      ...reviewThreadCommentFields
+    }
+  }
+}
+`
+
+const reviewThreadCommentFieldsFragment = `
+fragment reviewThreadCommentFields on PullRequestReviewComment {
+  author {
+    __typename
+    login
+  }
+  body
+  url
+  reactions(first: 7) {
+    edges {
+      node {
+        content
+        user {
+          login
+        }
+      }
+    }
+  }
+}
+`
+
+const queryMoreReviewThreads = `query moreReviewThreads($id: ID!, $after: String) {
+  ...rateLimitFields
+  node(id: $id) {
+    ... on PullRequest {
+      reviewThreads(first: 50, after: $after) {
+        pageInfo {
+          hasNextPage
+          endCursor
+        }
+        edges {
+          node {
+            ...reviewThreadFields
+          }
+        }
+      }
+    }
+  }
+}
+` + reviewThreadFieldsFragment + reviewThreadCommentFieldsFragment + rateLimitFieldsFragment
+
+const queryMoreReviewThreadComments = `query moreReviewThreadComments($id: ID!, $after: String) {
+  ...rateLimitFields
+  node(id: $id) {
+    ... on PullRequestReviewThread {
+      comments(first: 100, after: $after) {
+        pageInfo {
+          hasNextPage
+          endCursor
+        }
+        nodes {
+          ...reviewThreadCommentFields
+        }
+      }
+    }
+  }
+}
+` + reviewThreadCommentFieldsFragment + rateLimitFieldsFragment
+
+const queryEarlierPrComments = `query earlierPrComments($id: ID!, $before: String) {
+  ...rateLimitFields
+  node(id: $id) {
+    ... on PullRequest {
+      comments(last: 20, before: $before) {
+        pageInfo {
+          hasPreviousPage
+          startCursor
+        }
+        edges {
+          node {
+            ...prCommentFields
+          }
+        }
+      }
+    }
+  }
+}
+` + prCommentFieldsFragment + rateLimitFieldsFragment
+
+// fetchRemainingPages completes pr with the review threads, and the comments
+// of the threads, that didn't fit in the search query. The comments on the PR
+// itself are only used for finding the last commenter, so earlier ones are
+// only fetched while there's no human among them.
+func fetchRemainingPages(ctx context.Context, baseURL, token string, pr *prSearchResultGraphQl, bots Bots, rl *RateLimitCollector, logger *slog.Logger) error {
+	threads := &pr.ReviewThreads
+	for page := 0; threads.PageInfo.HasNextPage; page++ {
+		if page == maxFollowUpPages {
+			logger.Warn("too many review threads, skipping the rest", slog.String("pr_url", pr.Url), slog.Int("threads", len(threads.Edges)))
+			break
+		}
+		var response struct {
+			Data struct {
+				Node struct {
+					ReviewThreads prReviewThreadConnectionGraphQl
+				}
+			}
+		}
+		if err := followUpQuery(ctx, baseURL, token, queryMoreReviewThreads, map[string]any{"id": pr.Id, "after": threads.PageInfo.EndCursor}, &response, rl, logger); err != nil {
+			return err
+		}
+		threads.Edges = append(threads.Edges, response.Data.Node.ReviewThreads.Edges...)
+		threads.PageInfo = response.Data.Node.ReviewThreads.PageInfo
+	}
+
+	for i := range threads.Edges {
+		thread := &threads.Edges[i].Node
+		if thread.IsCollapsed || thread.IsOutdated || thread.IsResolved {
+			// never looked at, see reviewThreads()
+			continue
+		}
+		for page := 0; thread.Comments.PageInfo.HasNextPage; page++ {
+			if page == maxFollowUpPages {
+				logger.Warn("too many comments in review thread, skipping the rest", slog.String("pr_url", pr.Url), slog.Int("comments", len(thread.Comments.Nodes)))
+				break
+			}
+			var response struct {
+				Data struct {
+					Node struct {
+						Comments prReviewThreadCommentConnectionGraphQl
+					}
+				}
+			}
+			if err := followUpQuery(ctx, baseURL, token, queryMoreReviewThreadComments, map[string]any{"id": thread.Id, "after": thread.Comments.PageInfo.EndCursor}, &response, rl, logger); err != nil {
+				return err
+			}
+			thread.Comments.Nodes = append(thread.Comments.Nodes, response.Data.Node.Comments.Nodes...)
+			thread.Comments.PageInfo = response.Data.Node.Comments.PageInfo
+		}
+	}
+
+	comments := &pr.Comments
+	for page := 0; comments.PageInfo.HasPreviousPage && onlyBotComments(*comments, bots); page++ {
+		if page == maxFollowUpPages {
+			logger.Warn("too many comments by bots, skipping the rest", slog.String("pr_url", pr.Url), slog.Int("comments", len(comments.Edges)))
+			break
+		}
+		var response struct {
+			Data struct {
+				Node struct {
+					Comments prCommentConnectionGraphQl
+				}
+			}
+		}
+		if err := followUpQuery(ctx, baseURL, token, queryEarlierPrComments, map[string]any{"id": pr.Id, "before": comments.PageInfo.StartCursor}, &response, rl, logger); err != nil {
+			return err
+		}
+		comments.Edges = append(response.Data.Node.Comments.Edges, comments.Edges...)
+		comments.PageInfo = response.Data.Node.Comments.PageInfo
+	}
+
+	return nil
+}
+
+func onlyBotComments(comments prCommentConnectionGraphQl, bots Bots) bool {
+	return !slices.ContainsFunc(comments.Edges, func(c struct{ Node prCommentGraphQl }) bool {
+		return !bots.isBot(c.Node.Author)
+	})
+}
+
+func followUpQuery(ctx context.Context, baseURL, token, query string, variables map[string]any, response any, rl *RateLimitCollector, logger *slog.Logger) error {
+	respBody, err := graphqlRequest(ctx, baseURL, query, variables, token, rl, logger)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(respBody, response); err != nil {
+		return fmt.Errorf("could not unmarshal github response: %w", err)
+	}
+	return nil
+}
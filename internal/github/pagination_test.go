@@ -0,0 +1,130 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// paginatedGithub answers the search query with a PR whose threads and
+// comments don't fit in it, and the follow-up queries with the rest.
+func paginatedGithub(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Query     string
+			Variables map[string]any
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("could not decode request: %v", err)
+			return
+		}
+		var response string
+		switch {
+		case strings.HasPrefix(request.Query, "query moreReviewThreads("):
+			if request.Variables["id"] != "PR_1" || request.Variables["after"] != "threads-1" {
+				t.Errorf("unexpected variables: %v", request.Variables)
+			}
+			// the 16th thread is the one that matters
+			response = `{"data": {"node": {"reviewThreads": {
+				"pageInfo": {"hasNextPage": false},
+				"edges": [{"node": {"id": "THREAD_2", "comments": {"nodes": [
+					{"author": {"login": "currentUser"}},
+					{"author": {"login": "reviewer"}}
+				]}}}]
+			}}}}`
+		case strings.HasPrefix(request.Query, "query moreReviewThreadComments("):
+			if request.Variables["id"] != "THREAD_1" || request.Variables["after"] != "comments-1" {
+				t.Errorf("unexpected variables: %v", request.Variables)
+			}
+			response = `{"data": {"node": {"comments": {
+				"pageInfo": {"hasNextPage": false},
+				"nodes": [{"author": {"login": "currentUser"}}]
+			}}}}`
+		case strings.HasPrefix(request.Query, "query earlierPrComments("):
+			if request.Variables["id"] != "PR_1" || request.Variables["before"] != "pr-comments-1" {
+				t.Errorf("unexpected variables: %v", request.Variables)
+			}
+			response = `{"data": {"node": {"comments": {
+				"pageInfo": {"hasPreviousPage": true, "startCursor": "pr-comments-0"},
+				"edges": [{"node": {"author": {"login": "reviewer", "__typename": "User"}}}]
+			}}}}`
+		default:
+			response = `{"data": {"search": {"edges": [{"node": {
+				"id": "PR_1",
+				"url": "https://github.com/o/r/pull/1",
+				"updatedAt": "2025-06-20T12:00:00Z",
+				"author": {"login": "currentUser"},
+				"comments": {
+					"pageInfo": {"hasPreviousPage": true, "startCursor": "pr-comments-1"},
+					"edges": [{"node": {"author": {"login": "vercel", "__typename": "Bot"}}}]
+				},
+				"reviewThreads": {
+					"pageInfo": {"hasNextPage": true, "endCursor": "threads-1"},
+					"edges": [{"node": {"id": "THREAD_1", "comments": {
+						"pageInfo": {"hasNextPage": true, "endCursor": "comments-1"},
+						"nodes": [{"author": {"login": "reviewer"}}]
+					}}}]
+				}
+			}}]}}}`
+		}
+		io.WriteString(w, response) //nolint:errcheck // test server
+	}))
+}
+
+func Test_QueryGithub_FetchesRemainingPages(t *testing.T) {
+	srv := paginatedGithub(t)
+	defer srv.Close()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	prs, err := QueryGithub(context.Background(), srv.URL, "token", "currentUser", Bots{}, nil, logger)
+	if err != nil {
+		t.Fatalf("QueryGithub failed: %v", err)
+	}
+	if len(prs) != 1 {
+		t.Fatalf("expected 1 PR, got %d", len(prs))
+	}
+	pr := prs[0]
+	// the first thread was answered on the next page of its comments, the
+	// second thread is on the next page of threads
+	if pr.ThreadsActionable != 1 || pr.ThreadsWaiting != 0 {
+		t.Errorf("expected 1 actionable thread, got %d actionable and %d waiting: %+v", pr.ThreadsActionable, pr.ThreadsWaiting, pr.ReviewThreads)
+	}
+	if len(pr.ReviewThreads) != 1 || pr.ReviewThreads[0].Comments != 2 {
+		t.Errorf("expected the thread from the second page, got %+v", pr.ReviewThreads)
+	}
+	// earlier comments are fetched until there's a human among them, not
+	// until there are no more
+	if pr.LastPrCommenter != "reviewer" {
+		t.Errorf("expected the last human commenter from the earlier page, got %q", pr.LastPrCommenter)
+	}
+}
+
+// allQueries are the queries sent to Github, per name.
+func allQueries() map[string]string {
+	return map[string]string{
+		"search":                   querySearchPrsInvolvingUser("currentUser"),
+		"moreReviewThreads":        queryMoreReviewThreads,
+		"moreReviewThreadComments": queryMoreReviewThreadComments,
+		"earlierPrComments":        queryEarlierPrComments,
+		"prUpdates":                queryPrUpdates("currentUser"),
+		"prsByIds":                 queryPrsByIds,
+		"probe":                    queryProbe,
+	}
+}
+
+func Test_Queries_UseAllTheirFragments(t *testing.T) {
+	fragment := regexp.MustCompile(`fragment (\w+) on`)
+	for name, query := range allQueries() {
+		for _, m := range fragment.FindAllStringSubmatch(query, -1) {
+			if !strings.Contains(query, "..."+m[1]) {
+				t.Errorf("%s defines the unused fragment %s, which Github rejects", name, m[1])
+			}
+		}
+	}
+}
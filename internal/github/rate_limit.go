@@ -0,0 +1,110 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/chelmertz/elly/internal/types"
+)
+
+// Github only tells about the rate limit when it's too late (RATE_LIMITED), or
+// when asked. So every query asks for what's left of the budget, so that elly
+// can slow down before running out of it.
+
+const rateLimitFieldsFragment = `
+fragment rateLimitFields on Query {
+  rateLimit {
+    cost
+    remaining
+    resetAt
+    limit
+  }
+}
+`
+
+const queryProbe = `query probe {
+  ...rateLimitFields
+}
+` + rateLimitFieldsFragment
+
+// Probe sends the cheapest query there is, to see whether Github answers
+// again, without spending more than that on it.
+func Probe(ctx context.Context, baseURL, token string, rl *RateLimitCollector, logger *slog.Logger) error {
+	_, err := graphqlRequest(ctx, baseURL, queryProbe, nil, token, rl, logger)
+	return err
+}
+
+type rateLimitGraphQl struct {
+	Cost      int
+	Remaining int
+	ResetAt   string
+	Limit     int
+}
+
+// RateLimitCollector collects what Github tells about the rate limit in the
+// responses to a refresh's queries, whether the refresh as a whole succeeds or
+// not. It's passed to each query, since the budget is the PAT's: queries made
+// with another PAT (e.g. one being validated) pass nil, and collect nothing.
+type RateLimitCollector struct {
+	mu     sync.Mutex
+	budget *types.RateLimitBudget
+	cost   int
+}
+
+// Budget returns the budget as told by the latest response. Returns false
+// until a response has told.
+func (c *RateLimitCollector) Budget() (types.RateLimitBudget, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.budget == nil {
+		return types.RateLimitBudget{}, false
+	}
+	return *c.budget, true
+}
+
+// Cost returns the points spent by all the queries so far.
+func (c *RateLimitCollector) Cost() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.cost
+}
+
+// observe records the rate limit in respBody, if the query asked for it. c
+// may be nil.
+func (c *RateLimitCollector) observe(respBody []byte, logger *slog.Logger) {
+	if c == nil {
+		return
+	}
+	var response struct {
+		Data struct {
+			RateLimit *rateLimitGraphQl
+		}
+	}
+	if err := json.Unmarshal(respBody, &response); err != nil || response.Data.RateLimit == nil {
+		return
+	}
+	rl := response.Data.RateLimit
+	resetAt, err := time.Parse(time.RFC3339, rl.ResetAt)
+	if err != nil {
+		logger.Warn("could not parse github's rate limit reset time", slog.Any("error", err), slog.String("reset_at", rl.ResetAt))
+		return
+	}
+
+	rateLimitRemaining.Set(float64(rl.Remaining))
+	rateLimitLimit.Set(float64(rl.Limit))
+	rateLimitResetTimestamp.Set(float64(resetAt.Unix()))
+	rateLimitCostTotal.Add(float64(rl.Cost))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cost += rl.Cost
+	c.budget = &types.RateLimitBudget{
+		Cost:      rl.Cost,
+		Remaining: rl.Remaining,
+		Limit:     rl.Limit,
+		ResetAt:   resetAt,
+	}
+}
@@ -0,0 +1,105 @@
+package github
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chelmertz/elly/internal/types"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func Test_Queries_AskForTheRateLimit(t *testing.T) {
+	for name, query := range allQueries() {
+		if !strings.Contains(query, "...rateLimitFields") {
+			t.Errorf("%s doesn't ask for the rate limit", name)
+		}
+	}
+}
+
+func Test_QueryGithub_ObservesRateLimit(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"data": {
+			"rateLimit": {"cost": 3, "remaining": 4321, "resetAt": "2025-06-20T13:00:00Z", "limit": 5000},
+			"search": {"edges": []}
+		}}`) //nolint:errcheck // test server
+	}))
+	defer srv.Close()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	rl := &RateLimitCollector{}
+	if _, found := rl.Budget(); found {
+		t.Fatal("expected no budget before a response told it")
+	}
+	if _, err := QueryGithub(context.Background(), srv.URL, "token", "currentUser", Bots{}, rl, logger); err != nil {
+		t.Fatalf("QueryGithub failed: %v", err)
+	}
+
+	budget, found := rl.Budget()
+	want := types.RateLimitBudget{
+		Cost:      3,
+		Remaining: 4321,
+		Limit:     5000,
+		ResetAt:   time.Date(2025, 6, 20, 13, 0, 0, 0, time.UTC),
+	}
+	if !found || budget != want {
+		t.Errorf("expected the budget %+v, got %+v (found: %v)", want, budget, found)
+	}
+}
+
+func Test_ValidatePAT_LeavesTheRateLimitAlone(t *testing.T) {
+	// the refreshing PAT's budget
+	(&RateLimitCollector{}).observe([]byte(`{"data": {"rateLimit": {"cost": 1, "remaining": 4321, "resetAt": "2025-06-20T13:00:00Z", "limit": 5000}}}`), slog.Default())
+
+	// another PAT, with next to nothing left
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"data": {
+			"rateLimit": {"cost": 1, "remaining": 1, "resetAt": "2025-06-20T13:00:00Z", "limit": 5000},
+			"viewer": {"login": "other"},
+			"search": {"edges": []}
+		}}`) //nolint:errcheck // test server
+	}))
+	defer srv.Close()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	if _, _, err := ValidatePAT(srv.URL, "other-token", logger); err != nil {
+		t.Fatalf("ValidatePAT failed: %v", err)
+	}
+
+	if got := testutil.ToFloat64(rateLimitRemaining); got != 4321 {
+		t.Errorf("expected the refreshing PAT's budget to be left alone, got %v remaining", got)
+	}
+}
+
+func Test_CountSavedPoints(t *testing.T) {
+	before := testutil.ToFloat64(rateLimitSavedTotal)
+	if got := CountSavedPoints(12, 2); got != 10 {
+		t.Errorf("expected 10 points saved, got %d", got)
+	}
+	// e.g. when more PRs changed than there were in the latest full refresh
+	if got := CountSavedPoints(2, 12); got != 0 {
+		t.Errorf("expected nothing saved, got %d", got)
+	}
+	if got := testutil.ToFloat64(rateLimitSavedTotal) - before; got != 10 {
+		t.Errorf("expected 10 saved points to be counted, got %v", got)
+	}
+}
+
+func Test_RateLimitCollector_SumsTheCost(t *testing.T) {
+	rl := &RateLimitCollector{}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	for _, cost := range []int{1, 3} {
+		rl.observe([]byte(`{"data": {"rateLimit": {"cost": `+strconv.Itoa(cost)+`, "remaining": 4000, "resetAt": "2025-06-20T13:00:00Z", "limit": 5000}}}`), logger)
+	}
+	if got := rl.Cost(); got != 4 {
+		t.Errorf("expected the cost of both queries, got %d", got)
+	}
+	if budget, _ := rl.Budget(); budget.Cost != 3 {
+		t.Errorf("expected the budget of the latest query, got %+v", budget)
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"math"
 	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/chelmertz/elly/internal/types"
@@ -26,6 +28,29 @@ func (p *Points) Remove(points int, reason string) {
 	p.Reasons = append(p.Reasons, reasonWithPrefix)
 }
 
+// Reason is a structured version of an entry in Points.Reasons.
+type Reason struct {
+	Points      int
+	Description string
+}
+
+// Breakdown returns Reasons as structured values, in the same order as
+// Reasons. Entries not created by Add() or Remove() are kept as 0-point
+// reasons rather than dropped.
+func (p *Points) Breakdown() []Reason {
+	reasons := make([]Reason, 0, len(p.Reasons))
+	for _, r := range p.Reasons {
+		prefix, description, found := strings.Cut(r, ": ")
+		points, err := strconv.Atoi(prefix)
+		if !found || err != nil {
+			reasons = append(reasons, Reason{Description: r})
+			continue
+		}
+		reasons = append(reasons, Reason{Points: points, Description: description})
+	}
+	return reasons
+}
+
 // StandardPrPoints() awards points to PRs based on a set of rules.
 // These rules should be revisited often, and the points should be tweaked.
 func StandardPrPoints(pr types.ViewPr, username string, now time.Time) *Points {
@@ -117,6 +142,31 @@ func StandardPrPoints(pr types.ViewPr, username string, now time.Time) *Points {
 		}
 	}
 
+	if pr.NotePoints > 0 {
+		points.Add(pr.NotePoints, noteReason(pr.Note))
+	} else if pr.NotePoints < 0 {
+		points.Remove(-pr.NotePoints, noteReason(pr.Note))
+	}
+
+	for _, tag := range pr.Tags {
+		if tag.Points > 0 {
+			points.Add(tag.Points, "tagged "+tag.Name)
+		} else if tag.Points < 0 {
+			points.Remove(-tag.Points, "tagged "+tag.Name)
+		}
+	}
+
+	for _, rule := range pr.Rules {
+		if rule.Action != types.RulePoints {
+			continue
+		}
+		if rule.Points > 0 {
+			points.Add(rule.Points, "rule for "+rule.String())
+		} else {
+			points.Remove(-rule.Points, "rule for "+rule.String())
+		}
+	}
+
 	sort.Slice(points.Reasons, func(i, j int) bool {
 		// render all + points first, then - points
 		return points.Reasons[i] < points.Reasons[j]
@@ -126,6 +176,23 @@ func StandardPrPoints(pr types.ViewPr, username string, now time.Time) *Points {
 		// TODO test that no other combinations of input can negate the effect of something buried
 		points.Remove(1000, "PR is buried")
 	}
+	for _, rule := range pr.Rules {
+		if rule.Action == types.RuleBury {
+			// once is enough, even if more rules match
+			points.Remove(1000, "buried by the rule for "+rule.String())
+			break
+		}
+	}
 
 	return points
 }
+
+// noteReason shortens a note to its first line, which is all that fits in a
+// reason.
+func noteReason(note string) string {
+	firstLine, _, _ := strings.Cut(strings.TrimSpace(note), "\n")
+	if firstLine == "" {
+		return "Note"
+	}
+	return "Note: " + strings.TrimSpace(firstLine)
+}
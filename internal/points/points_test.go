@@ -68,6 +68,30 @@ func Test_StandardPrPoints(t *testing.T) {
 			now:  time.Now(),
 			want: 11,
 		},
+		{
+			name: "notes adjust the points",
+			pr:   types.ViewPr{Author: "currentUser", LastUpdated: time.Now(), ReviewRequestedFromUsers: []string{"otherUser"}, Note: "review after release", NotePoints: -40},
+			now:  time.Now(),
+			want: -40,
+		},
+		{
+			name: "tags adjust the points",
+			pr:   types.ViewPr{Author: "currentUser", LastUpdated: time.Now(), ReviewRequestedFromUsers: []string{"otherUser"}, Tags: []types.Tag{{Name: "release-blocker", Points: 200}, {Name: "low-prio", Points: -50, OnRepo: true}, {Name: "learning"}}},
+			now:  time.Now(),
+			want: 150,
+		},
+		{
+			name: "rules adjust the points",
+			pr:   types.ViewPr{Author: "currentUser", LastUpdated: time.Now(), ReviewRequestedFromUsers: []string{"otherUser"}, Rules: []types.Rule{{Repo: "acme/*", Action: types.RulePoints, Points: 100}, {Author: "*[bot]", Action: types.RulePoints, Points: -30}}},
+			now:  time.Now(),
+			want: 70,
+		},
+		{
+			name: "rules bury once",
+			pr:   types.ViewPr{Author: "currentUser", LastUpdated: time.Now(), ReviewRequestedFromUsers: []string{"otherUser"}, Rules: []types.Rule{{Repo: "acme/docs", Action: types.RuleBury}, {Author: "*[bot]", Action: types.RuleBury}}},
+			now:  time.Now(),
+			want: -1000,
+		},
 	}
 
 	for _, test := range tests {
@@ -79,3 +103,52 @@ func Test_StandardPrPoints(t *testing.T) {
 		})
 	}
 }
+
+func Test_StandardPrPoints_NoteIsTheReason(t *testing.T) {
+	pr := types.ViewPr{Author: "currentUser", LastUpdated: time.Now(), ReviewRequestedFromUsers: []string{"otherUser"}, Note: "waiting for the infra change\nsee the thread", NotePoints: 25}
+	got := StandardPrPoints(pr, "currentUser", time.Now())
+	want := []string{"+25: Note: waiting for the infra change"}
+	if len(got.Reasons) != 1 || got.Reasons[0] != want[0] {
+		t.Errorf("got reasons %q, want %q", got.Reasons, want)
+	}
+}
+
+func Test_StandardPrPoints_TagIsTheReason(t *testing.T) {
+	pr := types.ViewPr{Author: "currentUser", LastUpdated: time.Now(), ReviewRequestedFromUsers: []string{"otherUser"}, Tags: []types.Tag{{Name: "release-blocker", Points: 200}, {Name: "learning"}}}
+	got := StandardPrPoints(pr, "currentUser", time.Now())
+	want := []string{"+200: tagged release-blocker"}
+	if len(got.Reasons) != 1 || got.Reasons[0] != want[0] {
+		t.Errorf("got reasons %q, want %q", got.Reasons, want)
+	}
+}
+
+func Test_StandardPrPoints_RuleIsTheReason(t *testing.T) {
+	pr := types.ViewPr{Author: "currentUser", LastUpdated: time.Now(), ReviewRequestedFromUsers: []string{"otherUser"}, Rules: []types.Rule{{Repo: "acme/core", Author: "you", Action: types.RulePoints, Points: 40}}}
+	got := StandardPrPoints(pr, "currentUser", time.Now())
+	want := []string{"+40: rule for repo acme/core, author you"}
+	if len(got.Reasons) != 1 || got.Reasons[0] != want[0] {
+		t.Errorf("got reasons %q, want %q", got.Reasons, want)
+	}
+}
+
+func Test_Breakdown(t *testing.T) {
+	p := &Points{}
+	p.Add(80, "Someone asked us something: twice")
+	p.Remove(1000, "PR is buried")
+	p.Reasons = append(p.Reasons, "not formatted by Add()")
+
+	got := p.Breakdown()
+	want := []Reason{
+		{Points: 80, Description: "Someone asked us something: twice"},
+		{Points: -1000, Description: "PR is buried"},
+		{Points: 0, Description: "not formatted by Add()"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Breakdown() = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Breakdown()[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,566 @@
+package server
+
+import (
+	_ "embed"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chelmertz/elly/internal/points"
+	"github.com/chelmertz/elly/internal/storage"
+	"github.com/chelmertz/elly/internal/types"
+)
+
+// v1 is the stable API: the response bodies below are the contract, and are
+// documented in openapi.json. Don't change a field without bumping the
+// version, the contract tests will remind you.
+
+//go:embed openapi.json
+var openApiV1 []byte
+
+type prV1 struct {
+	Id                       string    `json:"id"`
+	Url                      string    `json:"url"`
+	Title                    string    `json:"title"`
+	Author                   string    `json:"author"`
+	RepoOwner                string    `json:"repo_owner"`
+	RepoName                 string    `json:"repo_name"`
+	RepoUrl                  string    `json:"repo_url"`
+	ReviewStatus             string    `json:"review_status"`
+	IsDraft                  bool      `json:"is_draft"`
+	LastUpdated              time.Time `json:"last_updated"`
+	LastPrCommenter          string    `json:"last_pr_commenter"`
+	ThreadsActionable        int       `json:"threads_actionable"`
+	ThreadsWaiting           int       `json:"threads_waiting"`
+	Additions                int       `json:"additions"`
+	Deletions                int       `json:"deletions"`
+	ReviewRequestedFromUsers []string  `json:"review_requested_from_users"`
+	Buried                   bool      `json:"buried"`
+	Points                   pointsV1  `json:"points"`
+	Note                     *noteV1   `json:"note,omitempty"`
+	Tags                     []tagV1   `json:"tags"`
+}
+
+// noteV1 is both how a note is shown, and how it's written.
+type noteV1 struct {
+	Text   string `json:"text"`
+	Points int    `json:"points"`
+}
+
+type tagV1 struct {
+	Name   string `json:"name"`
+	Points int    `json:"points"`
+	OnRepo bool   `json:"on_repo"`
+}
+
+type tagListV1 struct {
+	Tags []tagSummaryV1 `json:"tags"`
+}
+
+type tagSummaryV1 struct {
+	Name   string `json:"name"`
+	Points int    `json:"points"`
+}
+
+type tagPointsV1 struct {
+	Points int `json:"points"`
+}
+
+// ruleV1 is both how a rule is shown, and how it's added (without an id).
+type ruleV1 struct {
+	Id     int64  `json:"id"`
+	Repo   string `json:"repo"`
+	Author string `json:"author"`
+	Action string `json:"action"`
+	Points int    `json:"points"`
+}
+
+type ruleListV1 struct {
+	Rules []ruleV1 `json:"rules"`
+}
+
+type pollingV1 struct {
+	NextPollAt      time.Time `json:"next_poll_at"`
+	IntervalSeconds int       `json:"interval_seconds"`
+	Reason          string    `json:"reason"`
+	NeedsAttention  string    `json:"needs_attention,omitempty"` // why polling is paused until retried
+}
+
+type statusV1 struct {
+	Configured    bool       `json:"configured"`
+	Username      string     `json:"username,omitempty"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+	ExpiresInDays *int       `json:"expires_in_days,omitempty"`
+	ExpiresSoon   bool       `json:"expires_soon"`
+}
+
+// tagFromPath returns the lower cased {tag} of the request.
+func tagFromPath(r *http.Request) (string, error) {
+	return types.NormalizeTag(r.PathValue("tag"))
+}
+
+type pointsV1 struct {
+	Total   int        `json:"total"`
+	Reasons []reasonV1 `json:"reasons"`
+}
+
+type reasonV1 struct {
+	Points      int    `json:"points"`
+	Description string `json:"description"`
+}
+
+type prListV1 struct {
+	Prs    []prV1      `json:"prs"`
+	Groups []prGroupV1 `json:"groups,omitempty"`
+}
+
+type prGroupV1 struct {
+	Key string `json:"key"`
+	Prs []prV1 `json:"prs"`
+}
+
+type prDetailV1 struct {
+	Pr      prV1       `json:"pr"`
+	Threads []threadV1 `json:"threads"`
+	// Raw is Github's response for this PR, only included when asked for.
+	Raw json.RawMessage `json:"raw,omitempty"`
+}
+
+type threadV1 struct {
+	Url                string `json:"url"`
+	Status             string `json:"status"`
+	Reason             string `json:"reason"`
+	FirstCommenter     string `json:"first_commenter"`
+	LastCommenter      string `json:"last_commenter"`
+	LastCommentExcerpt string `json:"last_comment_excerpt"`
+	Comments           int    `json:"comments"`
+}
+
+type errorV1 struct {
+	Error string `json:"error"`
+}
+
+func toPrV1(pr types.ViewPr, p *points.Points) prV1 {
+	reasons := make([]reasonV1, 0, len(p.Reasons))
+	for _, r := range p.Breakdown() {
+		reasons = append(reasons, reasonV1{Points: r.Points, Description: r.Description})
+	}
+
+	// the storage layer gives us [""] for "no users", don't leak that
+	reviewUsers := slices.DeleteFunc(slices.Clone(pr.ReviewRequestedFromUsers), func(u string) bool {
+		return u == ""
+	})
+	if reviewUsers == nil {
+		reviewUsers = make([]string, 0)
+	}
+
+	v1 := prV1{
+		Id:                       pr.Id(),
+		Url:                      pr.Url,
+		Title:                    pr.Title,
+		Author:                   pr.Author,
+		RepoOwner:                pr.RepoOwner,
+		RepoName:                 pr.RepoName,
+		RepoUrl:                  pr.RepoUrl,
+		ReviewStatus:             pr.ReviewStatus,
+		IsDraft:                  pr.IsDraft,
+		LastUpdated:              pr.LastUpdated,
+		LastPrCommenter:          pr.LastPrCommenter,
+		ThreadsActionable:        pr.ThreadsActionable,
+		ThreadsWaiting:           pr.ThreadsWaiting,
+		Additions:                pr.Additions,
+		Deletions:                pr.Deletions,
+		ReviewRequestedFromUsers: reviewUsers,
+		Buried:                   pr.IsBuried(),
+		Points: pointsV1{
+			Total:   p.Total,
+			Reasons: reasons,
+		},
+		Tags: make([]tagV1, 0, len(pr.Tags)),
+	}
+	for _, tag := range pr.Tags {
+		v1.Tags = append(v1.Tags, tagV1(tag))
+	}
+	if pr.Note != "" || pr.NotePoints != 0 {
+		v1.Note = &noteV1{Text: pr.Note, Points: pr.NotePoints}
+	}
+	return v1
+}
+
+func toThreadV1(t types.ReviewThread) threadV1 {
+	status := "waiting"
+	if t.Actionable {
+		status = "actionable"
+	}
+	return threadV1{
+		Url:                t.Url,
+		Status:             status,
+		Reason:             t.Reason,
+		FirstCommenter:     t.FirstCommenter,
+		LastCommenter:      t.LastCommenter,
+		LastCommentExcerpt: t.LastCommentExcerpt,
+		Comments:           t.Comments,
+	}
+}
+
+// prUrlFromId reverses types.ViewPr.Id().
+func prUrlFromId(id string) (string, error) {
+	prUrlBytes, err := base64.StdEncoding.DecodeString(id)
+	if err != nil {
+		return "", err
+	}
+	return string(prUrlBytes), nil
+}
+
+func writeJson(w http.ResponseWriter, logger *slog.Logger, status int, body any) {
+	// encode before writing anything, so that a failure can still be a 500
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		logger.Error("could not encode json response", slog.Any("error", err))
+		status = http.StatusInternalServerError
+		encoded, _ = json.Marshal(errorV1{Error: "could not encode response"})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(encoded, '\n')) //nolint:errcheck // best-effort response body
+}
+
+func writeJsonError(w http.ResponseWriter, logger *slog.Logger, status int, message string) {
+	writeJson(w, logger, status, errorV1{Error: message})
+}
+
+func registerApiV1(mux *http.ServeMux, webConfig HttpServerConfig) {
+	logger := webConfig.Logger
+
+	mux.HandleFunc("GET /api/v1/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(openApiV1) //nolint:errcheck // best-effort response body
+	})
+
+	mux.HandleFunc("GET /api/v1/prs", func(w http.ResponseWriter, r *http.Request) {
+		query, err := parsePrQuery(r.URL.Query())
+		if err != nil {
+			writeJsonError(w, logger, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		state, err := webConfig.Store.Prs()
+		if err != nil {
+			logger.Error("could not read prs", slog.Any("error", err))
+			writeJsonError(w, logger, http.StatusInternalServerError, "could not read PRs")
+			return
+		}
+		result := query.run(state.Prs, getCurrentUsername(webConfig.Store), time.Now())
+
+		response := prListV1{Prs: make([]prV1, 0, len(result.Prs))}
+		for _, pr := range result.Prs {
+			response.Prs = append(response.Prs, toPrV1(pr, result.PointsPerPrUrl[pr.Url]))
+		}
+		if query.GroupBy != "" {
+			response.Groups = make([]prGroupV1, 0, len(result.Groups))
+			for _, g := range result.Groups {
+				group := prGroupV1{Key: g.Key, Prs: make([]prV1, 0, len(g.Prs))}
+				for _, pr := range g.Prs {
+					group.Prs = append(group.Prs, toPrV1(pr, result.PointsPerPrUrl[pr.Url]))
+				}
+				response.Groups = append(response.Groups, group)
+			}
+		}
+
+		writeJson(w, logger, http.StatusOK, response)
+	})
+
+	mux.HandleFunc("GET /api/v1/prs/{id}", func(w http.ResponseWriter, r *http.Request) {
+		ghPrUrl, err := prUrlFromId(r.PathValue("id"))
+		if err != nil {
+			writeJsonError(w, logger, http.StatusBadRequest, "invalid PR ID")
+			return
+		}
+
+		pr, found, err := webConfig.Store.GetPr(ghPrUrl)
+		if err != nil {
+			logger.Error("could not get pr", slog.String("pr_url", ghPrUrl), slog.Any("error", err))
+			writeJsonError(w, logger, http.StatusInternalServerError, "could not get PR "+ghPrUrl)
+			return
+		}
+		if !found {
+			writeJsonError(w, logger, http.StatusNotFound, "PR "+ghPrUrl+" not found")
+			return
+		}
+
+		currentUser := getCurrentUsername(webConfig.Store)
+		response := prDetailV1{
+			Pr:      toPrV1(pr, points.StandardPrPoints(pr, currentUser, time.Now())),
+			Threads: make([]threadV1, 0),
+		}
+
+		for _, t := range pr.ReviewThreads {
+			response.Threads = append(response.Threads, toThreadV1(t))
+		}
+		if raw, _ := strconv.ParseBool(r.URL.Query().Get("raw")); raw && len(pr.RawJsonResponse) > 0 {
+			response.Raw = pr.RawJsonResponse
+		}
+
+		writeJson(w, logger, http.StatusOK, response)
+	})
+
+	mux.HandleFunc("POST /api/v1/prs/{id}/{action}", func(w http.ResponseWriter, r *http.Request) {
+		ghPrUrl, err := prUrlFromId(r.PathValue("id"))
+		if err != nil {
+			writeJsonError(w, logger, http.StatusBadRequest, "invalid PR ID")
+			return
+		}
+
+		var buryFunc func(string) error
+		switch action := r.PathValue("action"); action {
+		case "bury":
+			buryFunc = webConfig.Store.Bury
+		case "unbury":
+			buryFunc = webConfig.Store.Unbury
+		default:
+			writeJsonError(w, logger, http.StatusNotFound, "action '"+action+"' is not supported")
+			return
+		}
+
+		if err := buryFunc(ghPrUrl); err != nil {
+			logger.Error("could not toggle bury", slog.String("pr_url", ghPrUrl), slog.Any("error", err))
+			writeJsonError(w, logger, http.StatusInternalServerError, "couldn't toggle bury for PR "+ghPrUrl)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	mux.HandleFunc("PUT /api/v1/prs/{id}/note", func(w http.ResponseWriter, r *http.Request) {
+		ghPrUrl, err := prUrlFromId(r.PathValue("id"))
+		if err != nil {
+			writeJsonError(w, logger, http.StatusBadRequest, "invalid PR ID")
+			return
+		}
+
+		var note noteV1
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 2*types.MaxNoteBytes)).Decode(&note); err != nil {
+			writeJsonError(w, logger, http.StatusBadRequest, "invalid JSON: "+err.Error())
+			return
+		}
+		if err := types.ValidateNote(note.Text, note.Points); err != nil {
+			writeJsonError(w, logger, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		// an empty note is no note, which lets a client clear it with a PUT
+		if note.Text == "" && note.Points == 0 {
+			err = webConfig.Store.DeleteNote(ghPrUrl)
+		} else {
+			err = webConfig.Store.StoreNote(storage.StoredNote{PrUrl: ghPrUrl, Text: note.Text, Points: note.Points, UpdatedAt: time.Now()})
+		}
+		if err != nil {
+			logger.Error("could not store note", slog.String("pr_url", ghPrUrl), slog.Any("error", err))
+			writeJsonError(w, logger, http.StatusInternalServerError, "could not store the note of PR "+ghPrUrl)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	mux.HandleFunc("DELETE /api/v1/prs/{id}/note", func(w http.ResponseWriter, r *http.Request) {
+		ghPrUrl, err := prUrlFromId(r.PathValue("id"))
+		if err != nil {
+			writeJsonError(w, logger, http.StatusBadRequest, "invalid PR ID")
+			return
+		}
+
+		if err := webConfig.Store.DeleteNote(ghPrUrl); err != nil {
+			logger.Error("could not delete note", slog.String("pr_url", ghPrUrl), slog.Any("error", err))
+			writeJsonError(w, logger, http.StatusInternalServerError, "could not delete the note of PR "+ghPrUrl)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	// tagging a PR and tagging a repo only differ in what's tagged
+	handleTag := func(target func(r *http.Request) (storage.StoredTag, error), store func(storage.StoredTag) error) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			tag, err := target(r)
+			if err != nil {
+				writeJsonError(w, logger, http.StatusBadRequest, err.Error())
+				return
+			}
+			if tag.Tag, err = tagFromPath(r); err != nil {
+				writeJsonError(w, logger, http.StatusBadRequest, err.Error())
+				return
+			}
+			if err := store(tag); err != nil {
+				logger.Error("could not store tag", slog.String("tag", tag.Tag), slog.Any("error", err))
+				writeJsonError(w, logger, http.StatusInternalServerError, "could not store tag "+tag.Tag)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}
+	prTarget := func(r *http.Request) (storage.StoredTag, error) {
+		ghPrUrl, err := prUrlFromId(r.PathValue("id"))
+		if err != nil {
+			return storage.StoredTag{}, fmt.Errorf("invalid PR ID")
+		}
+		return storage.StoredTag{PrUrl: ghPrUrl}, nil
+	}
+	repoTarget := func(r *http.Request) (storage.StoredTag, error) {
+		// Github doesn't care about case, and neither should the tags
+		return storage.StoredTag{Repo: strings.ToLower(r.PathValue("owner") + "/" + r.PathValue("name"))}, nil
+	}
+	mux.HandleFunc("PUT /api/v1/prs/{id}/tags/{tag}", handleTag(prTarget, webConfig.Store.AddTag))
+	mux.HandleFunc("DELETE /api/v1/prs/{id}/tags/{tag}", handleTag(prTarget, webConfig.Store.RemoveTag))
+	mux.HandleFunc("PUT /api/v1/repos/{owner}/{name}/tags/{tag}", handleTag(repoTarget, webConfig.Store.AddTag))
+	mux.HandleFunc("DELETE /api/v1/repos/{owner}/{name}/tags/{tag}", handleTag(repoTarget, webConfig.Store.RemoveTag))
+
+	mux.HandleFunc("GET /api/v1/tags", func(w http.ResponseWriter, r *http.Request) {
+		tags, err := webConfig.Store.Tags()
+		if err != nil {
+			logger.Error("could not read tags", slog.Any("error", err))
+			writeJsonError(w, logger, http.StatusInternalServerError, "could not read tags")
+			return
+		}
+		pointsPerTag, err := webConfig.Store.TagPoints()
+		if err != nil {
+			logger.Error("could not read tag points", slog.Any("error", err))
+			writeJsonError(w, logger, http.StatusInternalServerError, "could not read tags")
+			return
+		}
+
+		// tags with points, but on nothing, are listed too
+		names := slices.Collect(maps.Keys(pointsPerTag))
+		for _, tag := range tags {
+			names = append(names, tag.Tag)
+		}
+		slices.Sort(names)
+		response := tagListV1{Tags: make([]tagSummaryV1, 0, len(names))}
+		for _, name := range slices.Compact(names) {
+			response.Tags = append(response.Tags, tagSummaryV1{Name: name, Points: pointsPerTag[name]})
+		}
+		writeJson(w, logger, http.StatusOK, response)
+	})
+
+	mux.HandleFunc("PUT /api/v1/tags/{tag}", func(w http.ResponseWriter, r *http.Request) {
+		tag, err := tagFromPath(r)
+		if err != nil {
+			writeJsonError(w, logger, http.StatusBadRequest, err.Error())
+			return
+		}
+		var body tagPointsV1
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1024)).Decode(&body); err != nil {
+			writeJsonError(w, logger, http.StatusBadRequest, "invalid JSON: "+err.Error())
+			return
+		}
+		if err := types.ValidatePoints(body.Points); err != nil {
+			writeJsonError(w, logger, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err := webConfig.Store.SetTagPoints(tag, body.Points); err != nil {
+			logger.Error("could not store tag points", slog.String("tag", tag), slog.Any("error", err))
+			writeJsonError(w, logger, http.StatusInternalServerError, "could not store the points of tag "+tag)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	mux.HandleFunc("GET /api/v1/rules", func(w http.ResponseWriter, r *http.Request) {
+		rules, err := webConfig.Store.Rules()
+		if err != nil {
+			logger.Error("could not read rules", slog.Any("error", err))
+			writeJsonError(w, logger, http.StatusInternalServerError, "could not read rules")
+			return
+		}
+		response := ruleListV1{Rules: make([]ruleV1, 0, len(rules))}
+		for _, rule := range rules {
+			response.Rules = append(response.Rules, ruleV1(rule))
+		}
+		writeJson(w, logger, http.StatusOK, response)
+	})
+
+	mux.HandleFunc("POST /api/v1/rules", func(w http.ResponseWriter, r *http.Request) {
+		var body ruleV1
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1024)).Decode(&body); err != nil {
+			writeJsonError(w, logger, http.StatusBadRequest, "invalid JSON: "+err.Error())
+			return
+		}
+		rule := types.Rule{Repo: strings.TrimSpace(body.Repo), Author: strings.TrimSpace(body.Author), Action: body.Action, Points: body.Points}
+		if err := rule.Validate(); err != nil {
+			writeJsonError(w, logger, http.StatusBadRequest, err.Error())
+			return
+		}
+		rule, err := webConfig.Store.AddRule(rule)
+		if err != nil {
+			logger.Error("could not add rule", slog.String("rule", rule.String()), slog.Any("error", err))
+			writeJsonError(w, logger, http.StatusInternalServerError, "could not add rule")
+			return
+		}
+		writeJson(w, logger, http.StatusCreated, ruleV1(rule))
+	})
+
+	mux.HandleFunc("DELETE /api/v1/rules/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			writeJsonError(w, logger, http.StatusBadRequest, "invalid rule ID")
+			return
+		}
+		if err := webConfig.Store.DeleteRule(id); err != nil {
+			logger.Error("could not delete rule", slog.Int64("id", id), slog.Any("error", err))
+			writeJsonError(w, logger, http.StatusInternalServerError, "could not delete rule")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	mux.HandleFunc("GET /api/v1/polling", func(w http.ResponseWriter, r *http.Request) {
+		if webConfig.Tracker == nil {
+			writeJsonError(w, logger, http.StatusServiceUnavailable, "not polling Github")
+			return
+		}
+		decision := webConfig.Tracker.Decision()
+		writeJson(w, logger, http.StatusOK, pollingV1{
+			NextPollAt:      decision.NextPollAt,
+			IntervalSeconds: int(decision.Interval.Seconds()),
+			Reason:          decision.Reason,
+			NeedsAttention:  webConfig.Tracker.Attention(),
+		})
+	})
+
+	mux.HandleFunc("GET /api/v1/status", func(w http.ResponseWriter, r *http.Request) {
+		pat, found, err := webConfig.Store.GetPAT()
+		if err != nil {
+			logger.Error("could not read PAT", slog.Any("error", err))
+			writeJsonError(w, logger, http.StatusInternalServerError, "could not read the PAT")
+			return
+		}
+		status := statusV1{Configured: found}
+		if found {
+			now := time.Now()
+			status.Username = pat.Username
+			status.ExpiresSoon = pat.ExpiresSoon(now)
+			if days, expires := pat.ExpiresInDays(now); expires {
+				status.ExpiresAt = &pat.ExpiresAt
+				status.ExpiresInDays = &days
+			}
+		}
+		writeJson(w, logger, http.StatusOK, status)
+	})
+
+	// Anything else under v1 is a JSON 404, instead of falling through to the
+	// GUI's catch-all route.
+	notFound := func(w http.ResponseWriter, r *http.Request) {
+		writeJsonError(w, logger, http.StatusNotFound, "no such endpoint: "+r.Method+" "+r.URL.Path)
+	}
+	mux.HandleFunc("GET /api/v1/", notFound)
+	mux.HandleFunc("POST /api/v1/", notFound)
+	mux.HandleFunc("PUT /api/v1/", notFound)
+	mux.HandleFunc("DELETE /api/v1/", notFound)
+}
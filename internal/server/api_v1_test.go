@@ -0,0 +1,528 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chelmertz/elly/internal/backoff"
+	"github.com/chelmertz/elly/internal/storage"
+	"github.com/chelmertz/elly/internal/types"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+type openApiSchema struct {
+	Required   []string
+	Properties map[string]json.RawMessage
+}
+
+func loadOpenApiSchemas(t *testing.T) map[string]openApiSchema {
+	t.Helper()
+	var doc struct {
+		Components struct {
+			Schemas map[string]openApiSchema
+		}
+	}
+	if err := json.Unmarshal(openApiV1, &doc); err != nil {
+		t.Fatalf("openapi.json is not valid json: %v", err)
+	}
+	return doc.Components.Schemas
+}
+
+// jsonFieldNames returns all json names of typ's fields, and the ones that are
+// always present (i.e. not omitempty).
+func jsonFieldNames(typ reflect.Type) (all []string, required []string) {
+	for i := range typ.NumField() {
+		name, options, _ := strings.Cut(typ.Field(i).Tag.Get("json"), ",")
+		all = append(all, name)
+		if options != "omitempty" {
+			required = append(required, name)
+		}
+	}
+	slices.Sort(all)
+	slices.Sort(required)
+	return all, required
+}
+
+func testServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(newMux(HttpServerConfig{
+		Store:  storage.NewStorageDemo(),
+		Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func getJson(t *testing.T, url string, wantStatus int) []byte {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("reading body of %s: %v", url, err)
+	}
+	if resp.StatusCode != wantStatus {
+		t.Fatalf("GET %s: got status %d, want %d, body: %s", url, resp.StatusCode, wantStatus, body)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("GET %s: got content type %q, want application/json", url, ct)
+	}
+	return body
+}
+
+// The DTOs and the OpenAPI document must describe the same fields, if this
+// fails: you changed the v1 contract.
+func TestOpenApiSchemasMatchDtos(t *testing.T) {
+	schemas := loadOpenApiSchemas(t)
+
+	dtos := map[string]reflect.Type{
+		"PrList":     reflect.TypeFor[prListV1](),
+		"PrGroup":    reflect.TypeFor[prGroupV1](),
+		"Pr":         reflect.TypeFor[prV1](),
+		"PrDetail":   reflect.TypeFor[prDetailV1](),
+		"Thread":     reflect.TypeFor[threadV1](),
+		"Points":     reflect.TypeFor[pointsV1](),
+		"Reason":     reflect.TypeFor[reasonV1](),
+		"Note":       reflect.TypeFor[noteV1](),
+		"Tag":        reflect.TypeFor[tagV1](),
+		"TagList":    reflect.TypeFor[tagListV1](),
+		"TagSummary": reflect.TypeFor[tagSummaryV1](),
+		"TagPoints":  reflect.TypeFor[tagPointsV1](),
+		"Rule":       reflect.TypeFor[ruleV1](),
+		"RuleList":   reflect.TypeFor[ruleListV1](),
+		"Polling":    reflect.TypeFor[pollingV1](),
+		"Status":     reflect.TypeFor[statusV1](),
+		"Error":      reflect.TypeFor[errorV1](),
+	}
+
+	for name, typ := range dtos {
+		t.Run(name, func(t *testing.T) {
+			schema, ok := schemas[name]
+			if !ok {
+				t.Fatalf("schema %s is missing from openapi.json", name)
+			}
+
+			properties := make([]string, 0, len(schema.Properties))
+			for p := range schema.Properties {
+				properties = append(properties, p)
+			}
+			slices.Sort(properties)
+			required := slices.Sorted(slices.Values(schema.Required))
+
+			wantProperties, wantRequired := jsonFieldNames(typ)
+			if diff := cmp.Diff(wantProperties, properties); diff != "" {
+				t.Errorf("schema %s properties mismatch (-dto +openapi):\n%s", name, diff)
+			}
+			if diff := cmp.Diff(wantRequired, required); diff != "" {
+				t.Errorf("schema %s required mismatch (-dto +openapi):\n%s", name, diff)
+			}
+		})
+	}
+}
+
+func TestApiV1Prs_ResponseMatchesSchema(t *testing.T) {
+	schemas := loadOpenApiSchemas(t)
+	srv := testServer(t)
+
+	var response map[string][]map[string]any
+	if err := json.Unmarshal(getJson(t, srv.URL+"/api/v1/prs", http.StatusOK), &response); err != nil {
+		t.Fatalf("could not unmarshal response: %v", err)
+	}
+
+	prs := response["prs"]
+	if len(prs) == 0 {
+		t.Fatal("expected the demo storage to return prs")
+	}
+
+	wantKeys := slices.Sorted(slices.Values(schemas["Pr"].Required))
+	for _, pr := range prs {
+		gotKeys := make([]string, 0, len(pr))
+		for k := range pr {
+			gotKeys = append(gotKeys, k)
+		}
+		slices.Sort(gotKeys)
+		if diff := cmp.Diff(wantKeys, gotKeys); diff != "" {
+			t.Errorf("pr %v keys mismatch (-openapi +response):\n%s", pr["url"], diff)
+		}
+		if _, isRaw := pr["RawJsonResponse"]; isRaw {
+			t.Errorf("pr %v leaks the raw github response", pr["url"])
+		}
+	}
+
+	var lastTotal float64 = 1 << 20
+	for _, pr := range prs {
+		total := pr["points"].(map[string]any)["total"].(float64)
+		if total > lastTotal {
+			t.Errorf("prs are not sorted by points, %v came after %v", total, lastTotal)
+		}
+		lastTotal = total
+	}
+}
+
+func TestApiV1Prs_MinPoints(t *testing.T) {
+	srv := testServer(t)
+
+	var response prListV1
+	if err := json.Unmarshal(getJson(t, srv.URL+"/api/v1/prs?minPoints=1", http.StatusOK), &response); err != nil {
+		t.Fatalf("could not unmarshal response: %v", err)
+	}
+	for _, pr := range response.Prs {
+		if pr.Points.Total < 1 {
+			t.Errorf("got pr %s with %d points, want >= 1", pr.Url, pr.Points.Total)
+		}
+	}
+}
+
+func TestApiV1Prs_GroupBy(t *testing.T) {
+	srv := testServer(t)
+
+	var response prListV1
+	if err := json.Unmarshal(getJson(t, srv.URL+"/api/v1/prs?groupBy=author", http.StatusOK), &response); err != nil {
+		t.Fatalf("could not unmarshal response: %v", err)
+	}
+	if len(response.Groups) == 0 {
+		t.Fatal("expected groups when grouping")
+	}
+	grouped := 0
+	for _, g := range response.Groups {
+		for _, pr := range g.Prs {
+			if pr.Author != g.Key {
+				t.Errorf("pr by %s ended up in group %s", pr.Author, g.Key)
+			}
+			grouped++
+		}
+	}
+	if grouped != len(response.Prs) {
+		t.Errorf("got %d grouped prs, want all %d prs", grouped, len(response.Prs))
+	}
+}
+
+func TestApiV1Pr_Detail(t *testing.T) {
+	srv := testServer(t)
+
+	var list prListV1
+	if err := json.Unmarshal(getJson(t, srv.URL+"/api/v1/prs", http.StatusOK), &list); err != nil {
+		t.Fatalf("could not unmarshal response: %v", err)
+	}
+	want := list.Prs[0]
+
+	var detail prDetailV1
+	if err := json.Unmarshal(getJson(t, srv.URL+"/api/v1/prs/"+url.PathEscape(want.Id), http.StatusOK), &detail); err != nil {
+		t.Fatalf("could not unmarshal response: %v", err)
+	}
+	// the demo storage makes up a new LastUpdated on every call
+	if diff := cmp.Diff(want, detail.Pr, cmpopts.IgnoreFields(prV1{}, "LastUpdated")); diff != "" {
+		t.Errorf("detail and list disagree on the PR (-list +detail):\n%s", diff)
+	}
+	if detail.Threads == nil {
+		t.Error("expected threads to be an empty list, not null")
+	}
+
+	getJson(t, srv.URL+"/api/v1/prs/"+url.PathEscape(types.ViewPr{Url: "nope"}.Id()), http.StatusNotFound)
+}
+
+func TestApiV1_ErrorsAreJson(t *testing.T) {
+	srv := testServer(t)
+
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{"/api/v1/prs?minPoints=lots", http.StatusBadRequest},
+		{"/api/v1/prs?groupBy=label", http.StatusBadRequest},
+		{"/api/v1/nope", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			var response errorV1
+			if err := json.Unmarshal(getJson(t, srv.URL+tt.path, tt.status), &response); err != nil {
+				t.Fatalf("could not unmarshal error response: %v", err)
+			}
+			if response.Error == "" {
+				t.Error("expected an error message")
+			}
+		})
+	}
+}
+
+func TestApiV1_ServesOpenApi(t *testing.T) {
+	srv := testServer(t)
+
+	var doc map[string]any
+	if err := json.Unmarshal(getJson(t, srv.URL+"/api/v1/openapi.json", http.StatusOK), &doc); err != nil {
+		t.Fatalf("could not unmarshal openapi document: %v", err)
+	}
+	if doc["openapi"] == nil {
+		t.Error("expected an openapi version in the document")
+	}
+}
+
+func TestApiV1Pr_Note(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	store := storage.NewMemoryStorage(logger)
+	pr := types.ViewPr{Url: "https://github.com/o/r/pull/1", Title: "Waiting", Author: "you", LastUpdated: time.Now()}
+	if err := store.StoreRepoPrs([]types.ViewPr{pr}); err != nil {
+		t.Fatalf("StoreRepoPrs failed: %v", err)
+	}
+	srv := httptest.NewServer(newMux(HttpServerConfig{Store: store, Logger: logger}))
+	defer srv.Close()
+	noteUrl := srv.URL + "/api/v1/prs/" + url.PathEscape(pr.Id()) + "/note"
+
+	send := func(method, body string, wantStatus int) {
+		t.Helper()
+		req, err := http.NewRequest(method, noteUrl, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != wantStatus {
+			t.Fatalf("%s %s: got status %d, want %d", method, body, resp.StatusCode, wantStatus)
+		}
+	}
+	detail := func() prDetailV1 {
+		t.Helper()
+		var detail prDetailV1
+		if err := json.Unmarshal(getJson(t, srv.URL+"/api/v1/prs/"+url.PathEscape(pr.Id()), http.StatusOK), &detail); err != nil {
+			t.Fatalf("could not unmarshal response: %v", err)
+		}
+		return detail
+	}
+
+	send(http.MethodPut, `{"text": "after the release", "points": -30}`, http.StatusNoContent)
+	got := detail().Pr
+	if got.Note == nil || *got.Note != (noteV1{Text: "after the release", Points: -30}) {
+		t.Fatalf("expected the note to be returned, got %+v", got.Note)
+	}
+	if !slices.Contains(got.Points.Reasons, reasonV1{Points: -30, Description: "Note: after the release"}) {
+		t.Errorf("expected the note to be a reason, got %+v", got.Points.Reasons)
+	}
+
+	send(http.MethodPut, `{"text": "x", "points": 1000}`, http.StatusBadRequest)
+	send(http.MethodPut, `{"text": "`+strings.Repeat("x", types.MaxNoteBytes+1)+`"}`, http.StatusBadRequest)
+	send(http.MethodPut, `not json`, http.StatusBadRequest)
+
+	send(http.MethodDelete, "", http.StatusNoContent)
+	if got := detail().Pr; got.Note != nil {
+		t.Errorf("expected the note to be deleted, got %+v", got.Note)
+	}
+}
+
+func TestApiV1_Tags(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	store := storage.NewMemoryStorage(logger)
+	pr := types.ViewPr{Url: "https://github.com/o/r/pull/1", Title: "Blocking", Author: "you", RepoOwner: "o", RepoName: "r", LastUpdated: time.Now()}
+	if err := store.StoreRepoPrs([]types.ViewPr{pr}); err != nil {
+		t.Fatalf("StoreRepoPrs failed: %v", err)
+	}
+	srv := httptest.NewServer(newMux(HttpServerConfig{Store: store, Logger: logger}))
+	defer srv.Close()
+
+	send := func(method, path, body string, wantStatus int) {
+		t.Helper()
+		req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != wantStatus {
+			t.Fatalf("%s %s: got status %d, want %d", method, path, resp.StatusCode, wantStatus)
+		}
+	}
+	prTags := "/api/v1/prs/" + url.PathEscape(pr.Id()) + "/tags/"
+
+	send(http.MethodPut, prTags+"Release-Blocker", "", http.StatusNoContent)
+	send(http.MethodPut, "/api/v1/repos/O/R/tags/learning", "", http.StatusNoContent)
+	send(http.MethodPut, "/api/v1/tags/release-blocker", `{"points": 200}`, http.StatusNoContent)
+	send(http.MethodPut, prTags+"no%20spaces", "", http.StatusBadRequest)
+	send(http.MethodPut, "/api/v1/tags/release-blocker", `{"points": 1000}`, http.StatusBadRequest)
+
+	var list prListV1
+	if err := json.Unmarshal(getJson(t, srv.URL+"/api/v1/prs?tag=release-blocker", http.StatusOK), &list); err != nil {
+		t.Fatalf("could not unmarshal response: %v", err)
+	}
+	if len(list.Prs) != 1 {
+		t.Fatalf("expected the tagged PR, got %+v", list.Prs)
+	}
+	wantTags := []tagV1{{Name: "learning", OnRepo: true}, {Name: "release-blocker", Points: 200}}
+	if diff := cmp.Diff(wantTags, list.Prs[0].Tags); diff != "" {
+		t.Errorf("tags mismatch (-want +got):\n%s", diff)
+	}
+	if !slices.Contains(list.Prs[0].Points.Reasons, reasonV1{Points: 200, Description: "tagged release-blocker"}) {
+		t.Errorf("expected the tag to be a reason, got %+v", list.Prs[0].Points.Reasons)
+	}
+
+	var tags tagListV1
+	if err := json.Unmarshal(getJson(t, srv.URL+"/api/v1/tags", http.StatusOK), &tags); err != nil {
+		t.Fatalf("could not unmarshal response: %v", err)
+	}
+	wantSummaries := []tagSummaryV1{{Name: "learning"}, {Name: "release-blocker", Points: 200}}
+	if diff := cmp.Diff(wantSummaries, tags.Tags); diff != "" {
+		t.Errorf("tag list mismatch (-want +got):\n%s", diff)
+	}
+
+	send(http.MethodDelete, prTags+"release-blocker", "", http.StatusNoContent)
+	send(http.MethodDelete, "/api/v1/repos/o/r/tags/learning", "", http.StatusNoContent)
+	if err := json.Unmarshal(getJson(t, srv.URL+"/api/v1/prs?tag=release-blocker", http.StatusOK), &list); err != nil {
+		t.Fatalf("could not unmarshal response: %v", err)
+	}
+	if len(list.Prs) != 0 {
+		t.Errorf("expected the tag to be removed, got %+v", list.Prs)
+	}
+}
+
+func TestApiV1_Rules(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	store := storage.NewMemoryStorage(logger)
+	now := time.Now()
+	prs := []types.ViewPr{
+		{Url: "https://github.com/acme/core/pull/1", Title: "Feature", Author: "you", RepoOwner: "acme", RepoName: "core", LastUpdated: now},
+		{Url: "https://github.com/acme/core/pull/2", Title: "Bump", Author: "dependabot[bot]", RepoOwner: "acme", RepoName: "core", LastUpdated: now},
+	}
+	if err := store.StoreRepoPrs(prs); err != nil {
+		t.Fatalf("StoreRepoPrs failed: %v", err)
+	}
+	srv := httptest.NewServer(newMux(HttpServerConfig{Store: store, Logger: logger}))
+	defer srv.Close()
+
+	send := func(method, path, body string, wantStatus int) []byte {
+		t.Helper()
+		req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != wantStatus {
+			t.Fatalf("%s %s: got status %d, want %d", method, path, resp.StatusCode, wantStatus)
+		}
+		b, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	var excluding ruleV1
+	if err := json.Unmarshal(send(http.MethodPost, "/api/v1/rules", `{"author": "*[bot]", "action": "exclude"}`, http.StatusCreated), &excluding); err != nil {
+		t.Fatalf("could not unmarshal response: %v", err)
+	}
+	send(http.MethodPost, "/api/v1/rules", `{"repo": "acme/*", "action": "points", "points": 50}`, http.StatusCreated)
+	send(http.MethodPost, "/api/v1/rules", `{"action": "exclude"}`, http.StatusBadRequest)
+	send(http.MethodPost, "/api/v1/rules", `{"repo": "acme/*", "action": "points", "points": 1000}`, http.StatusBadRequest)
+	send(http.MethodDelete, "/api/v1/rules/nope", "", http.StatusBadRequest)
+
+	var rules ruleListV1
+	if err := json.Unmarshal(send(http.MethodGet, "/api/v1/rules", "", http.StatusOK), &rules); err != nil {
+		t.Fatalf("could not unmarshal response: %v", err)
+	}
+	wantRules := []ruleV1{
+		{Id: excluding.Id, Author: "*[bot]", Action: "exclude"},
+		{Id: excluding.Id + 1, Repo: "acme/*", Action: "points", Points: 50},
+	}
+	if diff := cmp.Diff(wantRules, rules.Rules); diff != "" {
+		t.Errorf("rules mismatch (-want +got):\n%s", diff)
+	}
+
+	var list prListV1
+	if err := json.Unmarshal(getJson(t, srv.URL+"/api/v1/prs", http.StatusOK), &list); err != nil {
+		t.Fatalf("could not unmarshal response: %v", err)
+	}
+	if len(list.Prs) != 1 || list.Prs[0].Url != prs[0].Url {
+		t.Fatalf("expected only the PR by a human, got %+v", list.Prs)
+	}
+	if !slices.Contains(list.Prs[0].Points.Reasons, reasonV1{Points: 50, Description: "rule for repo acme/*"}) {
+		t.Errorf("expected the rule to be a reason, got %+v", list.Prs[0].Points.Reasons)
+	}
+
+	send(http.MethodDelete, "/api/v1/rules/"+strconv.FormatInt(excluding.Id, 10), "", http.StatusNoContent)
+	if err := json.Unmarshal(getJson(t, srv.URL+"/api/v1/prs", http.StatusOK), &list); err != nil {
+		t.Fatalf("could not unmarshal response: %v", err)
+	}
+	if len(list.Prs) != 2 {
+		t.Errorf("expected the bot's PR once the rule is gone, got %+v", list.Prs)
+	}
+}
+
+func TestApiV1_Polling(t *testing.T) {
+	getJson(t, testServer(t).URL+"/api/v1/polling", http.StatusServiceUnavailable)
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	tracker := backoff.New(logger, time.Hour, backoff.Schedule{}, types.BackoffState{})
+	defer tracker.Stop()
+	srv := httptest.NewServer(newMux(HttpServerConfig{Store: storage.NewStorageDemo(), Logger: logger, Tracker: tracker}))
+	defer srv.Close()
+
+	var got pollingV1
+	if err := json.Unmarshal(getJson(t, srv.URL+"/api/v1/polling", http.StatusOK), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Reason != backoff.ReasonBaseInterval || got.IntervalSeconds != 3600 {
+		t.Errorf("expected the base interval, got %+v", got)
+	}
+	tracker.NeedsAttention("github response code 403")
+	if err := json.Unmarshal(getJson(t, srv.URL+"/api/v1/polling", http.StatusOK), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Reason != backoff.ReasonNeedsAttention || got.NeedsAttention != "github response code 403" {
+		t.Errorf("expected polling to need attention, got %+v", got)
+	}
+}
+
+func TestApiV1_Status(t *testing.T) {
+	var got statusV1
+	if err := json.Unmarshal(getJson(t, testServer(t).URL+"/api/v1/status", http.StatusOK), &got); err != nil {
+		t.Fatal(err)
+	}
+	// the demo's PAT expires in 30 days, from when it's read
+	if !got.Configured || got.Username != "demo-user" || got.ExpiresInDays == nil || *got.ExpiresInDays < 29 || got.ExpiresSoon {
+		t.Errorf("expected the demo's PAT, got %+v", got)
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	store := storage.NewMemoryStorage(logger)
+	srv := httptest.NewServer(newMux(HttpServerConfig{Store: store, Logger: logger}))
+	defer srv.Close()
+	got = statusV1{}
+	if err := json.Unmarshal(getJson(t, srv.URL+"/api/v1/status", http.StatusOK), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Configured || got.ExpiresInDays != nil {
+		t.Errorf("expected no PAT, got %+v", got)
+	}
+
+	if err := store.StorePAT("token", "me", time.Now().Add(3*24*time.Hour+time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(getJson(t, srv.URL+"/api/v1/status", http.StatusOK), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.ExpiresInDays == nil || *got.ExpiresInDays != 3 || !got.ExpiresSoon {
+		t.Errorf("expected a PAT expiring in 3 days, got %+v", got)
+	}
+}
@@ -0,0 +1,165 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// AuthMode decides which requests need to present the API token. elly is
+// meant to be run locally (see ADR-0002), so authentication is opt-in for
+// when it is reachable by others, e.g. through Docker's published port.
+type AuthMode string
+
+const (
+	AuthNone     AuthMode = "none"
+	AuthMutating AuthMode = "mutating" // everything but GET and HEAD
+	AuthAll      AuthMode = "all"
+)
+
+func ParseAuthMode(s string) (AuthMode, error) {
+	switch mode := AuthMode(s); mode {
+	case AuthNone, AuthMutating, AuthAll:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown auth mode %q, must be one of none, mutating or all", s)
+}
+
+type AuthConfig struct {
+	Mode  AuthMode
+	Token string
+	// PublicHealth keeps GET /health unauthenticated with AuthAll, for
+	// health checks by Docker, systemd etc.
+	PublicHealth bool
+}
+
+const sessionCookie = "elly_session"
+
+// privateGets need the API token with AuthMutating, even though they are
+// GETs: they spend the PAT's requests, and tell things about it.
+var privateGets = []string{"/api/v0/config/pat/diagnosis"}
+
+//go:embed login.html
+var loginHtml embed.FS
+
+func (a AuthConfig) enabled() bool {
+	return a.Mode == AuthMutating || a.Mode == AuthAll
+}
+
+func (a AuthConfig) required(r *http.Request) bool {
+	if r.URL.Path == "/login" || r.URL.Path == "/logout" {
+		return false
+	}
+	switch a.Mode {
+	case AuthAll:
+		return !(a.PublicHealth && r.URL.Path == "/health")
+	case AuthMutating:
+		return (r.Method != http.MethodGet && r.Method != http.MethodHead) || slices.Contains(privateGets, r.URL.Path)
+	}
+	return false
+}
+
+func (a AuthConfig) validToken(token string) bool {
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(a.Token)) == 1
+}
+
+// session is the value of the session cookie. It's derived from the token,
+// so that sessions survive restarts, without the cookie being the token:
+// a leaked cookie can't be used as a bearer token.
+func (a AuthConfig) session() string {
+	mac := hmac.New(sha256.New, []byte(a.Token))
+	mac.Write([]byte(sessionCookie)) //nolint:errcheck // never fails
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// authenticated accepts the token as a bearer token (for scripts), or the
+// session cookie set by the login page (for the GUI).
+func (a AuthConfig) authenticated(r *http.Request) bool {
+	if bearer, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); found {
+		return a.validToken(bearer)
+	}
+	if cookie, err := r.Cookie(sessionCookie); err == nil {
+		return a.Token != "" && hmac.Equal([]byte(cookie.Value), []byte(a.session()))
+	}
+	return false
+}
+
+func withAuth(auth AuthConfig, logger *slog.Logger, next http.Handler) http.Handler {
+	if !auth.enabled() {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !auth.required(r) || auth.authenticated(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		logger.Debug("unauthenticated request", slog.String("method", r.Method), slog.String("path", r.URL.Path))
+		isGui := r.Method == http.MethodGet && !strings.HasPrefix(r.URL.Path, "/api/") && r.URL.Path != "/metrics"
+		if isGui {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		w.Header().Set("WWW-Authenticate", `Bearer realm="elly"`)
+		writeJsonError(w, logger, http.StatusUnauthorized, "authentication required, log in or send the API token as a bearer token")
+	})
+}
+
+func registerAuth(mux *http.ServeMux, webConfig HttpServerConfig) {
+	if !webConfig.Auth.enabled() {
+		return
+	}
+
+	temp := template.Must(template.ParseFS(loginHtml, "login.html"))
+
+	renderLogin := func(w http.ResponseWriter, status int, loginError string) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(status)
+		if err := temp.Execute(w, struct{ Error string }{Error: loginError}); err != nil {
+			webConfig.Logger.Error("could not render login page", slog.Any("error", err))
+		}
+	}
+
+	mux.HandleFunc("GET /login", func(w http.ResponseWriter, r *http.Request) {
+		renderLogin(w, http.StatusOK, "")
+	})
+
+	mux.HandleFunc("POST /login", func(w http.ResponseWriter, r *http.Request) {
+		if !webConfig.Auth.validToken(r.PostFormValue("token")) {
+			webConfig.Logger.Warn("failed login attempt", slog.String("remote_addr", r.RemoteAddr))
+			renderLogin(w, http.StatusUnauthorized, "Wrong token")
+			return
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     sessionCookie,
+			Value:    webConfig.Auth.session(),
+			Path:     "/",
+			Expires:  time.Now().Add(30 * 24 * time.Hour),
+			HttpOnly: true,
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteStrictMode,
+		})
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+	})
+
+	mux.HandleFunc("POST /logout", func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{
+			Name:     sessionCookie,
+			Value:    "",
+			Path:     "/",
+			MaxAge:   -1,
+			HttpOnly: true,
+			SameSite: http.SameSiteStrictMode,
+		})
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+	})
+}
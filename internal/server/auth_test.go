@@ -0,0 +1,186 @@
+package server
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/chelmertz/elly/internal/storage"
+)
+
+const testToken = "s3cret"
+
+func testAuthServer(t *testing.T, auth AuthConfig) *httptest.Server {
+	t.Helper()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	mux := newMux(HttpServerConfig{
+		Store:  storage.NewStorageDemo(),
+		Logger: logger,
+		Auth:   auth,
+	})
+	srv := httptest.NewServer(http.NewCrossOriginProtection().Handler(withAuth(auth, logger, mux)))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// noRedirects lets the tests look at the redirects themselves.
+var noRedirects = &http.Client{
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+func do(t *testing.T, req *http.Request) *http.Response {
+	t.Helper()
+	resp, err := noRedirects.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", req.Method, req.URL, err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func newRequest(t *testing.T, method, url, bearer string) *http.Request {
+	t.Helper()
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	return req
+}
+
+func TestParseAuthMode(t *testing.T) {
+	for _, valid := range []string{"none", "mutating", "all"} {
+		if _, err := ParseAuthMode(valid); err != nil {
+			t.Errorf("ParseAuthMode(%q): %v", valid, err)
+		}
+	}
+	if _, err := ParseAuthMode("some"); err == nil {
+		t.Error("expected an error for an unknown mode")
+	}
+}
+
+func TestAuth_Mutating(t *testing.T) {
+	srv := testAuthServer(t, AuthConfig{Mode: AuthMutating, Token: testToken})
+	unburyUrl := srv.URL + "/api/v1/prs/" + url.PathEscape("aHR0cHM6Ly9naXRodWIuY29tL2EvYi9wdWxsLzE=") + "/unbury"
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		bearer string
+		want   int
+	}{
+		{"reading is public", http.MethodGet, srv.URL + "/api/v1/prs", "", http.StatusOK},
+		{"mutating needs a token", http.MethodPost, unburyUrl, "", http.StatusUnauthorized},
+		{"mutating with the wrong token", http.MethodPost, unburyUrl, "wrong", http.StatusUnauthorized},
+		{"mutating with the token", http.MethodPost, unburyUrl, testToken, http.StatusNoContent},
+		{"clearing the PAT needs a token", http.MethodDelete, srv.URL + "/api/v0/config/pat", "", http.StatusUnauthorized},
+		{"diagnosing the PAT needs a token", http.MethodGet, srv.URL + "/api/v0/config/pat/diagnosis", "", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := do(t, newRequest(t, tt.method, tt.path, tt.bearer))
+			if resp.StatusCode != tt.want {
+				t.Errorf("got status %d, want %d", resp.StatusCode, tt.want)
+			}
+			if resp.StatusCode == http.StatusUnauthorized && resp.Header.Get("WWW-Authenticate") == "" {
+				t.Error("expected a WWW-Authenticate header")
+			}
+		})
+	}
+}
+
+func TestAuth_All(t *testing.T) {
+	tests := []struct {
+		name   string
+		auth   AuthConfig
+		path   string
+		bearer string
+		want   int
+	}{
+		{"gui redirects to login", AuthConfig{Mode: AuthAll, Token: testToken}, "/", "", http.StatusSeeOther},
+		{"api is unauthorized", AuthConfig{Mode: AuthAll, Token: testToken}, "/api/v1/prs", "", http.StatusUnauthorized},
+		{"api with the token", AuthConfig{Mode: AuthAll, Token: testToken}, "/api/v1/prs", testToken, http.StatusOK},
+		{"login page is public", AuthConfig{Mode: AuthAll, Token: testToken}, "/login", "", http.StatusOK},
+		{"health can be public", AuthConfig{Mode: AuthAll, Token: testToken, PublicHealth: true}, "/health", "", http.StatusOK},
+		{"health can be private", AuthConfig{Mode: AuthAll, Token: testToken}, "/health", "", http.StatusSeeOther},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := testAuthServer(t, tt.auth)
+			resp := do(t, newRequest(t, http.MethodGet, srv.URL+tt.path, tt.bearer))
+			if resp.StatusCode != tt.want {
+				t.Errorf("got status %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuth_LoginSetsSessionCookie(t *testing.T) {
+	srv := testAuthServer(t, AuthConfig{Mode: AuthAll, Token: testToken})
+
+	login := func(token string) *http.Response {
+		req, err := http.NewRequest(http.MethodPost, srv.URL+"/login", strings.NewReader(url.Values{"token": {token}}.Encode()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return do(t, req)
+	}
+
+	if resp := login("wrong"); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("got status %d for the wrong token, want %d", resp.StatusCode, http.StatusUnauthorized)
+	}
+
+	resp := login(testToken)
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("got status %d, want %d", resp.StatusCode, http.StatusSeeOther)
+	}
+	var session *http.Cookie
+	for _, c := range resp.Cookies() {
+		if c.Name == sessionCookie {
+			session = c
+		}
+	}
+	if session == nil || !session.HttpOnly {
+		t.Fatalf("expected an http only session cookie, got %v", resp.Cookies())
+	}
+	if session.Value == testToken {
+		t.Error("the session cookie must not be the API token")
+	}
+	// nor can it be used as one
+	if resp := do(t, newRequest(t, http.MethodGet, srv.URL+"/api/v1/prs", session.Value)); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("got status %d with the session as a bearer token, want %d", resp.StatusCode, http.StatusUnauthorized)
+	}
+	forged := newRequest(t, http.MethodGet, srv.URL+"/api/v1/prs", "")
+	forged.AddCookie(&http.Cookie{Name: sessionCookie, Value: testToken})
+	if resp := do(t, forged); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("got status %d with the token as the session cookie, want %d", resp.StatusCode, http.StatusUnauthorized)
+	}
+
+	req := newRequest(t, http.MethodGet, srv.URL+"/", "")
+	req.AddCookie(session)
+	if resp := do(t, req); resp.StatusCode != http.StatusOK {
+		t.Errorf("got status %d with the session cookie, want %d", resp.StatusCode, http.StatusOK)
+	}
+}
+
+func TestAuth_RejectsCrossOriginPosts(t *testing.T) {
+	srv := testAuthServer(t, AuthConfig{Mode: AuthMutating, Token: testToken})
+
+	req := newRequest(t, http.MethodPost, srv.URL+"/api/v1/prs/aHR0cHM6Ly9naXRodWIuY29tL2EvYi9wdWxsLzE%3D/bury", testToken)
+	req.Header.Set("Sec-Fetch-Site", "cross-site")
+	if resp := do(t, req); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("got status %d, want %d", resp.StatusCode, http.StatusForbidden)
+	}
+}
@@ -0,0 +1,186 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// ListenConfig decides where and how the web server listens. Without any of
+// the fields set, it listens on HttpServerConfig.Url over plain HTTP.
+type ListenConfig struct {
+	// TLSCert and TLSKey are paths to a PEM encoded certificate and key.
+	TLSCert string
+	TLSKey  string
+	// TLSSelfSignedDir, if set and TLSCert isn't, is where a self-signed
+	// certificate is generated on first run and then reused.
+	TLSSelfSignedDir string
+
+	// UnixSocket is the path to a Unix domain socket to listen on instead
+	// of a TCP address.
+	UnixSocket     string
+	UnixSocketMode fs.FileMode
+}
+
+func (c ListenConfig) tls() bool {
+	return c.TLSCert != "" || c.TLSSelfSignedDir != ""
+}
+
+// systemd passes sockets starting at this file descriptor, see sd_listen_fds(3).
+const systemdFirstFd = 3
+
+// systemdListener returns the socket passed by systemd socket activation, or
+// nil if elly wasn't socket activated.
+func systemdListener() (net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	fds, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || fds < 1 {
+		return nil, nil
+	}
+	if fds > 1 {
+		return nil, fmt.Errorf("got %d sockets from systemd, expected 1", fds)
+	}
+
+	// don't pass the sockets on to any child processes
+	os.Unsetenv("LISTEN_PID")     //nolint:errcheck // best-effort cleanup
+	os.Unsetenv("LISTEN_FDS")     //nolint:errcheck // best-effort cleanup
+	os.Unsetenv("LISTEN_FDNAMES") //nolint:errcheck // best-effort cleanup
+
+	f := os.NewFile(uintptr(systemdFirstFd), "systemd-socket")
+	// the listener has its own copy of the file descriptor
+	defer f.Close() //nolint:errcheck // error on close is not actionable
+	l, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("could not use the socket from systemd: %w", err)
+	}
+	return l, nil
+}
+
+func listenUnix(path string, mode fs.FileMode) (net.Listener, error) {
+	// a socket file left behind by a crash would make Listen fail
+	if info, err := os.Stat(path); err == nil && info.Mode().Type() == fs.ModeSocket {
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("could not remove stale socket: %w", err)
+		}
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		l.Close() //nolint:errcheck // the chmod error is more interesting
+		return nil, fmt.Errorf("could not set mode of socket: %w", err)
+	}
+	return l, nil
+}
+
+// listen returns the listener to serve on, and a description of it for logging.
+func listen(url string, c ListenConfig) (net.Listener, string, error) {
+	scheme := "http"
+	if c.tls() {
+		scheme = "https"
+	}
+
+	l, err := systemdListener()
+	if err != nil {
+		return nil, "", err
+	}
+	if l != nil {
+		return l, scheme + "://" + l.Addr().String() + " (systemd socket)", nil
+	}
+
+	if c.UnixSocket != "" {
+		l, err := listenUnix(c.UnixSocket, c.UnixSocketMode)
+		if err != nil {
+			return nil, "", err
+		}
+		return l, scheme + " on unix:" + c.UnixSocket, nil
+	}
+
+	l, err = net.Listen("tcp", url)
+	if err != nil {
+		return nil, "", err
+	}
+	return l, scheme + "://" + url, nil
+}
+
+// certificate returns the paths to the certificate and key to serve TLS with,
+// generating a self-signed pair if needed.
+func (c ListenConfig) certificate() (certFile, keyFile string, err error) {
+	if c.TLSCert != "" {
+		return c.TLSCert, c.TLSKey, nil
+	}
+
+	certFile = filepath.Join(c.TLSSelfSignedDir, "elly-cert.pem")
+	keyFile = filepath.Join(c.TLSSelfSignedDir, "elly-key.pem")
+	_, certErr := os.Stat(certFile)
+	_, keyErr := os.Stat(keyFile)
+	if certErr == nil && keyErr == nil {
+		return certFile, keyFile, nil
+	}
+	for _, err := range []error{certErr, keyErr} {
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return "", "", err
+		}
+	}
+
+	if err := generateSelfSigned(certFile, keyFile); err != nil {
+		return "", "", fmt.Errorf("could not generate self-signed certificate: %w", err)
+	}
+	return certFile, keyFile, nil
+}
+
+func generateSelfSigned(certFile, keyFile string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+
+	hostname, _ := os.Hostname()
+	template := x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{Organization: []string{"elly"}, CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(10, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	if hostname != "" && hostname != "localhost" {
+		template.DNSNames = append(template.DNSNames, hostname)
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	keyDer, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer}), 0o600); err != nil {
+		return err
+	}
+	return os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644)
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestListen_UnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "elly.sock")
+
+	// left behind by a crashed elly
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	l, where, err := listen("", ListenConfig{UnixSocket: path, UnixSocketMode: 0o660})
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	if where != "http on unix:"+path {
+		t.Errorf("got description %q", where)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := info.Mode().Perm(); got != 0o660 {
+		t.Errorf("got socket mode %o, want 660", got)
+	}
+
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})}
+	go srv.Serve(l)
+	t.Cleanup(func() { srv.Close() })
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+	resp, err := client.Get("http://elly/health")
+	if err != nil {
+		t.Fatalf("GET over unix socket: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTeapot {
+		t.Errorf("got status %d, want %d", resp.StatusCode, http.StatusTeapot)
+	}
+}
+
+func TestListen_IgnoresSystemdSocketsForOtherProcesses(t *testing.T) {
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()+1))
+	t.Setenv("LISTEN_FDS", "1")
+
+	l, err := systemdListener()
+	if err != nil || l != nil {
+		t.Errorf("got listener %v and error %v, want neither", l, err)
+	}
+}
+
+func TestCertificate_SelfSignedIsGeneratedOnce(t *testing.T) {
+	c := ListenConfig{TLSSelfSignedDir: t.TempDir()}
+
+	certFile, keyFile, err := c.certificate()
+	if err != nil {
+		t.Fatalf("certificate: %v", err)
+	}
+	if _, err := tls.LoadX509KeyPair(certFile, keyFile); err != nil {
+		t.Fatalf("generated an unusable certificate: %v", err)
+	}
+	if info, err := os.Stat(keyFile); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("expected the key to only be readable by the owner, got %v, %v", info, err)
+	}
+
+	first, err := os.ReadFile(certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := c.certificate(); err != nil {
+		t.Fatalf("certificate: %v", err)
+	}
+	second, err := os.ReadFile(certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(first, second) {
+		t.Error("expected the stored certificate to be reused")
+	}
+}
+
+func TestCertificate_PrefersGivenFiles(t *testing.T) {
+	c := ListenConfig{TLSCert: "cert.pem", TLSKey: "key.pem", TLSSelfSignedDir: t.TempDir()}
+	certFile, keyFile, err := c.certificate()
+	if err != nil || certFile != "cert.pem" || keyFile != "key.pem" {
+		t.Errorf("got %q, %q, %v", certFile, keyFile, err)
+	}
+	if entries, _ := os.ReadDir(c.TLSSelfSignedDir); len(entries) != 0 {
+		t.Errorf("expected nothing to be generated, got %v", entries)
+	}
+}
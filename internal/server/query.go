@@ -0,0 +1,255 @@
+package server
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chelmertz/elly/internal/points"
+	"github.com/chelmertz/elly/internal/types"
+)
+
+// prQuery is the filtering, sorting and grouping shared by the API and the
+// GUI, so that the GUI can be linked to with the same query string as the
+// scripts use.
+type prQuery struct {
+	MinPoints    *int
+	Repo         string // "name" or "owner/name"
+	Owner        string
+	Author       string
+	Mine         *bool
+	Draft        *bool
+	ReviewStatus string // as given by Github, or "NONE" for PRs without a decision
+	Buried       *bool
+	Tag          string // on the PR itself, or on its repo
+	Search       string // case insensitive words, that must all be in the title or the note
+	Limit        int    // 0 means no limit
+	GroupBy      string // "", "repo" or "author"
+	Sort         string // "points", "updated" or "size"
+}
+
+type prGroup struct {
+	Key string
+	Prs []types.ViewPr
+}
+
+type queryResult struct {
+	// Prs are filtered, sorted and limited.
+	Prs            []types.ViewPr
+	PointsPerPrUrl map[string]*points.Points
+	// Groups are ordered by their best ranked PR. Without GroupBy, there is
+	// a single group (with an empty key) containing all Prs.
+	Groups []prGroup
+}
+
+func parseOptionalBool(values url.Values, key string) (*bool, error) {
+	v := values.Get(key)
+	if v == "" {
+		return nil, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be true or false", key)
+	}
+	return &b, nil
+}
+
+func parsePrQuery(values url.Values) (prQuery, error) {
+	q := prQuery{
+		Repo:         values.Get("repo"),
+		Owner:        values.Get("owner"),
+		Author:       values.Get("author"),
+		ReviewStatus: strings.ToUpper(values.Get("reviewStatus")),
+		Tag:          values.Get("tag"),
+		Search:       values.Get("q"),
+		GroupBy:      values.Get("groupBy"),
+		Sort:         values.Get("sort"),
+	}
+
+	if minPoints := values.Get("minPoints"); minPoints != "" {
+		min, err := strconv.Atoi(minPoints)
+		if err != nil || min < -999 || min > 999 {
+			return prQuery{}, fmt.Errorf("minPoints must be an integer between -999 and 999")
+		}
+		q.MinPoints = &min
+	}
+
+	if limit := values.Get("limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil || l < 1 {
+			return prQuery{}, fmt.Errorf("limit must be a positive integer")
+		}
+		q.Limit = l
+	}
+
+	var err error
+	if q.Mine, err = parseOptionalBool(values, "mine"); err != nil {
+		return prQuery{}, err
+	}
+	if q.Draft, err = parseOptionalBool(values, "draft"); err != nil {
+		return prQuery{}, err
+	}
+	if q.Buried, err = parseOptionalBool(values, "buried"); err != nil {
+		return prQuery{}, err
+	}
+
+	switch q.ReviewStatus {
+	case "", "NONE", "APPROVED", "CHANGES_REQUESTED", "REVIEW_REQUIRED":
+	default:
+		return prQuery{}, fmt.Errorf("reviewStatus must be one of none, approved, changes_requested or review_required")
+	}
+
+	switch q.GroupBy {
+	case "", "repo", "author":
+	default:
+		return prQuery{}, fmt.Errorf("groupBy must be repo or author")
+	}
+
+	switch q.Sort {
+	case "":
+		q.Sort = "points"
+	case "points", "updated", "size":
+	default:
+		return prQuery{}, fmt.Errorf("sort must be points, updated or size")
+	}
+
+	return q, nil
+}
+
+func (q prQuery) matches(pr types.ViewPr, p *points.Points, currentUser string) bool {
+	// excluded by a rule, whatever the query
+	if slices.ContainsFunc(pr.Rules, func(r types.Rule) bool { return r.Action == types.RuleExclude }) {
+		return false
+	}
+	if q.MinPoints != nil && p.Total < *q.MinPoints {
+		return false
+	}
+	if q.Repo != "" && !strings.EqualFold(q.Repo, pr.RepoName) && !strings.EqualFold(q.Repo, pr.RepoOwner+"/"+pr.RepoName) {
+		return false
+	}
+	if q.Owner != "" && !strings.EqualFold(q.Owner, pr.RepoOwner) {
+		return false
+	}
+	if q.Author != "" && !strings.EqualFold(q.Author, pr.Author) {
+		return false
+	}
+	if q.Mine != nil && *q.Mine != (pr.Author == currentUser) {
+		return false
+	}
+	if q.Draft != nil && *q.Draft != pr.IsDraft {
+		return false
+	}
+	if q.Buried != nil && *q.Buried != pr.IsBuried() {
+		return false
+	}
+	if q.ReviewStatus == "NONE" && pr.ReviewStatus != "" {
+		return false
+	}
+	if q.ReviewStatus != "" && q.ReviewStatus != "NONE" && q.ReviewStatus != pr.ReviewStatus {
+		return false
+	}
+	if q.Tag != "" && !slices.ContainsFunc(pr.Tags, func(t types.Tag) bool { return strings.EqualFold(t.Name, q.Tag) }) {
+		return false
+	}
+	if q.Search != "" && !searchMatches(q.Search, pr) {
+		return false
+	}
+	return true
+}
+
+// searchMatches reports whether every word of search is found in the title
+// or the note of pr, in any order.
+func searchMatches(search string, pr types.ViewPr) bool {
+	text := strings.ToLower(pr.Title + "\n" + pr.Note)
+	for _, word := range strings.Fields(strings.ToLower(search)) {
+		if !strings.Contains(text, word) {
+			return false
+		}
+	}
+	return true
+}
+
+func prSize(pr types.ViewPr) int {
+	return pr.Additions + pr.Deletions
+}
+
+func (q prQuery) groupKey(pr types.ViewPr) string {
+	switch q.GroupBy {
+	case "repo":
+		return pr.RepoOwner + "/" + pr.RepoName
+	case "author":
+		return pr.Author
+	}
+	return ""
+}
+
+// rank calculates the points of every PR and sorts prs in place. Ties, and the
+// default "points" sort, are ordered by highest points first and then by the
+// most recently updated PR.
+func (q prQuery) rank(prs []types.ViewPr, currentUser string, now time.Time) map[string]*points.Points {
+	pointsPerPrUrl := make(map[string]*points.Points)
+	for _, pr := range prs {
+		pointsPerPrUrl[pr.Url] = points.StandardPrPoints(pr, currentUser, now)
+	}
+
+	sort.SliceStable(prs, func(i, j int) bool {
+		switch q.Sort {
+		case "updated":
+			if !prs[i].LastUpdated.Equal(prs[j].LastUpdated) {
+				return prs[j].LastUpdated.Before(prs[i].LastUpdated)
+			}
+		case "size":
+			if prSize(prs[i]) != prSize(prs[j]) {
+				return prSize(prs[i]) < prSize(prs[j])
+			}
+		}
+
+		pri := pointsPerPrUrl[prs[i].Url].Total
+		prj := pointsPerPrUrl[prs[j].Url].Total
+		if pri == prj {
+			lastUpdated := prs[j].LastUpdated.Before(prs[i].LastUpdated)
+			return lastUpdated
+		}
+		return pri > prj
+	})
+
+	return pointsPerPrUrl
+}
+
+// run filters, sorts, limits and groups prs. prs is modified in place.
+func (q prQuery) run(prs []types.ViewPr, currentUser string, now time.Time) queryResult {
+	pointsPerPrUrl := q.rank(prs, currentUser, now)
+
+	filtered := make([]types.ViewPr, 0, len(prs))
+	for _, pr := range prs {
+		if q.matches(pr, pointsPerPrUrl[pr.Url], currentUser) {
+			filtered = append(filtered, pr)
+		}
+	}
+	if q.Limit > 0 && len(filtered) > q.Limit {
+		filtered = filtered[:q.Limit]
+	}
+
+	groups := make([]prGroup, 0)
+	groupIndex := make(map[string]int)
+	for _, pr := range filtered {
+		key := q.groupKey(pr)
+		i, found := groupIndex[key]
+		if !found {
+			i = len(groups)
+			groupIndex[key] = i
+			groups = append(groups, prGroup{Key: key})
+		}
+		groups[i].Prs = append(groups[i].Prs, pr)
+	}
+
+	return queryResult{
+		Prs:            filtered,
+		PointsPerPrUrl: pointsPerPrUrl,
+		Groups:         groups,
+	}
+}
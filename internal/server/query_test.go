@@ -0,0 +1,145 @@
+package server
+
+import (
+	"net/url"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/chelmertz/elly/internal/points"
+	"github.com/chelmertz/elly/internal/types"
+)
+
+func queryPrs() []types.ViewPr {
+	now := time.Now()
+	return []types.ViewPr{
+		{Url: "a", Title: "Fix the flaky login test", Author: "me", RepoOwner: "acme", RepoName: "web", Additions: 400, LastUpdated: now.Add(-time.Hour), ReviewRequestedFromUsers: []string{"you"}},
+		{Url: "b", Title: "Add dark mode", Author: "you", RepoOwner: "acme", RepoName: "web", Additions: 10, LastUpdated: now, Tags: []types.Tag{{Name: "learning"}, {Name: "low-prio", OnRepo: true}}},
+		{Url: "c", Title: "Bump deps", Author: "dependabot[bot]", RepoOwner: "acme", RepoName: "api", Additions: 2, IsDraft: true, LastUpdated: now.Add(-2 * time.Hour)},
+		{Url: "d", Title: "Old stuff", Author: "you", RepoOwner: "other", RepoName: "web", Additions: 100, Buried: true, ReviewStatus: "APPROVED", LastUpdated: now.Add(-3 * time.Hour), Note: "Waiting for the infra change"},
+	}
+}
+
+func urls(prs []types.ViewPr) []string {
+	u := make([]string, 0, len(prs))
+	for _, pr := range prs {
+		u = append(u, pr.Url)
+	}
+	return u
+}
+
+func TestPrQuery_Filters(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"repo=web", []string{"b", "a", "d"}},
+		{"repo=acme/web", []string{"b", "a"}},
+		{"owner=OTHER", []string{"d"}},
+		{"author=you", []string{"b", "d"}},
+		{"mine=true", []string{"a"}},
+		{"mine=false&buried=false", []string{"b", "c"}},
+		{"draft=true", []string{"c"}},
+		{"reviewStatus=approved", []string{"d"}},
+		{"reviewStatus=none&draft=false", []string{"b", "a"}},
+		{"q=DARK", []string{"b"}},
+		{"q=infra+waiting", []string{"d"}},
+		{"q=stuff+infra", []string{"d"}},
+		{"q=dark+infra", []string{}},
+		{"tag=Learning", []string{"b"}},
+		{"tag=low-prio&mine=false", []string{"b"}},
+		{"tag=nope", []string{}},
+		{"sort=size", []string{"c", "b", "d", "a"}},
+		{"sort=updated&limit=2", []string{"b", "a"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			values, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			q, err := parsePrQuery(values)
+			if err != nil {
+				t.Fatalf("parsePrQuery(%s) failed: %v", tt.query, err)
+			}
+			got := urls(q.run(queryPrs(), "me", time.Now()).Prs)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("got %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestPrQuery_RulesExclude(t *testing.T) {
+	prs := queryPrs()
+	for i := range prs {
+		for _, rule := range []types.Rule{{Author: "*[bot]", Action: types.RuleExclude}, {Repo: "acme/web", Action: types.RulePoints, Points: 10}} {
+			if rule.Matches(prs[i]) {
+				prs[i].Rules = append(prs[i].Rules, rule)
+			}
+		}
+	}
+	q, err := parsePrQuery(url.Values{"author": {"dependabot[bot]"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := q.run(prs, "me", time.Now()).Prs; len(got) != 0 {
+		t.Errorf("expected the excluded PR to never be listed, got %v", urls(got))
+	}
+}
+
+func TestPrQuery_RulesBury(t *testing.T) {
+	prs := queryPrs()
+	rule := types.Rule{Author: "dependabot[bot]", Action: types.RuleBury}
+	for i := range prs {
+		if rule.Matches(prs[i]) {
+			prs[i].Rules = append(prs[i].Rules, rule)
+		}
+	}
+	for query, want := range map[string][]string{"buried=true": {"c", "d"}, "buried=false": {"b", "a"}} {
+		values, _ := url.ParseQuery(query)
+		q, err := parsePrQuery(values)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := urls(q.run(prs, "me", time.Now()).Prs); !slices.Equal(got, want) {
+			t.Errorf("%s: got %v, want %v", query, got, want)
+		}
+	}
+	if dto := toPrV1(prs[2], points.StandardPrPoints(prs[2], "me", time.Now())); !dto.Buried {
+		t.Error("expected the PR buried by a rule to be buried in the API too")
+	}
+}
+
+func TestPrQuery_GroupByRepo(t *testing.T) {
+	q, err := parsePrQuery(url.Values{"groupBy": {"repo"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	groups := q.run(queryPrs(), "me", time.Now()).Groups
+
+	wantKeys := []string{"acme/web", "acme/api", "other/web"}
+	if len(groups) != len(wantKeys) {
+		t.Fatalf("got %d groups, want %d", len(groups), len(wantKeys))
+	}
+	for i, g := range groups {
+		if g.Key != wantKeys[i] {
+			t.Errorf("group %d: got key %s, want %s", i, g.Key, wantKeys[i])
+		}
+	}
+}
+
+func TestPrQuery_InvalidValues(t *testing.T) {
+	for _, query := range []string{"minPoints=1000", "limit=0", "mine=maybe", "reviewStatus=meh", "groupBy=label", "sort=random"} {
+		values, _ := url.ParseQuery(query)
+		if _, err := parsePrQuery(values); err == nil {
+			t.Errorf("parsePrQuery(%s): expected an error", query)
+		}
+	}
+}
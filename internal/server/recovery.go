@@ -0,0 +1,66 @@
+package server
+
+import (
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"strings"
+)
+
+// statusRecorder remembers whether a response has been started, since a
+// panicking handler may have written half of it already.
+type statusRecorder struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.wroteHeader = true
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	s.wroteHeader = true
+	return s.ResponseWriter.Write(b)
+}
+
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// withRecovery turns a panic in a handler into a logged 500, instead of
+// net/http's default of silently dropping the connection.
+func withRecovery(logger *slog.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := &statusRecorder{ResponseWriter: w}
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			if rec == http.ErrAbortHandler {
+				// deliberately aborted, let net/http handle it quietly
+				panic(rec)
+			}
+
+			logger.Error("panic while handling request",
+				slog.Any("panic", rec),
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.String("remote_addr", r.RemoteAddr),
+				slog.String("stack", string(debug.Stack())),
+			)
+			if recorder.wroteHeader {
+				// too late for a proper error, make sure the client notices
+				// that the response is incomplete
+				panic(http.ErrAbortHandler)
+			}
+			if strings.HasPrefix(r.URL.Path, "/api/") {
+				writeJsonError(w, logger, http.StatusInternalServerError, "internal error, see elly's logs")
+				return
+			}
+			http.Error(w, "internal error, see elly's logs", http.StatusInternalServerError)
+		}()
+		next.ServeHTTP(recorder, r)
+	})
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/chelmertz/elly/internal/storage"
+)
+
+func TestWithRecovery_TurnsPanicsInto500s(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, nil))
+	srv := httptest.NewServer(withRecovery(logger, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("oh no")
+	})))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/api/v1/prs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("got status %d, want %d", resp.StatusCode, http.StatusInternalServerError)
+	}
+	var body errorV1
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || body.Error == "" {
+		t.Errorf("expected a json error, got %v, %v", body, err)
+	}
+
+	for _, want := range []string{"oh no", "path=/api/v1/prs", "stack="} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("expected the log to contain %q, got %s", want, logs.String())
+		}
+	}
+}
+
+// brokenStorage can't read any PRs.
+type brokenStorage struct {
+	storage.Storage
+}
+
+func (brokenStorage) Prs() (storage.StoredState, error) {
+	return storage.StoredState{}, errors.New("disk on fire")
+}
+
+func TestHandlers_ReadErrorsAre500s(t *testing.T) {
+	srv := httptest.NewServer(newMux(HttpServerConfig{
+		Store:  brokenStorage{storage.NewStorageDemo()},
+		Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}))
+	defer srv.Close()
+
+	for _, path := range []string{"/api/v1/prs", "/api/v0/prs"} {
+		t.Run(path, func(t *testing.T) {
+			var response errorV1
+			if err := json.Unmarshal(getJson(t, srv.URL+path, http.StatusInternalServerError), &response); err != nil {
+				t.Fatalf("could not unmarshal error response: %v", err)
+			}
+			if response.Error == "" {
+				t.Error("expected an error message")
+			}
+		})
+	}
+
+	resp, err := http.Get(srv.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("got status %d for the GUI, want %d", resp.StatusCode, http.StatusInternalServerError)
+	}
+}
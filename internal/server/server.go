@@ -1,15 +1,16 @@
 package server
 
 import (
+	"bytes"
+	"context"
 	"embed"
-	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"html/template"
 	"log/slog"
 	"net/http"
-	"sort"
 	"strconv"
-	"text/template"
 	"time"
 
 	"github.com/chelmertz/elly/internal/backoff"
@@ -20,23 +21,68 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-func check(err error) {
-	if err != nil {
-		panic(err)
-	}
-}
-
 type IndexHtmlData struct {
 	Prs                    []types.ViewPr
 	PointsPerPrUrl         map[string]*points.Points
+	Groups                 []prGroup
+	Filters                string
 	CurrentUser            string
 	RefreshUrl             string
 	LastRefreshed          string
+	NextPoll               string // e.g. "next poll in 3m0s: active PRs"
+	NeedsAttention         string // why polling is paused until retried, if it is
 	RefreshIntervalMinutes int
 	Version                string
 	GoldenTestingEnabled   bool
 	RateLimitedUntil       string
+	RateLimitRemaining     int
+	RateLimitLimit         int
+	RateLimitResetAt       string // empty unless the budget is known, and not yet reset
 	SetupMode              bool
+	AuthEnabled            bool
+	RefreshStatus          *refreshStatus // nil unless polling Github
+	PatExpiresAt           string         // empty unless the PAT expires soon
+	PatExpiresInDays       int
+	PatExpiryWarningDays   int
+}
+
+// refreshStatus is what the status panel tells about refreshing.
+type refreshStatus struct {
+	Multiplier     string // of the interval, "1" unless backing off
+	NextPollAt     string
+	NextPollReason string
+	LastErrorAt    string // empty unless one of the latest refreshes failed
+	LastError      string
+}
+
+// refreshV0 is an attempt to fetch PRs, in the history of refreshes.
+type refreshV0 struct {
+	StartedAt  time.Time `json:"started_at"`
+	DurationMs int64     `json:"duration_ms"`
+	Kind       string    `json:"kind"`
+	Prs        int       `json:"prs"`
+	Outcome    string    `json:"outcome"`
+	ErrorClass string    `json:"error_class,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// patDiagnosisV0 tells which of the permissions elly needs the PAT has.
+type patDiagnosisV0 struct {
+	Username    string              `json:"username"`
+	TokenType   string              `json:"token_type"`
+	Scopes      []string            `json:"scopes,omitempty"`
+	ExpiresAt   string              `json:"expires_at,omitempty"`
+	Repo        string              `json:"repo,omitempty"`
+	Permissions []permissionCheckV0 `json:"permissions"`
+	Warnings    []string            `json:"warnings,omitempty"`
+	Ok          bool                `json:"ok"`
+}
+
+type permissionCheckV0 struct {
+	Permission string `json:"permission"`
+	Ok         bool   `json:"ok"`
+	Skipped    bool   `json:"skipped,omitempty"`
+	Detail     string `json:"detail,omitempty"`
 }
 
 //go:embed index.html
@@ -51,6 +97,30 @@ type HttpServerConfig struct {
 	Logger               *slog.Logger
 	Tracker              *backoff.Tracker
 	SetupMode            bool // True if no PAT configured (initial state only)
+	Auth                 AuthConfig
+	Listen               ListenConfig
+	Backups              *storage.Backups // nil unless the storage is SQLite
+}
+
+func newRefreshStatus(tracker *backoff.Tracker, store storage.Storage, logger *slog.Logger) *refreshStatus {
+	state := tracker.State()
+	status := &refreshStatus{
+		Multiplier:     strconv.FormatFloat(state.Multiplier, 'g', 3, 64),
+		NextPollAt:     state.NextPollAt.Format(time.RFC3339),
+		NextPollReason: state.NextPollReason,
+	}
+	refreshes, err := store.Refreshes()
+	if err != nil {
+		logger.Warn("could not read refreshes", slog.Any("error", err))
+	}
+	for _, refresh := range refreshes {
+		if refresh.Outcome == types.RefreshFailed {
+			status.LastErrorAt = refresh.StartedAt.Format(time.RFC3339)
+			status.LastError = refresh.ErrorClass + ": " + refresh.Error
+			break
+		}
+	}
+	return status
 }
 
 // getCurrentUsername returns the username from the stored PAT, or empty string if not configured.
@@ -62,38 +132,81 @@ func getCurrentUsername(store storage.Storage) string {
 	return storedPat.Username
 }
 
-func ServeWeb(webConfig HttpServerConfig) {
-	temp, err := template.ParseFS(index, "index.html")
-	check(err)
+// maxStateBytes limits POST /api/v0/state, an export is mostly a list of
+// buried PR URLs.
+const maxStateBytes = 10 << 20
 
-	http.HandleFunc("POST /api/v0/prs/{prUrl}/golden", func(w http.ResponseWriter, r *http.Request) {
+// shutdownTimeout is how long in-flight requests get to finish on shutdown.
+const shutdownTimeout = 10 * time.Second
+
+// ServeWeb serves the GUI and the API until ctx is cancelled, and then waits
+// for in-flight requests to finish.
+func ServeWeb(ctx context.Context, webConfig HttpServerConfig) error {
+	mux := newMux(webConfig)
+	// CSRF protection for everything but GET, HEAD and OPTIONS, since the
+	// session cookie would otherwise be sent along by any site
+	handler := http.NewCrossOriginProtection().Handler(withAuth(webConfig.Auth, webConfig.Logger, mux))
+	handler = withRecovery(webConfig.Logger, handler)
+
+	listener, where, err := listen(webConfig.Url, webConfig.Listen)
+	if err != nil {
+		return fmt.Errorf("could not listen: %w", err)
+	}
+	srv := &http.Server{Handler: handler}
+
+	webConfig.Logger.Info("starting web server at", slog.String("url", where), slog.String("auth", string(webConfig.Auth.Mode)))
+	serveErr := make(chan error, 1)
+	go func() {
+		if webConfig.Listen.tls() {
+			certFile, keyFile, err := webConfig.Listen.certificate()
+			if err != nil {
+				listener.Close() //nolint:errcheck // the certificate error is more interesting
+				serveErr <- err
+				return
+			}
+			serveErr <- srv.ServeTLS(listener, certFile, keyFile)
+			return
+		}
+		serveErr <- srv.Serve(listener)
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	webConfig.Logger.Info("shutting down web server")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	return srv.Shutdown(shutdownCtx)
+}
+
+func newMux(webConfig HttpServerConfig) *http.ServeMux {
+	temp := template.Must(template.ParseFS(index, "index.html"))
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("POST /api/v0/prs/{prUrl}/golden", func(w http.ResponseWriter, r *http.Request) {
 		if !webConfig.GoldenTestingEnabled {
 			// Nothing to see here, the feature is turned off - restart with -golden to turn it on
 			w.WriteHeader(http.StatusNotFound)
 			return
 		}
 
-		storedPrs := webConfig.Store.Prs()
-		prs_ := storedPrs.Prs
-
-		prUrlBytes, err := base64.StdEncoding.DecodeString(r.PathValue("prUrl"))
+		ghPrUrl, err := prUrlFromId(r.PathValue("prUrl"))
 		if err != nil {
 			w.WriteHeader(http.StatusBadRequest)
 			fmt.Fprint(w, "invalid PR ID") //nolint:errcheck // best-effort response body
 			return
 		}
-		ghPrUrl := string(prUrlBytes)
-
-		var foundPr types.ViewPr
-		found := false // just to avoid dealing with an empty state PR, or mucking with a pointer
-		for _, pr := range prs_ {
-			if ghPrUrl == pr.Url {
-				// not the most efficient but I've never had more than ~30 PRs showing
-				// query the DB if this ever gets expensive
-				foundPr = pr
-				found = true
-				break
-			}
+
+		foundPr, found, err := webConfig.Store.GetPr(ghPrUrl)
+		if err != nil {
+			webConfig.Logger.Error("could not get pr", slog.String("pr_url", ghPrUrl), slog.Any("error", err))
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, "couldn't turn PR %s into a golden copy, could not read it", ghPrUrl) //nolint:errcheck // best-effort response body
+			return
 		}
 		if !found {
 			w.WriteHeader(http.StatusNotFound)
@@ -114,14 +227,13 @@ func ServeWeb(webConfig HttpServerConfig) {
 		w.WriteHeader(http.StatusOK)
 	})
 
-	http.HandleFunc("POST /api/v0/prs/{prUrl}/{action}", func(w http.ResponseWriter, r *http.Request) {
-		prUrlBytes, err := base64.StdEncoding.DecodeString(r.PathValue("prUrl"))
+	mux.HandleFunc("POST /api/v0/prs/{prUrl}/{action}", func(w http.ResponseWriter, r *http.Request) {
+		ghPrUrl, err := prUrlFromId(r.PathValue("prUrl"))
 		if err != nil {
 			w.WriteHeader(http.StatusBadRequest)
 			fmt.Fprint(w, "invalid PR ID") //nolint:errcheck // best-effort response body
 			return
 		}
-		ghPrUrl := string(prUrlBytes)
 
 		action := r.PathValue("action")
 
@@ -148,102 +260,156 @@ func ServeWeb(webConfig HttpServerConfig) {
 
 	// Let's say that v0 represents "may change at any time", read the code.
 	// Should be bumped before tagging this repo as v1
-	http.HandleFunc("GET /api/v0/prs", func(w http.ResponseWriter, r *http.Request) {
-		storedPrs := webConfig.Store.Prs().Prs
-		prsToReturn := make([]types.ViewPr, 0)
-
-		minimumPoints := -999
-		if minPoints := r.URL.Query().Get("minPoints"); minPoints != "" {
-			if min, err := strconv.Atoi(minPoints); err == nil && min >= -999 && min <= 999 {
-				minimumPoints = min
-			}
+	mux.HandleFunc("GET /api/v0/prs", func(w http.ResponseWriter, r *http.Request) {
+		query, err := parsePrQuery(r.URL.Query())
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, err.Error()) //nolint:errcheck // best-effort response body
+			return
+		}
+		if query.MinPoints == nil && query.Buried == nil {
+			// v0 has always hidden (most) buried PRs by default, unless
+			// they're asked for
+			defaultMinPoints := -999
+			query.MinPoints = &defaultMinPoints
 		}
 
-		currentUser := getCurrentUsername(webConfig.Store)
-		pointsPerPrUrl := make(map[string]*points.Points)
-		for _, pr := range storedPrs {
-			points := points.StandardPrPoints(pr, currentUser, time.Now())
-			pointsPerPrUrl[pr.Url] = points
+		state, err := webConfig.Store.Prs()
+		if err != nil {
+			webConfig.Logger.Error("could not read prs", slog.Any("error", err))
+			writeJsonError(w, webConfig.Logger, http.StatusInternalServerError, "could not read PRs")
+			return
 		}
+		result := query.run(state.Prs, getCurrentUsername(webConfig.Store), time.Now())
 
-		// TODO turn into slices.DeleteFunc()
-		for _, pr := range storedPrs {
-			points := pointsPerPrUrl[pr.Url]
-			if points.Total >= minimumPoints {
-				prsToReturn = append(prsToReturn, pr)
+		if query.GroupBy != "" {
+			grouped := make(map[string][]types.ViewPr)
+			for _, g := range result.Groups {
+				grouped[g.Key] = g.Prs
 			}
+			writeJson(w, webConfig.Logger, http.StatusOK, grouped)
+			return
 		}
+		writeJson(w, webConfig.Logger, http.StatusOK, result.Prs)
+	})
 
-		sort.Slice(prsToReturn, func(i, j int) bool {
-			pri := pointsPerPrUrl[storedPrs[i].Url].Total
-			prj := pointsPerPrUrl[storedPrs[j].Url].Total
-			if pri == prj {
-				lastUpdated := storedPrs[j].LastUpdated.Before(storedPrs[i].LastUpdated)
-				return lastUpdated
-			}
-			return pri > prj
-		})
+	// also the GUI's retry, after polling paused since it needs attention
+	mux.HandleFunc("POST /api/v0/prs/refresh", func(w http.ResponseWriter, r *http.Request) {
+		webConfig.Tracker.Resume()
+	})
 
-		w.Header().Set("Content-Type", "application/json")
-		err := json.NewEncoder(w).Encode(prsToReturn)
-		check(err)
+	mux.HandleFunc("GET /api/v0/refreshes", func(w http.ResponseWriter, r *http.Request) {
+		refreshes, err := webConfig.Store.Refreshes()
+		if err != nil {
+			webConfig.Logger.Error("could not read refreshes", slog.Any("error", err))
+			writeJsonError(w, webConfig.Logger, http.StatusInternalServerError, "could not read refreshes")
+			return
+		}
+		response := make([]refreshV0, 0, len(refreshes))
+		for _, refresh := range refreshes {
+			response = append(response, refreshV0{
+				StartedAt:  refresh.StartedAt,
+				DurationMs: refresh.Duration.Milliseconds(),
+				Kind:       refresh.Kind,
+				Prs:        refresh.Prs,
+				Outcome:    refresh.Outcome,
+				ErrorClass: refresh.ErrorClass,
+				Error:      refresh.Error,
+			})
+		}
+		writeJson(w, webConfig.Logger, http.StatusOK, map[string]any{"refreshes": response})
 	})
 
-	http.HandleFunc("POST /api/v0/prs/refresh", func(w http.ResponseWriter, r *http.Request) {
-		webConfig.Tracker.RequestRefresh()
+	// the GUI says it's open, so that PRs are polled for more often
+	mux.HandleFunc("POST /api/v0/gui/heartbeat", func(w http.ResponseWriter, r *http.Request) {
+		if webConfig.Tracker != nil {
+			webConfig.Tracker.GuiSeen()
+		}
+		w.WriteHeader(http.StatusNoContent)
 	})
 
-	http.HandleFunc("GET /", func(w http.ResponseWriter, r *http.Request) {
-		storedPrs := webConfig.Store.Prs()
-		prs_ := storedPrs.Prs
+	mux.HandleFunc("GET /", func(w http.ResponseWriter, r *http.Request) {
+		query, err := parsePrQuery(r.URL.Query())
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "invalid filter: %v", err) //nolint:errcheck // best-effort response body
+			return
+		}
+
+		storedPrs, err := webConfig.Store.Prs()
+		if err != nil {
+			webConfig.Logger.Error("could not read prs", slog.Any("error", err))
+			http.Error(w, "could not read PRs, see elly's logs", http.StatusInternalServerError)
+			return
+		}
 
 		// Check if PAT is configured dynamically
-		_, found, _ := webConfig.Store.GetPAT()
+		storedPat, found, _ := webConfig.Store.GetPAT()
 		setupMode := !found
 		currentUser := getCurrentUsername(webConfig.Store)
-
-		pointsPerPrUrl := make(map[string]*points.Points)
-		for _, pr := range prs_ {
-			pointsPerPrUrl[pr.Url] = points.StandardPrPoints(pr, currentUser, time.Now())
-		}
-
-		sort.Slice(prs_, func(i, j int) bool {
-			pri := pointsPerPrUrl[prs_[i].Url].Total
-			prj := pointsPerPrUrl[prs_[j].Url].Total
-			if pri == prj {
-				lastUpdated := prs_[j].LastUpdated.Before(prs_[i].LastUpdated)
-				return lastUpdated
-			}
-			return pri > prj
-		})
+		result := query.run(storedPrs.Prs, currentUser, time.Now())
 		rateLimitUntil := webConfig.Store.GetRateLimitUntil()
 		rateLimitUntilStr := ""
 		if !rateLimitUntil.IsZero() {
 			rateLimitUntilStr = rateLimitUntil.Format(time.RFC3339)
 		}
+		nextPoll, needsAttention := "", ""
+		if webConfig.Tracker != nil {
+			webConfig.Tracker.GuiSeen()
+			nextPoll = webConfig.Tracker.Decision().String()
+			needsAttention = webConfig.Tracker.Attention()
+		}
+		budget, budgetFound, err := webConfig.Store.GetRateLimitBudget()
+		if err != nil {
+			webConfig.Logger.Warn("could not read rate limit budget", slog.Any("error", err))
+		}
 		data := IndexHtmlData{
-			Prs:                    prs_,
-			PointsPerPrUrl:         pointsPerPrUrl,
+			Prs:                    result.Prs,
+			PointsPerPrUrl:         result.PointsPerPrUrl,
+			Groups:                 result.Groups,
+			Filters:                r.URL.RawQuery,
 			CurrentUser:            currentUser,
 			LastRefreshed:          storedPrs.LastFetched.Format(time.RFC3339),
+			NextPoll:               nextPoll,
+			NeedsAttention:         needsAttention,
 			RefreshIntervalMinutes: webConfig.TimeoutMinutes,
 			Version:                webConfig.Version,
 			GoldenTestingEnabled:   webConfig.GoldenTestingEnabled,
 			RateLimitedUntil:       rateLimitUntilStr,
 			SetupMode:              setupMode,
+			AuthEnabled:            webConfig.Auth.enabled(),
+			PatExpiryWarningDays:   storage.PatExpiryWarningDays,
+		}
+		if found && storedPat.ExpiresSoon(time.Now()) {
+			data.PatExpiresAt = storedPat.ExpiresAt.Format(time.RFC3339)
+			data.PatExpiresInDays, _ = storedPat.ExpiresInDays(time.Now())
+		}
+		if webConfig.Tracker != nil {
+			data.RefreshStatus = newRefreshStatus(webConfig.Tracker, webConfig.Store, webConfig.Logger)
+		}
+		if budgetFound && budget.ResetAt.After(time.Now()) {
+			data.RateLimitRemaining = budget.Remaining
+			data.RateLimitLimit = budget.Limit
+			data.RateLimitResetAt = budget.ResetAt.Format(time.RFC3339)
+		}
+		// render before writing anything, so that a failure can still be a 500
+		var rendered bytes.Buffer
+		if err := temp.Execute(&rendered, data); err != nil {
+			webConfig.Logger.Error("could not render index.html", slog.Any("error", err))
+			http.Error(w, "could not render the page, see elly's logs", http.StatusInternalServerError)
+			return
 		}
-		err := temp.Execute(w, data)
-		check(err)
+		w.Write(rendered.Bytes()) //nolint:errcheck // best-effort response body
 	})
 
-	http.Handle("GET /metrics", promhttp.Handler())
+	mux.Handle("GET /metrics", promhttp.Handler())
 
-	http.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		fmt.Fprint(w, "ok") //nolint:errcheck // best-effort response body
 	})
 
-	http.HandleFunc("PUT /api/v0/config/pat", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("PUT /api/v0/config/pat", func(w http.ResponseWriter, r *http.Request) {
 		var req struct {
 			Token string `json:"token"`
 		}
@@ -275,8 +441,9 @@ func ServeWeb(webConfig HttpServerConfig) {
 			return
 		}
 
-		// Trigger a refresh so the new PAT is used immediately
-		webConfig.Tracker.RequestRefresh()
+		// Trigger a refresh so the new PAT is used immediately, even if
+		// polling paused since the previous one didn't work
+		webConfig.Tracker.Resume()
 
 		w.Header().Set("Content-Type", "application/json")
 		response := map[string]any{
@@ -288,7 +455,7 @@ func ServeWeb(webConfig HttpServerConfig) {
 		_ = json.NewEncoder(w).Encode(response)
 	})
 
-	http.HandleFunc("GET /api/v0/config/status", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("GET /api/v0/config/status", func(w http.ResponseWriter, r *http.Request) {
 		storedPat, found, _ := webConfig.Store.GetPAT()
 		if !found {
 			w.Header().Set("Content-Type", "application/json")
@@ -304,13 +471,49 @@ func ServeWeb(webConfig HttpServerConfig) {
 			"username":   storedPat.Username,
 			"stored_at":  storedPat.SetAt.Format(time.RFC3339),
 		}
-		if !storedPat.ExpiresAt.IsZero() {
+		if days, expires := storedPat.ExpiresInDays(time.Now()); expires {
 			response["expires_at"] = storedPat.ExpiresAt.Format(time.RFC3339)
+			response["expires_in_days"] = days
 		}
 		_ = json.NewEncoder(w).Encode(response)
 	})
 
-	http.HandleFunc("DELETE /api/v0/config/pat", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("GET /api/v0/config/pat/diagnosis", func(w http.ResponseWriter, r *http.Request) {
+		storedPat, found, err := webConfig.Store.GetPAT()
+		if err != nil {
+			webConfig.Logger.Error("could not read PAT", slog.Any("error", err))
+			writeJsonError(w, webConfig.Logger, http.StatusInternalServerError, "could not read token")
+			return
+		}
+		if !found {
+			writeJsonError(w, webConfig.Logger, http.StatusNotFound, "no token is configured")
+			return
+		}
+		d, err := github.DiagnosePAT(r.Context(), github.DefaultAPIURL, storedPat.Token, webConfig.Logger)
+		if err != nil {
+			webConfig.Logger.Warn("could not diagnose PAT", slog.Any("error", err))
+			writeJsonError(w, webConfig.Logger, http.StatusBadGateway, "could not diagnose token: "+err.Error())
+			return
+		}
+		response := patDiagnosisV0{
+			Username:    d.Username,
+			TokenType:   d.TokenType,
+			Scopes:      d.Scopes,
+			Repo:        d.Repo,
+			Permissions: make([]permissionCheckV0, 0, len(d.Permissions)),
+			Warnings:    d.Warnings,
+			Ok:          d.Ok(),
+		}
+		if !d.ExpiresAt.IsZero() {
+			response.ExpiresAt = d.ExpiresAt.Format(time.RFC3339)
+		}
+		for _, p := range d.Permissions {
+			response.Permissions = append(response.Permissions, permissionCheckV0{Permission: p.Permission, Ok: p.Ok, Skipped: p.Skipped, Detail: p.Detail})
+		}
+		writeJson(w, webConfig.Logger, http.StatusOK, response)
+	})
+
+	mux.HandleFunc("DELETE /api/v0/config/pat", func(w http.ResponseWriter, r *http.Request) {
 		if err := webConfig.Store.ClearPAT(); err != nil {
 			webConfig.Logger.Error("could not clear PAT", slog.Any("error", err))
 			w.WriteHeader(http.StatusInternalServerError)
@@ -318,12 +521,56 @@ func ServeWeb(webConfig HttpServerConfig) {
 			return
 		}
 
-		webConfig.Tracker.Stop()
-
+		// without a PAT, the refreshes are skipped until a new one is stored
 		w.WriteHeader(http.StatusNoContent)
 	})
 
-	webConfig.Logger.Info("starting web server at", slog.String("url", "http://"+webConfig.Url))
-	serverErr := http.ListenAndServe(webConfig.Url, nil)
-	check(serverErr)
+	mux.HandleFunc("POST /api/v0/admin/backup", func(w http.ResponseWriter, r *http.Request) {
+		if webConfig.Backups == nil {
+			writeJsonError(w, webConfig.Logger, http.StatusNotFound, "backups are only made of SQLite databases")
+			return
+		}
+		path, err := webConfig.Backups.Run(r.Context())
+		if err != nil {
+			webConfig.Logger.Error("backup failed", slog.Any("error", err))
+			writeJsonError(w, webConfig.Logger, http.StatusInternalServerError, "backup failed, see elly's logs")
+			return
+		}
+		writeJson(w, webConfig.Logger, http.StatusOK, map[string]any{"path": path})
+	})
+
+	// the user's curation (buried PRs etc.), for moving between machines
+	mux.HandleFunc("GET /api/v0/state", func(w http.ResponseWriter, r *http.Request) {
+		state, err := storage.Export(webConfig.Store, time.Now())
+		if err != nil {
+			webConfig.Logger.Error("could not export state", slog.Any("error", err))
+			writeJsonError(w, webConfig.Logger, http.StatusInternalServerError, "could not export state")
+			return
+		}
+		w.Header().Set("Content-Disposition", `attachment; filename="elly-state.json"`)
+		writeJson(w, webConfig.Logger, http.StatusOK, state)
+	})
+
+	mux.HandleFunc("POST /api/v0/state", func(w http.ResponseWriter, r *http.Request) {
+		var state storage.ExportedState
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxStateBytes)).Decode(&state); err != nil {
+			writeJsonError(w, webConfig.Logger, http.StatusBadRequest, "invalid JSON: "+err.Error())
+			return
+		}
+		counts, err := storage.Import(webConfig.Store, state, time.Now())
+		if errors.Is(err, storage.ErrInvalidState) {
+			writeJsonError(w, webConfig.Logger, http.StatusBadRequest, err.Error())
+			return
+		} else if err != nil {
+			webConfig.Logger.Error("could not import state", slog.Any("error", err))
+			writeJsonError(w, webConfig.Logger, http.StatusInternalServerError, "could not import state")
+			return
+		}
+		writeJson(w, webConfig.Logger, http.StatusOK, counts)
+	})
+
+	registerApiV1(mux, webConfig)
+	registerAuth(mux, webConfig)
+
+	return mux
 }
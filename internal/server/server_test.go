@@ -0,0 +1,364 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chelmertz/elly/internal/backoff"
+	"github.com/chelmertz/elly/internal/storage"
+	"github.com/chelmertz/elly/internal/types"
+)
+
+func TestIndex_UsesQueryString(t *testing.T) {
+	srv := testServer(t)
+
+	resp, err := http.Get(srv.URL + "/?groupBy=repo&q=%3Cscript%3E")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	if !strings.Contains(string(body), "No PRs match the filters") {
+		t.Error("expected the title search to filter out all demo PRs")
+	}
+	if strings.Contains(string(body), "q=<script>") {
+		t.Error("the query string must be escaped when rendered")
+	}
+
+	resp, err = http.Get(srv.URL + "/?sort=random")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("got status %d for an invalid filter, want %d", resp.StatusCode, http.StatusBadRequest)
+	}
+}
+
+func TestIndex_GroupsPrs(t *testing.T) {
+	srv := testServer(t)
+
+	resp, err := http.Get(srv.URL + "/?groupBy=repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(body), `<h2 class="group">chelmertz/api (1)</h2>`) {
+		t.Error("expected a heading per repo")
+	}
+}
+
+func TestIndex_EscapesNotes(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	store := storage.NewMemoryStorage(logger)
+	pr := types.ViewPr{Url: "https://github.com/o/r/pull/1", Title: "Waiting", Author: "you", RepoOwner: "o", RepoName: "r", LastUpdated: time.Now()}
+	if err := store.StoreRepoPrs([]types.ViewPr{pr}); err != nil {
+		t.Fatal(err)
+	}
+	// the note's first line is a reason for its points as well
+	if err := store.StoreNote(storage.StoredNote{PrUrl: pr.Url, Text: "<img src=x onerror=alert(1)>", Points: 10, UpdatedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(newMux(HttpServerConfig{Store: store, Logger: logger}))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(body), "<img src=x") {
+		t.Error("expected the note to be escaped everywhere")
+	}
+	if !strings.Contains(string(body), "Note: &lt;img src=x onerror=alert(1)&gt;") {
+		t.Error("expected the note as an escaped reason")
+	}
+}
+
+func TestApiV0Prs_ListsBuriedPrsWhenAskedFor(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	store := storage.NewMemoryStorage(logger)
+	pr := types.ViewPr{Url: "https://github.com/o/r/pull/1", Title: "Someday", Author: "you", RepoOwner: "o", RepoName: "r", LastUpdated: time.Now()}
+	if err := store.StoreRepoPrs([]types.ViewPr{pr}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Bury(pr.Url); err != nil {
+		t.Fatal(err)
+	}
+	// below the -999 that hides buried PRs by default
+	if err := store.StoreNote(storage.StoredNote{PrUrl: pr.Url, Text: "never", Points: -500, UpdatedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(newMux(HttpServerConfig{Store: store, Logger: logger}))
+	defer srv.Close()
+
+	for query, want := range map[string]int{"": 0, "?buried=true": 1} {
+		var prs []types.ViewPr
+		if err := json.Unmarshal(getJson(t, srv.URL+"/api/v0/prs"+query, http.StatusOK), &prs); err != nil {
+			t.Fatalf("could not unmarshal response: %v", err)
+		}
+		if len(prs) != want {
+			t.Errorf("/api/v0/prs%s: got %d PRs, want %d", query, len(prs), want)
+		}
+	}
+}
+
+func TestIndex_ShowsRateLimitBudget(t *testing.T) {
+	srv := testServer(t)
+
+	resp, err := http.Get(srv.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// as told by the demo storage
+	if !strings.Contains(string(body), "4321 of 5000 points left, resets at <time") {
+		t.Error("expected the rate limit budget in the sidebar")
+	}
+}
+
+func TestIndex_ShowsWhyPollingIsPaused(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	tracker := backoff.New(logger, time.Hour, backoff.Schedule{}, types.BackoffState{})
+	defer tracker.Stop()
+	tracker.NeedsAttention("github response code <403>")
+	srv := httptest.NewServer(newMux(HttpServerConfig{Store: storage.NewStorageDemo(), Logger: logger, Tracker: tracker}))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(body), "Refreshing paused: github response code &lt;403&gt;") {
+		t.Error("expected the escaped reason in the sidebar")
+	}
+
+	// retrying resumes polling
+	resp, err = http.Post(srv.URL+"/api/v0/prs/refresh", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got := tracker.Attention(); got != "" {
+		t.Errorf("expected polling to be resumed, still paused since %q", got)
+	}
+}
+
+func TestIndex_ShowsRefreshStatus(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	tracker := backoff.New(logger, time.Hour, backoff.Schedule{}, types.BackoffState{})
+	defer tracker.Stop()
+	tracker.ServerErrored()
+	srv := httptest.NewServer(newMux(HttpServerConfig{Store: storage.NewStorageDemo(), Logger: logger, Tracker: tracker}))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"interval ×1.5, next at <time",
+		// as told by the demo storage
+		"server error: github returned server error: github response code 502.",
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("expected %q in the status panel", want)
+		}
+	}
+}
+
+func TestRefreshes_ListsTheHistory(t *testing.T) {
+	srv := testServer(t)
+
+	resp, err := http.Get(srv.URL + "/api/v0/refreshes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var got struct {
+		Refreshes []map[string]any
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	// as told by the demo storage, latest first
+	if len(got.Refreshes) != 2 || got.Refreshes[0]["outcome"] != types.RefreshSucceeded || got.Refreshes[1]["error_class"] != types.ErrorClassServer {
+		t.Fatalf("expected the demo's refreshes, got %+v", got.Refreshes)
+	}
+	if _, found := got.Refreshes[0]["error"]; found {
+		t.Errorf("expected no error for a successful refresh, got %+v", got.Refreshes[0])
+	}
+}
+
+func TestIndex_WarnsWhenThePatExpires(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	store := storage.NewMemoryStorage(logger)
+	srv := httptest.NewServer(newMux(HttpServerConfig{Store: store, Logger: logger}))
+	defer srv.Close()
+
+	for _, tt := range []struct {
+		expiresAt time.Time
+		want      string
+	}{
+		{expiresAt: time.Now().Add(30 * 24 * time.Hour), want: ""},
+		{expiresAt: time.Time{}, want: ""},
+		{expiresAt: time.Now().Add(3*24*time.Hour + time.Hour), want: "The Github PAT expires in 3 days, <time"},
+		{expiresAt: time.Now().Add(-time.Hour), want: "The Github PAT has expired, <time"},
+	} {
+		if err := store.StorePAT("token", "me", tt.expiresAt); err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.Get(srv.URL + "/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		banner := strings.Contains(string(body), `class="banner pat-expiry"`)
+		if tt.want == "" && banner {
+			t.Errorf("expiring at %v: expected no banner", tt.expiresAt)
+		}
+		if tt.want != "" && (!banner || !strings.Contains(string(body), tt.want)) {
+			t.Errorf("expiring at %v: expected a banner saying %q", tt.expiresAt, tt.want)
+		}
+	}
+}
+
+func TestPatDiagnosis_WithoutAPat(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	srv := httptest.NewServer(newMux(HttpServerConfig{Store: storage.NewMemoryStorage(logger), Logger: logger}))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/api/v0/config/pat/diagnosis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var got struct {
+		Error string
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusNotFound || got.Error == "" {
+		t.Errorf("expected a 404 with an error, got %d %+v", resp.StatusCode, got)
+	}
+}
+
+func TestServeWeb_StopsWhenCancelled(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "elly.sock")
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- ServeWeb(ctx, HttpServerConfig{
+			Store:  storage.NewStorageDemo(),
+			Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+			Listen: ListenConfig{UnixSocket: socket, UnixSocketMode: 0o600},
+		})
+	}()
+
+	// wait for the server to listen
+	for range 100 {
+		if _, err := os.Stat(socket); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("expected a clean shutdown, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ServeWeb did not return after cancelling")
+	}
+}
+
+func TestAdminBackup(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	dir := t.TempDir()
+	store, err := storage.NewStorage(logger, filepath.Join(dir, "elly.db"))
+	if err != nil {
+		t.Fatalf("NewStorage failed: %v", err)
+	}
+	defer store.Close()
+	backupDir := filepath.Join(dir, "backups")
+	srv := httptest.NewServer(newMux(HttpServerConfig{
+		Store:   store,
+		Logger:  logger,
+		Backups: storage.NewBackups(store, backupDir, 1, logger),
+	}))
+	defer srv.Close()
+
+	resp, err := http.Post(srv.URL+"/api/v0/admin/backup", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body struct {
+		Path string `json:"path"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&body)
+	resp.Body.Close()
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d and %v, want %d", resp.StatusCode, err, http.StatusOK)
+	}
+	if filepath.Dir(body.Path) != backupDir {
+		t.Errorf("expected the backup to be made in %s, got %s", backupDir, body.Path)
+	}
+	if _, err := os.Stat(body.Path); err != nil {
+		t.Errorf("expected the backup to exist: %v", err)
+	}
+
+	noBackups := testServer(t)
+	resp, err = http.Post(noBackups.URL+"/api/v0/admin/backup", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("got status %d without backups, want %d", resp.StatusCode, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chelmertz/elly/internal/storage"
+	"github.com/chelmertz/elly/internal/types"
+)
+
+func TestState_ExportAndImport(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	store := storage.NewMemoryStorage(logger)
+	pr := types.ViewPr{Url: "https://github.com/o/r/pull/1", LastUpdated: time.Date(2025, 6, 15, 12, 0, 0, 0, time.UTC)}
+	if err := store.StoreRepoPrs([]types.ViewPr{pr}); err != nil {
+		t.Fatalf("StoreRepoPrs failed: %v", err)
+	}
+	if err := store.Bury(pr.Url); err != nil {
+		t.Fatalf("Bury failed: %v", err)
+	}
+	if err := store.StoreNote(storage.StoredNote{PrUrl: pr.Url, Text: "later", UpdatedAt: pr.LastUpdated}); err != nil {
+		t.Fatalf("StoreNote failed: %v", err)
+	}
+	if err := store.AddTag(storage.StoredTag{Repo: "o/r", Tag: "low-prio"}); err != nil {
+		t.Fatalf("AddTag failed: %v", err)
+	}
+	if err := store.SetTagPoints("low-prio", -10); err != nil {
+		t.Fatalf("SetTagPoints failed: %v", err)
+	}
+	if _, err := store.AddRule(types.Rule{Author: "*[bot]", Action: types.RuleExclude}); err != nil {
+		t.Fatalf("AddRule failed: %v", err)
+	}
+	srv := httptest.NewServer(newMux(HttpServerConfig{Store: store, Logger: logger}))
+	defer srv.Close()
+
+	exported := getJson(t, srv.URL+"/api/v0/state", http.StatusOK)
+	var state storage.ExportedState
+	if err := json.Unmarshal(exported, &state); err != nil {
+		t.Fatalf("could not unmarshal the export: %v", err)
+	}
+	if state.Version != storage.ExportVersion || len(state.Buried) != 1 || state.Buried[0].Url != pr.Url {
+		t.Fatalf("expected the buried PR to be exported, got %s", exported)
+	}
+
+	if err := store.Unbury(pr.Url); err != nil {
+		t.Fatalf("Unbury failed: %v", err)
+	}
+	resp, err := http.Post(srv.URL+"/api/v0/state", "application/json", strings.NewReader(string(exported)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d when importing, want %d", resp.StatusCode, http.StatusOK)
+	}
+	var counts storage.ImportCounts
+	if err := json.NewDecoder(resp.Body).Decode(&counts); err != nil {
+		t.Fatalf("could not decode the import's response: %v", err)
+	}
+	// the rule was already stored
+	if want := (storage.ImportCounts{Buried: 1, Notes: 1, Tags: 1, TagPoints: 1}); counts != want {
+		t.Errorf("got %+v imported, want %+v", counts, want)
+	}
+	got, _, err := store.GetPr(pr.Url)
+	if err != nil {
+		t.Fatalf("GetPr failed: %v", err)
+	}
+	if !got.Buried {
+		t.Error("expected the import to bury the PR again")
+	}
+
+	for _, body := range []string{"not json", `{"version": 999}`} {
+		resp, err := http.Post(srv.URL+"/api/v0/state", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("got status %d when importing %q, want %d", resp.StatusCode, body, http.StatusBadRequest)
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+const (
+	backupPrefix = "elly-"
+	backupSuffix = ".db"
+	// sorts the same lexically as chronologically, with nanoseconds so that
+	// backups made within the same second (scheduled, manual, at startup)
+	// don't replace each other
+	backupTimeFormat = "20060102T150405.000000000Z"
+	// parses backupTimeFormat, and the names from before it had nanoseconds
+	backupTimeLayout = "20060102T150405Z"
+)
+
+// Backups copies a SQLite database into Dir while it's in use, keeping the
+// Keep latest copies.
+type Backups struct {
+	store  *DbStorage
+	dir    string
+	keep   int
+	logger *slog.Logger
+
+	mu sync.Mutex // one backup at a time, they'd get the same name otherwise
+}
+
+func NewBackups(store *DbStorage, dir string, keep int, logger *slog.Logger) *Backups {
+	return &Backups{store: store, dir: dir, keep: max(keep, 1), logger: logger}
+}
+
+func (b *Backups) Dir() string {
+	return b.dir
+}
+
+// Run makes a new backup and removes the ones that are too old. It returns
+// the path of the new backup.
+func (b *Backups) Run(ctx context.Context) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	path, err := b.run(ctx)
+	if err != nil {
+		backupsTotal.WithLabelValues("error").Inc()
+		return "", err
+	}
+	backupsTotal.WithLabelValues("ok").Inc()
+	lastBackupTimestamp.SetToCurrentTime()
+	return path, nil
+}
+
+func (b *Backups) run(ctx context.Context) (string, error) {
+	if err := os.MkdirAll(b.dir, 0o700); err != nil {
+		return "", fmt.Errorf("could not create backup directory: %w", err)
+	}
+
+	path := filepath.Join(b.dir, backupPrefix+time.Now().UTC().Format(backupTimeFormat)+backupSuffix)
+	// VACUUM INTO refuses to overwrite, and a half-written backup must never
+	// look like a complete one
+	tmpPath := path + ".tmp"
+	if err := os.Remove(tmpPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("could not remove old temporary backup: %w", err)
+	}
+	if _, err := b.store.rawDb.ExecContext(ctx, "vacuum into ?", tmpPath); err != nil {
+		os.Remove(tmpPath) //nolint:errcheck // the vacuum error is more interesting
+		return "", fmt.Errorf("could not back up database: %w", err)
+	}
+	// never replace a backup, it would throw off how many are kept
+	if _, err := os.Lstat(path); err == nil {
+		os.Remove(tmpPath) //nolint:errcheck // the existing backup is more interesting
+		return "", fmt.Errorf("backup %s already exists", path)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return "", fmt.Errorf("could not move backup into place: %w", err)
+	}
+	b.logger.Info("backed up database", slog.String("path", path))
+
+	backups, err := listBackups(b.dir)
+	if err != nil {
+		return path, fmt.Errorf("could not list backups to remove old ones: %w", err)
+	}
+	for len(backups) > b.keep {
+		if err := os.Remove(backups[0]); err != nil {
+			return path, fmt.Errorf("could not remove old backup: %w", err)
+		}
+		b.logger.Debug("removed old backup", slog.String("path", backups[0]))
+		backups = backups[1:]
+	}
+	return path, nil
+}
+
+// RunEvery makes a backup every interval, until ctx is cancelled. The first
+// one is made right away if the latest backup is older than interval, so
+// that an elly that is restarted often still gets backed up.
+func (b *Backups) RunEvery(ctx context.Context, interval time.Duration) {
+	wait := time.Duration(0)
+	if latest, ok := b.latest(); ok {
+		wait = max(interval-time.Since(latest), 0)
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+			if _, err := b.Run(ctx); err != nil && ctx.Err() == nil {
+				b.logger.Error("scheduled backup failed", slog.Any("error", err))
+			}
+			timer.Reset(interval)
+		}
+	}
+}
+
+// latest returns when the latest backup was made.
+func (b *Backups) latest() (time.Time, bool) {
+	backups, err := listBackups(b.dir)
+	if err != nil || len(backups) == 0 {
+		return time.Time{}, false
+	}
+	name := filepath.Base(backups[len(backups)-1])
+	made, err := time.Parse(backupTimeLayout, strings.TrimSuffix(strings.TrimPrefix(name, backupPrefix), backupSuffix))
+	if err != nil {
+		return time.Time{}, false
+	}
+	return made, true
+}
+
+// listBackups returns the backups in dir, oldest first.
+func listBackups(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var backups []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.Type().IsRegular() && strings.HasPrefix(name, backupPrefix) && strings.HasSuffix(name, backupSuffix) {
+			backups = append(backups, filepath.Join(dir, name))
+		}
+	}
+	slices.Sort(backups)
+	return backups, nil
+}
+
+// errCorrupt is returned by checkIntegrity when the database is corrupt, as
+// opposed to e.g. unreadable.
+var errCorrupt = errors.New("database is corrupt")
+
+// checkIntegrity runs SQLite's integrity check on the database at path.
+func checkIntegrity(path string) error {
+	db, err := sql.Open("sqlite", fmt.Sprintf("file:%s?mode=rw", path))
+	if err != nil {
+		return err
+	}
+	defer db.Close() //nolint:errcheck // only read from
+
+	rows, err := db.Query("pragma integrity_check")
+	if err != nil {
+		return sqliteCorruption(err)
+	}
+	defer rows.Close() //nolint:errcheck // only read from
+	var problems []string
+	for rows.Next() {
+		var result string
+		if err := rows.Scan(&result); err != nil {
+			return sqliteCorruption(err)
+		}
+		if result != "ok" {
+			problems = append(problems, result)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return sqliteCorruption(err)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", errCorrupt, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// sqliteCorruption wraps err with errCorrupt if SQLite says that the file
+// is corrupt, or not a database at all.
+func sqliteCorruption(err error) error {
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		// extended codes keep the primary code in the lowest byte
+		switch sqliteErr.Code() & 0xff {
+		case sqlite3.SQLITE_CORRUPT, sqlite3.SQLITE_NOTADB:
+			return fmt.Errorf("%w: %w", errCorrupt, err)
+		}
+	}
+	return err
+}
+
+// RestoreIfCorrupt checks the database at dbPath, and replaces it with the
+// latest backup in backupDir that passes the check, if it's corrupt. The
+// corrupt database is kept next to it, as dbPath.corrupt-<time>. It returns
+// the restored backup, or "" if nothing was restored.
+func RestoreIfCorrupt(logger *slog.Logger, dbPath, backupDir string) (string, error) {
+	if _, err := os.Stat(dbPath); errors.Is(err, os.ErrNotExist) {
+		// first start
+		return "", nil
+	}
+	checkErr := checkIntegrity(dbPath)
+	if checkErr == nil {
+		return "", nil
+	}
+	if !errors.Is(checkErr, errCorrupt) {
+		// e.g. a permission problem, that a backup wouldn't fix
+		return "", fmt.Errorf("could not check the database: %w", checkErr)
+	}
+	logger.Error("database is corrupt, looking for a backup", slog.String("db", dbPath), slog.Any("error", checkErr))
+
+	backups, err := listBackups(backupDir)
+	if err != nil {
+		return "", fmt.Errorf("database is corrupt (%w), and could not list backups: %w", checkErr, err)
+	}
+	var restoreFrom string
+	for _, backup := range slices.Backward(backups) {
+		if err := checkIntegrity(backup); err != nil {
+			logger.Warn("backup is corrupt too, skipping it", slog.String("backup", backup), slog.Any("error", err))
+			continue
+		}
+		restoreFrom = backup
+		break
+	}
+	if restoreFrom == "" {
+		return "", fmt.Errorf("database is corrupt (%w), and there is no good backup in %s", checkErr, backupDir)
+	}
+
+	corruptPath := dbPath + ".corrupt-" + time.Now().UTC().Format(backupTimeFormat)
+	if err := os.Rename(dbPath, corruptPath); err != nil {
+		return "", fmt.Errorf("could not move the corrupt database aside: %w", err)
+	}
+	// the WAL belongs to the corrupt database, and must not be applied to
+	// the backup
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if err := os.Rename(dbPath+suffix, corruptPath+suffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return "", fmt.Errorf("could not move the corrupt database aside: %w", err)
+		}
+	}
+	if err := copyFile(restoreFrom, dbPath); err != nil {
+		return "", fmt.Errorf("could not restore %s: %w", restoreFrom, err)
+	}
+	logger.Warn("restored database from backup", slog.String("backup", restoreFrom), slog.String("corrupt_db", corruptPath))
+	return restoreFrom, nil
+}
+
+func copyFile(from, to string) error {
+	in, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer in.Close() //nolint:errcheck // read only
+
+	out, err := os.OpenFile(to, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()   //nolint:errcheck // the copy error is more interesting
+		os.Remove(to) //nolint:errcheck // the copy error is more interesting
+		return err
+	}
+	return out.Close()
+}
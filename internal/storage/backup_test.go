@@ -0,0 +1,178 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chelmertz/elly/internal/types"
+)
+
+func storeWithPr(t *testing.T, path string) *DbStorage {
+	t.Helper()
+	store, err := NewStorage(slog.New(slog.NewTextHandler(io.Discard, nil)), path)
+	if err != nil {
+		t.Fatalf("NewStorage failed: %v", err)
+	}
+	pr := types.ViewPr{Url: "https://github.com/o/r/pull/1", Title: "backed up", LastUpdated: time.Now(), RawJsonResponse: []byte(`{}`)}
+	if err := store.StoreRepoPrs([]types.ViewPr{pr}); err != nil {
+		t.Fatalf("StoreRepoPrs failed: %v", err)
+	}
+	return store
+}
+
+func TestBackups_KeepsTheLatestCopies(t *testing.T) {
+	dir := t.TempDir()
+	backupDir := filepath.Join(dir, "backups")
+	store := storeWithPr(t, filepath.Join(dir, "elly.db"))
+	defer store.Close() //nolint:errcheck // test cleanup
+
+	if err := os.MkdirAll(backupDir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	for _, old := range []string{"elly-20200101T000000Z.db", "elly-20200102T000000Z.db"} {
+		if err := os.WriteFile(filepath.Join(backupDir, old), nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// not a backup, must be left alone
+	if err := os.WriteFile(filepath.Join(backupDir, "notes.txt"), nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	backups := NewBackups(store, backupDir, 2, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	path, err := backups.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	entries, err := os.ReadDir(backupDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	want := []string{"elly-20200102T000000Z.db", filepath.Base(path), "notes.txt"}
+	if strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Errorf("got backup dir %v, want %v", names, want)
+	}
+
+	if err := checkIntegrity(path); err != nil {
+		t.Fatalf("expected a good backup, got %v", err)
+	}
+	backup, err := NewStorage(slog.New(slog.NewTextHandler(io.Discard, nil)), path)
+	if err != nil {
+		t.Fatalf("could not open the backup: %v", err)
+	}
+	defer backup.Close() //nolint:errcheck // test cleanup
+	if prs := storedPrs(t, backup); len(prs) != 1 || prs[0].Title != "backed up" {
+		t.Errorf("expected the backup to contain the PR, got %+v", prs)
+	}
+}
+
+func TestBackups_WithinTheSameSecondAreKept(t *testing.T) {
+	dir := t.TempDir()
+	backupDir := filepath.Join(dir, "backups")
+	store := storeWithPr(t, filepath.Join(dir, "elly.db"))
+	defer store.Close() //nolint:errcheck // test cleanup
+
+	backups := NewBackups(store, backupDir, 5, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	var paths []string
+	for range 3 {
+		path, err := backups.Run(context.Background())
+		if err != nil {
+			t.Fatalf("Run failed: %v", err)
+		}
+		paths = append(paths, path)
+	}
+	listed, err := listBackups(backupDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(listed, paths) {
+		t.Errorf("expected every backup to be kept, in order, got %v (made %v)", listed, paths)
+	}
+	if _, ok := backups.latest(); !ok {
+		t.Error("expected the latest backup's time to be parsed from its name")
+	}
+}
+
+func TestBackups_LatestOfOldNames(t *testing.T) {
+	backupDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(backupDir, "elly-20200102T030405Z.db"), nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	latest, ok := (&Backups{dir: backupDir}).latest()
+	if want := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC); !ok || !latest.Equal(want) {
+		t.Errorf("expected %v, got %v (found: %v)", want, latest, ok)
+	}
+}
+
+func TestRestoreIfCorrupt(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "elly.db")
+	backupDir := filepath.Join(dir, "backups")
+
+	store := storeWithPr(t, dbPath)
+	if _, err := NewBackups(store, backupDir, 3, logger).Run(context.Background()); err != nil {
+		t.Fatalf("backup failed: %v", err)
+	}
+	store.Close() //nolint:errcheck // corrupted below
+
+	restored, err := RestoreIfCorrupt(logger, dbPath, backupDir)
+	if err != nil || restored != "" {
+		t.Fatalf("expected a good database to be left alone, got %q, %v", restored, err)
+	}
+
+	// a newer, but corrupt, backup must be skipped
+	if err := os.WriteFile(filepath.Join(backupDir, "elly-29990101T000000Z.db"), []byte(strings.Repeat("garbage ", 100)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dbPath, []byte(strings.Repeat("garbage ", 1000)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err = RestoreIfCorrupt(logger, dbPath, backupDir)
+	if err != nil {
+		t.Fatalf("RestoreIfCorrupt failed: %v", err)
+	}
+	if restored == "" || strings.Contains(restored, "2999") {
+		t.Fatalf("expected the good backup to be restored, got %q", restored)
+	}
+	corrupt, err := filepath.Glob(dbPath + ".corrupt-*")
+	if err != nil || len(corrupt) != 1 {
+		t.Errorf("expected the corrupt database to be kept, got %v", corrupt)
+	}
+
+	store, err = NewStorage(logger, dbPath)
+	if err != nil {
+		t.Fatalf("could not open the restored database: %v", err)
+	}
+	defer store.Close() //nolint:errcheck // test cleanup
+	if prs := storedPrs(t, store); len(prs) != 1 || prs[0].Title != "backed up" {
+		t.Errorf("expected the restored database to contain the PR, got %+v", prs)
+	}
+}
+
+func TestRestoreIfCorrupt_FailsWithoutBackups(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "elly.db")
+	if err := os.WriteFile(dbPath, []byte(strings.Repeat("garbage ", 1000)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	_, err := RestoreIfCorrupt(slog.New(slog.NewTextHandler(io.Discard, nil)), dbPath, filepath.Join(t.TempDir(), "backups"))
+	if err == nil {
+		t.Fatal("expected an error when there's nothing to restore from")
+	}
+	if _, statErr := os.Stat(dbPath); statErr != nil {
+		t.Errorf("expected the corrupt database to be left in place, got %v", statErr)
+	}
+}
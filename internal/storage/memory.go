@@ -0,0 +1,418 @@
+package storage
+
+import (
+	"cmp"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chelmertz/elly/internal/types"
+)
+
+// MemoryStorage keeps everything in memory, and behaves like DbStorage
+// otherwise. Useful for tests and for ephemeral containers, where the buried
+// PRs and the PAT may just as well be forgotten on restart.
+type MemoryStorage struct {
+	mu     sync.RWMutex
+	logger *slog.Logger
+
+	prs         []types.ViewPr
+	lastFetched time.Time
+	buried      map[string]StoredBury
+	notes       map[string]StoredNote
+	tags        map[StoredTag]bool
+	tagPoints   map[string]int
+	rules       []types.Rule
+	lastRuleId  int64
+
+	rateLimitUntil    time.Time
+	rateLimitBudget   *types.RateLimitBudget
+	backoffState      *types.BackoffState
+	refreshes         []types.Refresh // latest first
+	patExpiryNotified time.Time
+	pat               *StoredPAT
+	apiToken          string
+}
+
+var _ Storage = (*MemoryStorage)(nil)
+
+func NewMemoryStorage(logger *slog.Logger) *MemoryStorage {
+	return &MemoryStorage{logger: logger, buried: make(map[string]StoredBury), notes: make(map[string]StoredNote), tags: make(map[StoredTag]bool), tagPoints: make(map[string]int)}
+}
+
+// clonePr makes sure that callers can't modify the stored PRs, and vice versa.
+func clonePr(pr types.ViewPr) types.ViewPr {
+	pr.ReviewRequestedFromUsers = slices.Clone(pr.ReviewRequestedFromUsers)
+	pr.RawJsonResponse = slices.Clone(pr.RawJsonResponse)
+	pr.ReviewThreads = slices.Clone(pr.ReviewThreads)
+	return pr
+}
+
+func (s *MemoryStorage) Prs() (StoredState, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	prs := make([]types.ViewPr, 0, len(s.prs))
+	for _, pr := range s.prs {
+		prs = append(prs, s.withNote(clonePr(pr)))
+	}
+	withTags(prs, s.sortedTags(), s.tagPoints)
+	withRules(prs, s.rules)
+	return StoredState{Prs: prs, LastFetched: s.lastFetched}, nil
+}
+
+func (s *MemoryStorage) StoreRepoPrs(orderedPrs []types.ViewPr) error {
+	s.logger.Debug("storing prs", slog.Int("prs", len(orderedPrs)))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lastUpdatedPerBuriedUrl := make(map[string]string, len(s.buried))
+	for url, b := range s.buried {
+		lastUpdatedPerBuriedUrl[url] = b.LastUpdated.Format(time.RFC3339)
+	}
+	keepBuried(s.logger, orderedPrs, lastUpdatedPerBuriedUrl)
+	for _, url := range outdatedBuries(orderedPrs, lastUpdatedPerBuriedUrl) {
+		delete(s.buried, url)
+	}
+
+	prs := make([]types.ViewPr, 0, len(orderedPrs))
+	for _, pr := range orderedPrs {
+		stored := clonePr(pr)
+		// DbStorage stores times with second precision
+		stored.LastUpdated = stored.LastUpdated.Truncate(time.Second)
+		prs = append(prs, stored)
+	}
+	s.prs = prs
+	s.lastFetched = time.Now().Truncate(time.Second)
+
+	trackPRs(orderedPrs)
+
+	return nil
+}
+
+func (s *MemoryStorage) Bury(prUrl string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.prs {
+		if s.prs[i].Url == prUrl {
+			s.prs[i].Buried = true
+			s.buried[prUrl] = StoredBury{Url: prUrl, LastUpdated: s.prs[i].LastUpdated, BuriedAt: time.Now().UTC().Truncate(time.Second)}
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStorage) Unbury(prUrl string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.prs {
+		if s.prs[i].Url == prUrl {
+			s.prs[i].Buried = false
+		}
+	}
+	delete(s.buried, prUrl)
+	return nil
+}
+
+func (s *MemoryStorage) BuriedPrs() ([]StoredBury, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	buried := make([]StoredBury, 0, len(s.buried))
+	for _, b := range s.buried {
+		buried = append(buried, b)
+	}
+	slices.SortFunc(buried, func(a, b StoredBury) int { return strings.Compare(a.Url, b.Url) })
+	return buried, nil
+}
+
+func (s *MemoryStorage) ImportState(state StateImport) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, b := range state.Buried {
+		b.LastUpdated = b.LastUpdated.Truncate(time.Second)
+		b.BuriedAt = b.BuriedAt.Truncate(time.Second)
+		s.buried[b.Url] = b
+		for i := range s.prs {
+			if s.prs[i].Url == b.Url && s.prs[i].LastUpdated.Equal(b.LastUpdated) {
+				s.prs[i].Buried = true
+			}
+		}
+	}
+	for _, note := range state.Notes {
+		note.UpdatedAt = note.UpdatedAt.UTC().Truncate(time.Second)
+		s.notes[note.PrUrl] = note
+	}
+	for _, tag := range state.Tags {
+		s.tags[tag] = true
+	}
+	for tag, points := range state.TagPoints {
+		if points == 0 {
+			delete(s.tagPoints, tag)
+		} else {
+			s.tagPoints[tag] = points
+		}
+	}
+	added := newRules(s.rules, state.Rules)
+	for _, rule := range added {
+		s.lastRuleId++
+		rule.Id = s.lastRuleId
+		s.rules = append(s.rules, rule)
+	}
+	if !state.RateLimitUntil.IsZero() {
+		s.rateLimitUntil = state.RateLimitUntil.Truncate(time.Second)
+	}
+	return len(added), nil
+}
+
+func (s *MemoryStorage) Notes() ([]StoredNote, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	notes := make([]StoredNote, 0, len(s.notes))
+	for _, note := range s.notes {
+		notes = append(notes, note)
+	}
+	slices.SortFunc(notes, func(a, b StoredNote) int { return strings.Compare(a.PrUrl, b.PrUrl) })
+	return notes, nil
+}
+
+func (s *MemoryStorage) StoreNote(note StoredNote) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	note.UpdatedAt = note.UpdatedAt.UTC().Truncate(time.Second)
+	s.notes[note.PrUrl] = note
+	return nil
+}
+
+func (s *MemoryStorage) DeleteNote(prUrl string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.notes, prUrl)
+	return nil
+}
+
+// withNote must be called with s.mu held.
+func (s *MemoryStorage) withNote(pr types.ViewPr) types.ViewPr {
+	note := s.notes[pr.Url]
+	pr.Note, pr.NotePoints = note.Text, note.Points
+	return pr
+}
+
+func (s *MemoryStorage) Tags() ([]StoredTag, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.sortedTags(), nil
+}
+
+// sortedTags must be called with s.mu held.
+func (s *MemoryStorage) sortedTags() []StoredTag {
+	tags := make([]StoredTag, 0, len(s.tags))
+	for tag := range s.tags {
+		tags = append(tags, tag)
+	}
+	slices.SortFunc(tags, func(a, b StoredTag) int {
+		return cmp.Or(strings.Compare(a.Tag, b.Tag), strings.Compare(a.PrUrl, b.PrUrl), strings.Compare(a.Repo, b.Repo))
+	})
+	return tags
+}
+
+func (s *MemoryStorage) AddTag(tag StoredTag) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tags[tag] = true
+	return nil
+}
+
+func (s *MemoryStorage) RemoveTag(tag StoredTag) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.tags, tag)
+	return nil
+}
+
+func (s *MemoryStorage) TagPoints() (map[string]int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return maps.Clone(s.tagPoints), nil
+}
+
+func (s *MemoryStorage) SetTagPoints(tag string, points int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if points == 0 {
+		delete(s.tagPoints, tag)
+	} else {
+		s.tagPoints[tag] = points
+	}
+	return nil
+}
+
+func (s *MemoryStorage) Rules() ([]types.Rule, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.Clone(s.rules), nil
+}
+
+func (s *MemoryStorage) AddRule(rule types.Rule) (types.Rule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastRuleId++
+	rule.Id = s.lastRuleId
+	s.rules = append(s.rules, rule)
+	return rule, nil
+}
+
+func (s *MemoryStorage) DeleteRule(id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rules = slices.DeleteFunc(s.rules, func(r types.Rule) bool { return r.Id == id })
+	return nil
+}
+
+func (s *MemoryStorage) GetPr(prUrl string) (types.ViewPr, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, pr := range s.prs {
+		if pr.Url == prUrl {
+			prs := []types.ViewPr{s.withNote(clonePr(pr))}
+			withTags(prs, s.sortedTags(), s.tagPoints)
+			withRules(prs, s.rules)
+			return prs[0], true, nil
+		}
+	}
+	return types.ViewPr{}, false, nil
+}
+
+func (s *MemoryStorage) SetRateLimitUntil(t time.Time) error {
+	hoursLeft := time.Until(t).Hours()
+	s.logger.Warn("rate limited", slog.Time("will_unblock_at", t), slog.Float64("hours_left", hoursLeft))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rateLimitUntil = t.Truncate(time.Second)
+	return nil
+}
+
+func (s *MemoryStorage) IsRateLimitActive(now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.rateLimitUntil.IsZero() {
+		return false
+	}
+	if now.Before(s.rateLimitUntil) {
+		return true
+	}
+	s.rateLimitUntil = time.Time{}
+	s.logger.Info("no longer rate limited")
+	return false
+}
+
+func (s *MemoryStorage) GetRateLimitUntil() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.rateLimitUntil
+}
+
+func (s *MemoryStorage) StoreRateLimitBudget(budget types.RateLimitBudget) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rateLimitBudget = &budget
+	return nil
+}
+
+func (s *MemoryStorage) GetRateLimitBudget() (types.RateLimitBudget, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.rateLimitBudget == nil {
+		return types.RateLimitBudget{}, false, nil
+	}
+	return *s.rateLimitBudget, true, nil
+}
+
+func (s *MemoryStorage) StoreBackoffState(state types.BackoffState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.backoffState = &state
+	return nil
+}
+
+func (s *MemoryStorage) GetBackoffState() (types.BackoffState, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.backoffState == nil {
+		return types.BackoffState{}, false, nil
+	}
+	return *s.backoffState, true, nil
+}
+
+func (s *MemoryStorage) StorePatExpiryNotified(expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.patExpiryNotified = expiresAt
+	return nil
+}
+
+func (s *MemoryStorage) GetPatExpiryNotified() (time.Time, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.patExpiryNotified, !s.patExpiryNotified.IsZero(), nil
+}
+
+func (s *MemoryStorage) StoreRefresh(refresh types.Refresh) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refreshes = append([]types.Refresh{refresh}, s.refreshes[:min(len(s.refreshes), refreshesKept-1)]...)
+	return nil
+}
+
+func (s *MemoryStorage) Refreshes() ([]types.Refresh, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.Clone(s.refreshes), nil
+}
+
+func (s *MemoryStorage) StorePAT(token, username string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pat = &StoredPAT{
+		Token:     token,
+		Username:  username,
+		SetAt:     time.Now().UTC().Truncate(time.Second),
+		ExpiresAt: expiresAt.Truncate(time.Second),
+	}
+	return nil
+}
+
+func (s *MemoryStorage) GetPAT() (StoredPAT, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.pat == nil {
+		return StoredPAT{}, false, nil
+	}
+	return *s.pat, true, nil
+}
+
+func (s *MemoryStorage) ClearPAT() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pat = nil
+	return nil
+}
+
+func (s *MemoryStorage) StoreApiToken(token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.apiToken = token
+	return nil
+}
+
+func (s *MemoryStorage) GetApiToken() (string, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.apiToken, s.apiToken != "", nil
+}
+
+func (s *MemoryStorage) Close() error {
+	return nil
+}
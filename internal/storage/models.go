@@ -4,11 +4,24 @@
 
 package storage
 
+type BuryDecision struct {
+	Url         string
+	LastUpdated string
+	BuriedAt    string
+}
+
 type Meta struct {
 	Key   string
 	Value string
 }
 
+type Note struct {
+	PrUrl     string
+	Text      string
+	Points    int64
+	UpdatedAt string
+}
+
 type Pat struct {
 	Pat       string
 	SetAt     string
@@ -36,3 +49,44 @@ type Pr struct {
 	Buried                   bool
 	RawJsonResponse          []byte
 }
+
+type Refresh struct {
+	ID         int64
+	StartedAt  string
+	DurationMs int64
+	Kind       string
+	Prs        int64
+	Outcome    string
+	ErrorClass string
+	Error      string
+}
+
+type ReviewThread struct {
+	PrUrl              string
+	Url                string
+	Actionable         bool
+	Reason             string
+	FirstCommenter     string
+	LastCommenter      string
+	LastCommentExcerpt string
+	Comments           int64
+}
+
+type Rule struct {
+	ID     int64
+	Repo   string
+	Author string
+	Action string
+	Points int64
+}
+
+type Tag struct {
+	PrUrl string
+	Repo  string
+	Tag   string
+}
+
+type TagPoint struct {
+	Tag    string
+	Points int64
+}
@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+)
+
+// Open picks the Storage implementation from a DSN:
+//
+//   - "memory:" keeps everything in memory, see MemoryStorage
+//   - "postgres://..." or "postgresql://..." connects to PostgreSQL
+//   - "sqlite:<path>" or just a path opens (or creates) a SQLite file
+func Open(logger *slog.Logger, dsn string) (Storage, error) {
+	switch {
+	case dsn == "memory:":
+		return NewMemoryStorage(logger), nil
+	case strings.HasPrefix(dsn, "postgres://"), strings.HasPrefix(dsn, "postgresql://"):
+		s, err := NewPostgresStorage(logger, dsn)
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+	path, _ := SqlitePath(dsn)
+	if path == "" {
+		return nil, fmt.Errorf("no database path given")
+	}
+	s, err := NewStorage(logger, path)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// SqlitePath returns the path of the SQLite file that Open would use for
+// dsn, or false if dsn is for another kind of storage.
+func SqlitePath(dsn string) (string, bool) {
+	if dsn == "memory:" || strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		return "", false
+	}
+	return strings.TrimPrefix(dsn, "sqlite:"), true
+}
+
+// Describe returns dsn without any password, for logging.
+func Describe(dsn string) string {
+	u, err := url.Parse(dsn)
+	if err != nil || u.User == nil {
+		return dsn
+	}
+	return u.Redacted()
+}
@@ -0,0 +1,98 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+
+package pgdb
+
+import (
+	"database/sql"
+	"time"
+)
+
+type BuryDecision struct {
+	Url         string
+	LastUpdated time.Time
+	BuriedAt    time.Time
+}
+
+type Meta struct {
+	Key   string
+	Value string
+}
+
+type Note struct {
+	PrUrl     string
+	Text      string
+	Points    int64
+	UpdatedAt time.Time
+}
+
+type Pat struct {
+	Pat       string
+	SetAt     time.Time
+	ExpiresAt sql.NullTime
+	Username  string
+	Active    bool
+}
+
+type Pr struct {
+	Url                      string
+	ReviewStatus             string
+	Title                    string
+	Author                   string
+	RepoName                 string
+	RepoOwner                string
+	RepoUrl                  string
+	IsDraft                  bool
+	LastUpdated              time.Time
+	LastPrCommenter          string
+	ThreadsActionable        int64
+	ThreadsWaiting           int64
+	Additions                int64
+	Deletions                int64
+	ReviewRequestedFromUsers []string
+	Buried                   bool
+	RawJsonResponse          []byte
+}
+
+type Refresh struct {
+	ID         int64
+	StartedAt  time.Time
+	DurationMs int64
+	Kind       string
+	Prs        int64
+	Outcome    string
+	ErrorClass string
+	Error      string
+}
+
+type ReviewThread struct {
+	ID                 int64
+	PrUrl              string
+	Url                string
+	Actionable         bool
+	Reason             string
+	FirstCommenter     string
+	LastCommenter      string
+	LastCommentExcerpt string
+	Comments           int64
+}
+
+type Rule struct {
+	ID     int64
+	Repo   string
+	Author string
+	Action string
+	Points int64
+}
+
+type Tag struct {
+	PrUrl string
+	Repo  string
+	Tag   string
+}
+
+type TagPoint struct {
+	Tag    string
+	Points int64
+}
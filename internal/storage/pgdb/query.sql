@@ -0,0 +1,181 @@
+-- name: GetPr :one
+select * from prs where url = $1 limit 1;
+
+-- name: UpsertPr :exec
+insert into prs (
+    url,
+    review_status,
+    title,
+    author,
+    repo_name,
+    repo_owner,
+    repo_url,
+    is_draft,
+    last_updated,
+    last_pr_commenter,
+    threads_actionable,
+    threads_waiting,
+    additions,
+    deletions,
+    review_requested_from_users,
+    buried,
+    raw_json_response
+) values (
+    $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17
+) on conflict (url) do update set
+    review_status = excluded.review_status,
+    title = excluded.title,
+    author = excluded.author,
+    repo_name = excluded.repo_name,
+    repo_owner = excluded.repo_owner,
+    repo_url = excluded.repo_url,
+    is_draft = excluded.is_draft,
+    last_updated = excluded.last_updated,
+    last_pr_commenter = excluded.last_pr_commenter,
+    threads_actionable = excluded.threads_actionable,
+    threads_waiting = excluded.threads_waiting,
+    additions = excluded.additions,
+    deletions = excluded.deletions,
+    review_requested_from_users = excluded.review_requested_from_users,
+    buried = excluded.buried,
+    raw_json_response = excluded.raw_json_response;
+
+-- name: DeletePr :exec
+delete from prs where url = $1;
+
+-- name: ListPrUrls :many
+select url from prs;
+
+-- name: ListPrs :many
+select * from prs order by url;
+
+-- name: CreateReviewThread :exec
+insert into review_threads (
+    pr_url,
+    url,
+    actionable,
+    reason,
+    first_commenter,
+    last_commenter,
+    last_comment_excerpt,
+    comments
+) values (
+    $1, $2, $3, $4, $5, $6, $7, $8
+);
+
+-- name: DeleteReviewThreads :exec
+delete from review_threads;
+
+-- name: ListReviewThreads :many
+select * from review_threads order by id;
+
+-- name: ListReviewThreadsForPr :many
+select * from review_threads where pr_url = $1 order by id;
+
+-- name: Bury :exec
+update prs set buried = true where url = $1;
+
+-- name: Unbury :exec
+update prs set buried = false where url = $1;
+
+-- name: BuryDecisions :many
+select * from bury_decisions order by url;
+
+-- name: StoreBuryDecision :exec
+insert into bury_decisions (url, last_updated, buried_at) values ($1, $2, $3)
+on conflict (url) do update set
+    last_updated = excluded.last_updated,
+    buried_at = excluded.buried_at;
+
+-- name: BuryStoredPr :exec
+insert into bury_decisions (url, last_updated, buried_at)
+    select prs.url, prs.last_updated, $1 from prs where prs.url = $2
+on conflict (url) do update set
+    last_updated = excluded.last_updated,
+    buried_at = excluded.buried_at;
+
+-- name: DeleteBuryDecision :exec
+delete from bury_decisions where url = $1;
+
+-- name: BuryIfUnchanged :exec
+update prs set buried = true where url = $1 and last_updated = $2;
+
+-- name: ListNotes :many
+select * from notes order by pr_url;
+
+-- name: GetNote :one
+select * from notes where pr_url = $1 limit 1;
+
+-- name: StoreNote :exec
+insert into notes (pr_url, text, points, updated_at) values ($1, $2, $3, $4)
+on conflict (pr_url) do update set
+    text = excluded.text,
+    points = excluded.points,
+    updated_at = excluded.updated_at;
+
+-- name: DeleteNote :exec
+delete from notes where pr_url = $1;
+
+-- name: ListTags :many
+select * from tags order by tag, pr_url, repo;
+
+-- name: AddTag :exec
+insert into tags (pr_url, repo, tag) values ($1, $2, $3)
+on conflict do nothing;
+
+-- name: RemoveTag :exec
+delete from tags where pr_url = $1 and repo = $2 and tag = $3;
+
+-- name: ListTagPoints :many
+select * from tag_points order by tag;
+
+-- name: StoreTagPoints :exec
+insert into tag_points (tag, points) values ($1, $2)
+on conflict (tag) do update set points = excluded.points;
+
+-- name: DeleteTagPoints :exec
+delete from tag_points where tag = $1;
+
+-- name: ListRules :many
+select * from rules order by id;
+
+-- name: AddRule :one
+insert into rules (repo, author, action, points) values ($1, $2, $3, $4)
+returning *;
+
+-- name: DeleteRule :exec
+delete from rules where id = $1;
+
+-- name: AddRefresh :exec
+insert into refreshes (started_at, duration_ms, kind, prs, outcome, error_class, error)
+values ($1, $2, $3, $4, $5, $6, $7);
+
+-- name: TrimRefreshes :exec
+delete from refreshes where id not in (select id from refreshes order by id desc limit $1);
+
+-- name: ListRefreshes :many
+select * from refreshes order by id desc;
+
+-- name: StoreMeta :exec
+insert into meta (key, value) values ($1, $2)
+on conflict (key) do update set value = excluded.value;
+
+-- name: GetMeta :one
+select value from meta where key = $1 limit 1;
+
+-- name: DeleteMeta :exec
+delete from meta where key = $1;
+
+-- name: GetActivePAT :one
+select pat, set_at, expires_at, username from pat where active limit 1;
+
+-- name: DeactivateAllPATs :exec
+update pat set active = false where active;
+
+-- name: InsertPAT :exec
+insert into pat (pat, expires_at, username, active) values ($1, $2, $3, true)
+on conflict (pat) do update set
+    set_at = date_trunc('second', now()),
+    expires_at = excluded.expires_at,
+    username = excluded.username,
+    active = true;
@@ -0,0 +1,857 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: query.sql
+
+package pgdb
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const addRefresh = `-- name: AddRefresh :exec
+insert into refreshes (started_at, duration_ms, kind, prs, outcome, error_class, error)
+values ($1, $2, $3, $4, $5, $6, $7)
+`
+
+type AddRefreshParams struct {
+	StartedAt  time.Time
+	DurationMs int64
+	Kind       string
+	Prs        int64
+	Outcome    string
+	ErrorClass string
+	Error      string
+}
+
+func (q *Queries) AddRefresh(ctx context.Context, arg AddRefreshParams) error {
+	_, err := q.db.ExecContext(ctx, addRefresh,
+		arg.StartedAt,
+		arg.DurationMs,
+		arg.Kind,
+		arg.Prs,
+		arg.Outcome,
+		arg.ErrorClass,
+		arg.Error,
+	)
+	return err
+}
+
+const addRule = `-- name: AddRule :one
+insert into rules (repo, author, action, points) values ($1, $2, $3, $4)
+returning id, repo, author, action, points
+`
+
+type AddRuleParams struct {
+	Repo   string
+	Author string
+	Action string
+	Points int64
+}
+
+func (q *Queries) AddRule(ctx context.Context, arg AddRuleParams) (Rule, error) {
+	row := q.db.QueryRowContext(ctx, addRule,
+		arg.Repo,
+		arg.Author,
+		arg.Action,
+		arg.Points,
+	)
+	var i Rule
+	err := row.Scan(
+		&i.ID,
+		&i.Repo,
+		&i.Author,
+		&i.Action,
+		&i.Points,
+	)
+	return i, err
+}
+
+const addTag = `-- name: AddTag :exec
+insert into tags (pr_url, repo, tag) values ($1, $2, $3)
+on conflict do nothing
+`
+
+type AddTagParams struct {
+	PrUrl string
+	Repo  string
+	Tag   string
+}
+
+func (q *Queries) AddTag(ctx context.Context, arg AddTagParams) error {
+	_, err := q.db.ExecContext(ctx, addTag, arg.PrUrl, arg.Repo, arg.Tag)
+	return err
+}
+
+const bury = `-- name: Bury :exec
+update prs set buried = true where url = $1
+`
+
+func (q *Queries) Bury(ctx context.Context, url string) error {
+	_, err := q.db.ExecContext(ctx, bury, url)
+	return err
+}
+
+const buryDecisions = `-- name: BuryDecisions :many
+select url, last_updated, buried_at from bury_decisions order by url
+`
+
+func (q *Queries) BuryDecisions(ctx context.Context) ([]BuryDecision, error) {
+	rows, err := q.db.QueryContext(ctx, buryDecisions)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []BuryDecision
+	for rows.Next() {
+		var i BuryDecision
+		if err := rows.Scan(&i.Url, &i.LastUpdated, &i.BuriedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const buryIfUnchanged = `-- name: BuryIfUnchanged :exec
+update prs set buried = true where url = $1 and last_updated = $2
+`
+
+type BuryIfUnchangedParams struct {
+	Url         string
+	LastUpdated time.Time
+}
+
+func (q *Queries) BuryIfUnchanged(ctx context.Context, arg BuryIfUnchangedParams) error {
+	_, err := q.db.ExecContext(ctx, buryIfUnchanged, arg.Url, arg.LastUpdated)
+	return err
+}
+
+const buryStoredPr = `-- name: BuryStoredPr :exec
+insert into bury_decisions (url, last_updated, buried_at)
+    select prs.url, prs.last_updated, $1 from prs where prs.url = $2
+on conflict (url) do update set
+    last_updated = excluded.last_updated,
+    buried_at = excluded.buried_at
+`
+
+type BuryStoredPrParams struct {
+	BuriedAt time.Time
+	Url      string
+}
+
+func (q *Queries) BuryStoredPr(ctx context.Context, arg BuryStoredPrParams) error {
+	_, err := q.db.ExecContext(ctx, buryStoredPr, arg.BuriedAt, arg.Url)
+	return err
+}
+
+const createReviewThread = `-- name: CreateReviewThread :exec
+insert into review_threads (
+    pr_url,
+    url,
+    actionable,
+    reason,
+    first_commenter,
+    last_commenter,
+    last_comment_excerpt,
+    comments
+) values (
+    $1, $2, $3, $4, $5, $6, $7, $8
+)
+`
+
+type CreateReviewThreadParams struct {
+	PrUrl              string
+	Url                string
+	Actionable         bool
+	Reason             string
+	FirstCommenter     string
+	LastCommenter      string
+	LastCommentExcerpt string
+	Comments           int64
+}
+
+func (q *Queries) CreateReviewThread(ctx context.Context, arg CreateReviewThreadParams) error {
+	_, err := q.db.ExecContext(ctx, createReviewThread,
+		arg.PrUrl,
+		arg.Url,
+		arg.Actionable,
+		arg.Reason,
+		arg.FirstCommenter,
+		arg.LastCommenter,
+		arg.LastCommentExcerpt,
+		arg.Comments,
+	)
+	return err
+}
+
+const deactivateAllPATs = `-- name: DeactivateAllPATs :exec
+update pat set active = false where active
+`
+
+func (q *Queries) DeactivateAllPATs(ctx context.Context) error {
+	_, err := q.db.ExecContext(ctx, deactivateAllPATs)
+	return err
+}
+
+const deleteBuryDecision = `-- name: DeleteBuryDecision :exec
+delete from bury_decisions where url = $1
+`
+
+func (q *Queries) DeleteBuryDecision(ctx context.Context, url string) error {
+	_, err := q.db.ExecContext(ctx, deleteBuryDecision, url)
+	return err
+}
+
+const deleteMeta = `-- name: DeleteMeta :exec
+delete from meta where key = $1
+`
+
+func (q *Queries) DeleteMeta(ctx context.Context, key string) error {
+	_, err := q.db.ExecContext(ctx, deleteMeta, key)
+	return err
+}
+
+const deleteNote = `-- name: DeleteNote :exec
+delete from notes where pr_url = $1
+`
+
+func (q *Queries) DeleteNote(ctx context.Context, prUrl string) error {
+	_, err := q.db.ExecContext(ctx, deleteNote, prUrl)
+	return err
+}
+
+const deletePr = `-- name: DeletePr :exec
+delete from prs where url = $1
+`
+
+func (q *Queries) DeletePr(ctx context.Context, url string) error {
+	_, err := q.db.ExecContext(ctx, deletePr, url)
+	return err
+}
+
+const deleteReviewThreads = `-- name: DeleteReviewThreads :exec
+delete from review_threads
+`
+
+func (q *Queries) DeleteReviewThreads(ctx context.Context) error {
+	_, err := q.db.ExecContext(ctx, deleteReviewThreads)
+	return err
+}
+
+const deleteRule = `-- name: DeleteRule :exec
+delete from rules where id = $1
+`
+
+func (q *Queries) DeleteRule(ctx context.Context, id int64) error {
+	_, err := q.db.ExecContext(ctx, deleteRule, id)
+	return err
+}
+
+const deleteTagPoints = `-- name: DeleteTagPoints :exec
+delete from tag_points where tag = $1
+`
+
+func (q *Queries) DeleteTagPoints(ctx context.Context, tag string) error {
+	_, err := q.db.ExecContext(ctx, deleteTagPoints, tag)
+	return err
+}
+
+const getActivePAT = `-- name: GetActivePAT :one
+select pat, set_at, expires_at, username from pat where active limit 1
+`
+
+type GetActivePATRow struct {
+	Pat       string
+	SetAt     time.Time
+	ExpiresAt sql.NullTime
+	Username  string
+}
+
+func (q *Queries) GetActivePAT(ctx context.Context) (GetActivePATRow, error) {
+	row := q.db.QueryRowContext(ctx, getActivePAT)
+	var i GetActivePATRow
+	err := row.Scan(
+		&i.Pat,
+		&i.SetAt,
+		&i.ExpiresAt,
+		&i.Username,
+	)
+	return i, err
+}
+
+const getMeta = `-- name: GetMeta :one
+select value from meta where key = $1 limit 1
+`
+
+func (q *Queries) GetMeta(ctx context.Context, key string) (string, error) {
+	row := q.db.QueryRowContext(ctx, getMeta, key)
+	var value string
+	err := row.Scan(&value)
+	return value, err
+}
+
+const getNote = `-- name: GetNote :one
+select pr_url, text, points, updated_at from notes where pr_url = $1 limit 1
+`
+
+func (q *Queries) GetNote(ctx context.Context, prUrl string) (Note, error) {
+	row := q.db.QueryRowContext(ctx, getNote, prUrl)
+	var i Note
+	err := row.Scan(
+		&i.PrUrl,
+		&i.Text,
+		&i.Points,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const getPr = `-- name: GetPr :one
+select url, review_status, title, author, repo_name, repo_owner, repo_url, is_draft, last_updated, last_pr_commenter, threads_actionable, threads_waiting, additions, deletions, review_requested_from_users, buried, raw_json_response from prs where url = $1 limit 1
+`
+
+func (q *Queries) GetPr(ctx context.Context, url string) (Pr, error) {
+	row := q.db.QueryRowContext(ctx, getPr, url)
+	var i Pr
+	err := row.Scan(
+		&i.Url,
+		&i.ReviewStatus,
+		&i.Title,
+		&i.Author,
+		&i.RepoName,
+		&i.RepoOwner,
+		&i.RepoUrl,
+		&i.IsDraft,
+		&i.LastUpdated,
+		&i.LastPrCommenter,
+		&i.ThreadsActionable,
+		&i.ThreadsWaiting,
+		&i.Additions,
+		&i.Deletions,
+		pq.Array(&i.ReviewRequestedFromUsers),
+		&i.Buried,
+		&i.RawJsonResponse,
+	)
+	return i, err
+}
+
+const insertPAT = `-- name: InsertPAT :exec
+insert into pat (pat, expires_at, username, active) values ($1, $2, $3, true)
+on conflict (pat) do update set
+    set_at = date_trunc('second', now()),
+    expires_at = excluded.expires_at,
+    username = excluded.username,
+    active = true
+`
+
+type InsertPATParams struct {
+	Pat       string
+	ExpiresAt sql.NullTime
+	Username  string
+}
+
+func (q *Queries) InsertPAT(ctx context.Context, arg InsertPATParams) error {
+	_, err := q.db.ExecContext(ctx, insertPAT, arg.Pat, arg.ExpiresAt, arg.Username)
+	return err
+}
+
+const listNotes = `-- name: ListNotes :many
+select pr_url, text, points, updated_at from notes order by pr_url
+`
+
+func (q *Queries) ListNotes(ctx context.Context) ([]Note, error) {
+	rows, err := q.db.QueryContext(ctx, listNotes)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Note
+	for rows.Next() {
+		var i Note
+		if err := rows.Scan(
+			&i.PrUrl,
+			&i.Text,
+			&i.Points,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listPrUrls = `-- name: ListPrUrls :many
+select url from prs
+`
+
+func (q *Queries) ListPrUrls(ctx context.Context) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, listPrUrls)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var url string
+		if err := rows.Scan(&url); err != nil {
+			return nil, err
+		}
+		items = append(items, url)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listPrs = `-- name: ListPrs :many
+select url, review_status, title, author, repo_name, repo_owner, repo_url, is_draft, last_updated, last_pr_commenter, threads_actionable, threads_waiting, additions, deletions, review_requested_from_users, buried, raw_json_response from prs order by url
+`
+
+func (q *Queries) ListPrs(ctx context.Context) ([]Pr, error) {
+	rows, err := q.db.QueryContext(ctx, listPrs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Pr
+	for rows.Next() {
+		var i Pr
+		if err := rows.Scan(
+			&i.Url,
+			&i.ReviewStatus,
+			&i.Title,
+			&i.Author,
+			&i.RepoName,
+			&i.RepoOwner,
+			&i.RepoUrl,
+			&i.IsDraft,
+			&i.LastUpdated,
+			&i.LastPrCommenter,
+			&i.ThreadsActionable,
+			&i.ThreadsWaiting,
+			&i.Additions,
+			&i.Deletions,
+			pq.Array(&i.ReviewRequestedFromUsers),
+			&i.Buried,
+			&i.RawJsonResponse,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listRefreshes = `-- name: ListRefreshes :many
+select id, started_at, duration_ms, kind, prs, outcome, error_class, error from refreshes order by id desc
+`
+
+func (q *Queries) ListRefreshes(ctx context.Context) ([]Refresh, error) {
+	rows, err := q.db.QueryContext(ctx, listRefreshes)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Refresh
+	for rows.Next() {
+		var i Refresh
+		if err := rows.Scan(
+			&i.ID,
+			&i.StartedAt,
+			&i.DurationMs,
+			&i.Kind,
+			&i.Prs,
+			&i.Outcome,
+			&i.ErrorClass,
+			&i.Error,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listReviewThreads = `-- name: ListReviewThreads :many
+select id, pr_url, url, actionable, reason, first_commenter, last_commenter, last_comment_excerpt, comments from review_threads order by id
+`
+
+func (q *Queries) ListReviewThreads(ctx context.Context) ([]ReviewThread, error) {
+	rows, err := q.db.QueryContext(ctx, listReviewThreads)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ReviewThread
+	for rows.Next() {
+		var i ReviewThread
+		if err := rows.Scan(
+			&i.ID,
+			&i.PrUrl,
+			&i.Url,
+			&i.Actionable,
+			&i.Reason,
+			&i.FirstCommenter,
+			&i.LastCommenter,
+			&i.LastCommentExcerpt,
+			&i.Comments,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listReviewThreadsForPr = `-- name: ListReviewThreadsForPr :many
+select id, pr_url, url, actionable, reason, first_commenter, last_commenter, last_comment_excerpt, comments from review_threads where pr_url = $1 order by id
+`
+
+func (q *Queries) ListReviewThreadsForPr(ctx context.Context, prUrl string) ([]ReviewThread, error) {
+	rows, err := q.db.QueryContext(ctx, listReviewThreadsForPr, prUrl)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ReviewThread
+	for rows.Next() {
+		var i ReviewThread
+		if err := rows.Scan(
+			&i.ID,
+			&i.PrUrl,
+			&i.Url,
+			&i.Actionable,
+			&i.Reason,
+			&i.FirstCommenter,
+			&i.LastCommenter,
+			&i.LastCommentExcerpt,
+			&i.Comments,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listRules = `-- name: ListRules :many
+select id, repo, author, action, points from rules order by id
+`
+
+func (q *Queries) ListRules(ctx context.Context) ([]Rule, error) {
+	rows, err := q.db.QueryContext(ctx, listRules)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Rule
+	for rows.Next() {
+		var i Rule
+		if err := rows.Scan(
+			&i.ID,
+			&i.Repo,
+			&i.Author,
+			&i.Action,
+			&i.Points,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listTagPoints = `-- name: ListTagPoints :many
+select tag, points from tag_points order by tag
+`
+
+func (q *Queries) ListTagPoints(ctx context.Context) ([]TagPoint, error) {
+	rows, err := q.db.QueryContext(ctx, listTagPoints)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []TagPoint
+	for rows.Next() {
+		var i TagPoint
+		if err := rows.Scan(&i.Tag, &i.Points); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listTags = `-- name: ListTags :many
+select pr_url, repo, tag from tags order by tag, pr_url, repo
+`
+
+func (q *Queries) ListTags(ctx context.Context) ([]Tag, error) {
+	rows, err := q.db.QueryContext(ctx, listTags)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Tag
+	for rows.Next() {
+		var i Tag
+		if err := rows.Scan(&i.PrUrl, &i.Repo, &i.Tag); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const removeTag = `-- name: RemoveTag :exec
+delete from tags where pr_url = $1 and repo = $2 and tag = $3
+`
+
+type RemoveTagParams struct {
+	PrUrl string
+	Repo  string
+	Tag   string
+}
+
+func (q *Queries) RemoveTag(ctx context.Context, arg RemoveTagParams) error {
+	_, err := q.db.ExecContext(ctx, removeTag, arg.PrUrl, arg.Repo, arg.Tag)
+	return err
+}
+
+const storeBuryDecision = `-- name: StoreBuryDecision :exec
+insert into bury_decisions (url, last_updated, buried_at) values ($1, $2, $3)
+on conflict (url) do update set
+    last_updated = excluded.last_updated,
+    buried_at = excluded.buried_at
+`
+
+type StoreBuryDecisionParams struct {
+	Url         string
+	LastUpdated time.Time
+	BuriedAt    time.Time
+}
+
+func (q *Queries) StoreBuryDecision(ctx context.Context, arg StoreBuryDecisionParams) error {
+	_, err := q.db.ExecContext(ctx, storeBuryDecision, arg.Url, arg.LastUpdated, arg.BuriedAt)
+	return err
+}
+
+const storeMeta = `-- name: StoreMeta :exec
+insert into meta (key, value) values ($1, $2)
+on conflict (key) do update set value = excluded.value
+`
+
+type StoreMetaParams struct {
+	Key   string
+	Value string
+}
+
+func (q *Queries) StoreMeta(ctx context.Context, arg StoreMetaParams) error {
+	_, err := q.db.ExecContext(ctx, storeMeta, arg.Key, arg.Value)
+	return err
+}
+
+const storeNote = `-- name: StoreNote :exec
+insert into notes (pr_url, text, points, updated_at) values ($1, $2, $3, $4)
+on conflict (pr_url) do update set
+    text = excluded.text,
+    points = excluded.points,
+    updated_at = excluded.updated_at
+`
+
+type StoreNoteParams struct {
+	PrUrl     string
+	Text      string
+	Points    int64
+	UpdatedAt time.Time
+}
+
+func (q *Queries) StoreNote(ctx context.Context, arg StoreNoteParams) error {
+	_, err := q.db.ExecContext(ctx, storeNote,
+		arg.PrUrl,
+		arg.Text,
+		arg.Points,
+		arg.UpdatedAt,
+	)
+	return err
+}
+
+const storeTagPoints = `-- name: StoreTagPoints :exec
+insert into tag_points (tag, points) values ($1, $2)
+on conflict (tag) do update set points = excluded.points
+`
+
+type StoreTagPointsParams struct {
+	Tag    string
+	Points int64
+}
+
+func (q *Queries) StoreTagPoints(ctx context.Context, arg StoreTagPointsParams) error {
+	_, err := q.db.ExecContext(ctx, storeTagPoints, arg.Tag, arg.Points)
+	return err
+}
+
+const trimRefreshes = `-- name: TrimRefreshes :exec
+delete from refreshes where id not in (select id from refreshes order by id desc limit $1)
+`
+
+func (q *Queries) TrimRefreshes(ctx context.Context, limit int32) error {
+	_, err := q.db.ExecContext(ctx, trimRefreshes, limit)
+	return err
+}
+
+const unbury = `-- name: Unbury :exec
+update prs set buried = false where url = $1
+`
+
+func (q *Queries) Unbury(ctx context.Context, url string) error {
+	_, err := q.db.ExecContext(ctx, unbury, url)
+	return err
+}
+
+const upsertPr = `-- name: UpsertPr :exec
+insert into prs (
+    url,
+    review_status,
+    title,
+    author,
+    repo_name,
+    repo_owner,
+    repo_url,
+    is_draft,
+    last_updated,
+    last_pr_commenter,
+    threads_actionable,
+    threads_waiting,
+    additions,
+    deletions,
+    review_requested_from_users,
+    buried,
+    raw_json_response
+) values (
+    $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17
+) on conflict (url) do update set
+    review_status = excluded.review_status,
+    title = excluded.title,
+    author = excluded.author,
+    repo_name = excluded.repo_name,
+    repo_owner = excluded.repo_owner,
+    repo_url = excluded.repo_url,
+    is_draft = excluded.is_draft,
+    last_updated = excluded.last_updated,
+    last_pr_commenter = excluded.last_pr_commenter,
+    threads_actionable = excluded.threads_actionable,
+    threads_waiting = excluded.threads_waiting,
+    additions = excluded.additions,
+    deletions = excluded.deletions,
+    review_requested_from_users = excluded.review_requested_from_users,
+    buried = excluded.buried,
+    raw_json_response = excluded.raw_json_response
+`
+
+type UpsertPrParams struct {
+	Url                      string
+	ReviewStatus             string
+	Title                    string
+	Author                   string
+	RepoName                 string
+	RepoOwner                string
+	RepoUrl                  string
+	IsDraft                  bool
+	LastUpdated              time.Time
+	LastPrCommenter          string
+	ThreadsActionable        int64
+	ThreadsWaiting           int64
+	Additions                int64
+	Deletions                int64
+	ReviewRequestedFromUsers []string
+	Buried                   bool
+	RawJsonResponse          []byte
+}
+
+func (q *Queries) UpsertPr(ctx context.Context, arg UpsertPrParams) error {
+	_, err := q.db.ExecContext(ctx, upsertPr,
+		arg.Url,
+		arg.ReviewStatus,
+		arg.Title,
+		arg.Author,
+		arg.RepoName,
+		arg.RepoOwner,
+		arg.RepoUrl,
+		arg.IsDraft,
+		arg.LastUpdated,
+		arg.LastPrCommenter,
+		arg.ThreadsActionable,
+		arg.ThreadsWaiting,
+		arg.Additions,
+		arg.Deletions,
+		pq.Array(arg.ReviewRequestedFromUsers),
+		arg.Buried,
+		arg.RawJsonResponse,
+	)
+	return err
+}
@@ -0,0 +1,98 @@
+create table if not exists prs (
+    url text not null primary key,
+    review_status text not null,
+    title text not null,
+    author text not null,
+    repo_name text not null,
+    repo_owner text not null,
+    repo_url text not null,
+    is_draft boolean not null,
+    last_updated timestamptz not null,
+    last_pr_commenter text not null,
+    threads_actionable bigint not null,
+    threads_waiting bigint not null,
+    additions bigint not null,
+    deletions bigint not null,
+    review_requested_from_users text[] not null,
+    buried boolean not null,
+    raw_json_response bytea not null
+);
+
+create table if not exists meta (
+    key text not null primary key,
+    value text not null
+);
+
+create table if not exists pat (
+    pat text primary key,
+    set_at timestamptz not null default date_trunc('second', now()),
+    expires_at timestamptz,
+    username text not null,
+    active boolean not null
+);
+
+-- lives next to prs, and is replaced together with it
+create table if not exists review_threads (
+    id bigserial primary key,
+    pr_url text not null,
+    url text not null,
+    actionable boolean not null,
+    reason text not null,
+    first_commenter text not null,
+    last_commenter text not null,
+    last_comment_excerpt text not null,
+    comments bigint not null
+);
+
+-- outlives prs, so that bury decisions can be imported before the PRs are
+-- fetched. prs.buried is kept in sync, for reading
+create table if not exists bury_decisions (
+    url text not null primary key,
+    last_updated timestamptz not null, -- of the PR when it was buried
+    buried_at timestamptz not null
+);
+
+-- outlives prs, like bury_decisions. a note's points are added to the PR's
+create table if not exists notes (
+    pr_url text not null primary key,
+    text text not null,
+    points bigint not null,
+    updated_at timestamptz not null
+);
+
+-- outlives prs. a tag is on either a single PR (pr_url) or on all PRs of a
+-- repo (repo, as "owner/name"), the other column is ''
+create table if not exists tags (
+    pr_url text not null,
+    repo text not null,
+    tag text not null,
+    primary key (pr_url, repo, tag)
+);
+
+-- points of every PR with the tag
+create table if not exists tag_points (
+    tag text not null primary key,
+    points bigint not null
+);
+
+-- mute and boost PRs by repo and author, see types.Rule
+create table if not exists rules (
+    id bigserial primary key,
+    repo text not null,
+    author text not null,
+    action text not null,
+    points bigint not null
+);
+
+-- the latest attempts to fetch PRs, see types.Refresh. older ones are deleted
+-- as new ones are added
+create table if not exists refreshes (
+    id bigserial primary key,
+    started_at timestamptz not null,
+    duration_ms bigint not null,
+    kind text not null,
+    prs bigint not null,
+    outcome text not null,
+    error_class text not null,
+    error text not null
+);
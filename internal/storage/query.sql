@@ -1,7 +1,7 @@
 -- name: GetPr :one
 select * from prs where url = ? limit 1;
 
--- name: CreatePr :one
+-- name: UpsertPr :exec
 insert into prs (
     url,
     review_status,
@@ -22,22 +22,127 @@ insert into prs (
     raw_json_response
 ) values (
     ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?
-) returning *;
+) on conflict (url) do update set
+    review_status = excluded.review_status,
+    title = excluded.title,
+    author = excluded.author,
+    repo_name = excluded.repo_name,
+    repo_owner = excluded.repo_owner,
+    repo_url = excluded.repo_url,
+    is_draft = excluded.is_draft,
+    last_updated = excluded.last_updated,
+    last_pr_commenter = excluded.last_pr_commenter,
+    threads_actionable = excluded.threads_actionable,
+    threads_waiting = excluded.threads_waiting,
+    additions = excluded.additions,
+    deletions = excluded.deletions,
+    review_requested_from_users = excluded.review_requested_from_users,
+    buried = excluded.buried,
+    raw_json_response = excluded.raw_json_response;
 
--- name: DeletePrs :exec
-delete from prs;
+-- name: DeletePr :exec
+delete from prs where url = ?;
+
+-- name: ListPrUrls :many
+select url from prs;
 
 -- name: ListPrs :many
 select * from prs;
 
+-- name: CreateReviewThread :exec
+insert into review_threads (
+    pr_url,
+    url,
+    actionable,
+    reason,
+    first_commenter,
+    last_commenter,
+    last_comment_excerpt,
+    comments
+) values (
+    ?, ?, ?, ?, ?, ?, ?, ?
+);
+
+-- name: DeleteReviewThreads :exec
+delete from review_threads;
+
+-- name: ListReviewThreads :many
+select * from review_threads order by rowid;
+
+-- name: ListReviewThreadsForPr :many
+select * from review_threads where pr_url = ? order by rowid;
+
 -- name: Bury :exec
 update prs set buried = true where url = ?;
 
 -- name: Unbury :exec
 update prs set buried = false where url = ?;
 
--- name: BuriedPrs :many
-select url, last_updated from prs where buried = true;
+-- name: BuryDecisions :many
+select * from bury_decisions order by url;
+
+-- name: StoreBuryDecision :exec
+replace into bury_decisions (url, last_updated, buried_at) values (?, ?, ?);
+
+-- name: BuryStoredPr :exec
+replace into bury_decisions (url, last_updated, buried_at)
+    select prs.url, prs.last_updated, ? from prs where prs.url = ?;
+
+-- name: DeleteBuryDecision :exec
+delete from bury_decisions where url = ?;
+
+-- name: BuryIfUnchanged :exec
+update prs set buried = true where url = ? and last_updated = ?;
+
+-- name: ListNotes :many
+select * from notes order by pr_url;
+
+-- name: GetNote :one
+select * from notes where pr_url = ? limit 1;
+
+-- name: StoreNote :exec
+replace into notes (pr_url, text, points, updated_at) values (?, ?, ?, ?);
+
+-- name: DeleteNote :exec
+delete from notes where pr_url = ?;
+
+-- name: ListTags :many
+select * from tags order by tag, pr_url, repo;
+
+-- name: AddTag :exec
+insert or ignore into tags (pr_url, repo, tag) values (?, ?, ?);
+
+-- name: RemoveTag :exec
+delete from tags where pr_url = ? and repo = ? and tag = ?;
+
+-- name: ListTagPoints :many
+select * from tag_points order by tag;
+
+-- name: StoreTagPoints :exec
+replace into tag_points (tag, points) values (?, ?);
+
+-- name: DeleteTagPoints :exec
+delete from tag_points where tag = ?;
+
+-- name: ListRules :many
+select * from rules order by id;
+
+-- name: AddRule :one
+insert into rules (repo, author, action, points) values (?, ?, ?, ?)
+returning *;
+
+-- name: DeleteRule :exec
+delete from rules where id = ?;
+
+-- name: AddRefresh :exec
+insert into refreshes (started_at, duration_ms, kind, prs, outcome, error_class, error)
+values (?, ?, ?, ?, ?, ?, ?);
+
+-- name: TrimRefreshes :exec
+delete from refreshes where id not in (select id from refreshes order by id desc limit ?);
+
+-- name: ListRefreshes :many
+select * from refreshes order by id desc;
 
 -- name: StoreLastFetched :exec
 replace into meta (key, value) values ('last_fetched', ?);
@@ -54,6 +159,30 @@ select value from meta where key = 'rate_limit_until' limit 1;
 -- name: ClearRateLimitUntil :exec
 delete from meta where key = 'rate_limit_until';
 
+-- name: StoreRateLimitBudget :exec
+replace into meta (key, value) values ('rate_limit_budget', ?);
+
+-- name: GetRateLimitBudget :one
+select value from meta where key = 'rate_limit_budget' limit 1;
+
+-- name: StoreBackoffState :exec
+replace into meta (key, value) values ('backoff_state', ?);
+
+-- name: GetBackoffState :one
+select value from meta where key = 'backoff_state' limit 1;
+
+-- name: StorePatExpiryNotified :exec
+replace into meta (key, value) values ('pat_expiry_notified', ?);
+
+-- name: GetPatExpiryNotified :one
+select value from meta where key = 'pat_expiry_notified' limit 1;
+
+-- name: StoreApiToken :exec
+replace into meta (key, value) values ('api_token', ?);
+
+-- name: GetApiToken :one
+select value from meta where key = 'api_token' limit 1;
+
 -- name: GetActivePAT :one
 select pat, set_at, expires_at, username from pat where active = 1 limit 1;
 
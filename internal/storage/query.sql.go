@@ -9,25 +9,102 @@ import (
 	"context"
 )
 
-const buriedPrs = `-- name: BuriedPrs :many
-select url, last_updated from prs where buried = true
+const addRefresh = `-- name: AddRefresh :exec
+insert into refreshes (started_at, duration_ms, kind, prs, outcome, error_class, error)
+values (?, ?, ?, ?, ?, ?, ?)
 `
 
-type BuriedPrsRow struct {
-	Url         string
-	LastUpdated string
+type AddRefreshParams struct {
+	StartedAt  string
+	DurationMs int64
+	Kind       string
+	Prs        int64
+	Outcome    string
+	ErrorClass string
+	Error      string
+}
+
+func (q *Queries) AddRefresh(ctx context.Context, arg AddRefreshParams) error {
+	_, err := q.db.ExecContext(ctx, addRefresh,
+		arg.StartedAt,
+		arg.DurationMs,
+		arg.Kind,
+		arg.Prs,
+		arg.Outcome,
+		arg.ErrorClass,
+		arg.Error,
+	)
+	return err
+}
+
+const addRule = `-- name: AddRule :one
+insert into rules (repo, author, action, points) values (?, ?, ?, ?)
+returning id, repo, author, "action", points
+`
+
+type AddRuleParams struct {
+	Repo   string
+	Author string
+	Action string
+	Points int64
+}
+
+func (q *Queries) AddRule(ctx context.Context, arg AddRuleParams) (Rule, error) {
+	row := q.db.QueryRowContext(ctx, addRule,
+		arg.Repo,
+		arg.Author,
+		arg.Action,
+		arg.Points,
+	)
+	var i Rule
+	err := row.Scan(
+		&i.ID,
+		&i.Repo,
+		&i.Author,
+		&i.Action,
+		&i.Points,
+	)
+	return i, err
+}
+
+const addTag = `-- name: AddTag :exec
+insert or ignore into tags (pr_url, repo, tag) values (?, ?, ?)
+`
+
+type AddTagParams struct {
+	PrUrl string
+	Repo  string
+	Tag   string
+}
+
+func (q *Queries) AddTag(ctx context.Context, arg AddTagParams) error {
+	_, err := q.db.ExecContext(ctx, addTag, arg.PrUrl, arg.Repo, arg.Tag)
+	return err
+}
+
+const bury = `-- name: Bury :exec
+update prs set buried = true where url = ?
+`
+
+func (q *Queries) Bury(ctx context.Context, url string) error {
+	_, err := q.db.ExecContext(ctx, bury, url)
+	return err
 }
 
-func (q *Queries) BuriedPrs(ctx context.Context) ([]BuriedPrsRow, error) {
-	rows, err := q.db.QueryContext(ctx, buriedPrs)
+const buryDecisions = `-- name: BuryDecisions :many
+select url, last_updated, buried_at from bury_decisions order by url
+`
+
+func (q *Queries) BuryDecisions(ctx context.Context) ([]BuryDecision, error) {
+	rows, err := q.db.QueryContext(ctx, buryDecisions)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []BuriedPrsRow
+	var items []BuryDecision
 	for rows.Next() {
-		var i BuriedPrsRow
-		if err := rows.Scan(&i.Url, &i.LastUpdated); err != nil {
+		var i BuryDecision
+		if err := rows.Scan(&i.Url, &i.LastUpdated, &i.BuriedAt); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
@@ -41,12 +118,32 @@ func (q *Queries) BuriedPrs(ctx context.Context) ([]BuriedPrsRow, error) {
 	return items, nil
 }
 
-const bury = `-- name: Bury :exec
-update prs set buried = true where url = ?
+const buryIfUnchanged = `-- name: BuryIfUnchanged :exec
+update prs set buried = true where url = ? and last_updated = ?
 `
 
-func (q *Queries) Bury(ctx context.Context, url string) error {
-	_, err := q.db.ExecContext(ctx, bury, url)
+type BuryIfUnchangedParams struct {
+	Url         string
+	LastUpdated string
+}
+
+func (q *Queries) BuryIfUnchanged(ctx context.Context, arg BuryIfUnchangedParams) error {
+	_, err := q.db.ExecContext(ctx, buryIfUnchanged, arg.Url, arg.LastUpdated)
+	return err
+}
+
+const buryStoredPr = `-- name: BuryStoredPr :exec
+replace into bury_decisions (url, last_updated, buried_at)
+    select prs.url, prs.last_updated, ? from prs where prs.url = ?
+`
+
+type BuryStoredPrParams struct {
+	BuriedAt string
+	Url      string
+}
+
+func (q *Queries) BuryStoredPr(ctx context.Context, arg BuryStoredPrParams) error {
+	_, err := q.db.ExecContext(ctx, buryStoredPr, arg.BuriedAt, arg.Url)
 	return err
 }
 
@@ -68,91 +165,44 @@ func (q *Queries) ClearRateLimitUntil(ctx context.Context) error {
 	return err
 }
 
-const createPr = `-- name: CreatePr :one
-insert into prs (
+const createReviewThread = `-- name: CreateReviewThread :exec
+insert into review_threads (
+    pr_url,
     url,
-    review_status,
-    title,
-    author,
-    repo_name,
-    repo_owner,
-    repo_url,
-    is_draft,
-    last_updated,
-    last_pr_commenter,
-    threads_actionable,
-    threads_waiting,
-    additions,
-    deletions,
-    review_requested_from_users,
-    buried,
-    raw_json_response
+    actionable,
+    reason,
+    first_commenter,
+    last_commenter,
+    last_comment_excerpt,
+    comments
 ) values (
-    ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?
-) returning url, review_status, title, author, repo_name, repo_owner, repo_url, is_draft, last_updated, last_pr_commenter, threads_actionable, threads_waiting, additions, deletions, review_requested_from_users, buried, raw_json_response
+    ?, ?, ?, ?, ?, ?, ?, ?
+)
 `
 
-type CreatePrParams struct {
-	Url                      string
-	ReviewStatus             string
-	Title                    string
-	Author                   string
-	RepoName                 string
-	RepoOwner                string
-	RepoUrl                  string
-	IsDraft                  bool
-	LastUpdated              string
-	LastPrCommenter          string
-	ThreadsActionable        int64
-	ThreadsWaiting           int64
-	Additions                int64
-	Deletions                int64
-	ReviewRequestedFromUsers string
-	Buried                   bool
-	RawJsonResponse          []byte
+type CreateReviewThreadParams struct {
+	PrUrl              string
+	Url                string
+	Actionable         bool
+	Reason             string
+	FirstCommenter     string
+	LastCommenter      string
+	LastCommentExcerpt string
+	Comments           int64
 }
 
-func (q *Queries) CreatePr(ctx context.Context, arg CreatePrParams) (Pr, error) {
-	row := q.db.QueryRowContext(ctx, createPr,
+func (q *Queries) CreateReviewThread(ctx context.Context, arg CreateReviewThreadParams) error {
+	_, err := q.db.ExecContext(ctx, createReviewThread,
+		arg.PrUrl,
 		arg.Url,
-		arg.ReviewStatus,
-		arg.Title,
-		arg.Author,
-		arg.RepoName,
-		arg.RepoOwner,
-		arg.RepoUrl,
-		arg.IsDraft,
-		arg.LastUpdated,
-		arg.LastPrCommenter,
-		arg.ThreadsActionable,
-		arg.ThreadsWaiting,
-		arg.Additions,
-		arg.Deletions,
-		arg.ReviewRequestedFromUsers,
-		arg.Buried,
-		arg.RawJsonResponse,
-	)
-	var i Pr
-	err := row.Scan(
-		&i.Url,
-		&i.ReviewStatus,
-		&i.Title,
-		&i.Author,
-		&i.RepoName,
-		&i.RepoOwner,
-		&i.RepoUrl,
-		&i.IsDraft,
-		&i.LastUpdated,
-		&i.LastPrCommenter,
-		&i.ThreadsActionable,
-		&i.ThreadsWaiting,
-		&i.Additions,
-		&i.Deletions,
-		&i.ReviewRequestedFromUsers,
-		&i.Buried,
-		&i.RawJsonResponse,
+		arg.Actionable,
+		arg.Reason,
+		arg.FirstCommenter,
+		arg.LastCommenter,
+		arg.LastCommentExcerpt,
+		arg.Comments,
 	)
-	return i, err
+	return err
 }
 
 const deactivateAllPATs = `-- name: DeactivateAllPATs :exec
@@ -164,12 +214,57 @@ func (q *Queries) DeactivateAllPATs(ctx context.Context) error {
 	return err
 }
 
-const deletePrs = `-- name: DeletePrs :exec
-delete from prs
+const deleteBuryDecision = `-- name: DeleteBuryDecision :exec
+delete from bury_decisions where url = ?
+`
+
+func (q *Queries) DeleteBuryDecision(ctx context.Context, url string) error {
+	_, err := q.db.ExecContext(ctx, deleteBuryDecision, url)
+	return err
+}
+
+const deleteNote = `-- name: DeleteNote :exec
+delete from notes where pr_url = ?
+`
+
+func (q *Queries) DeleteNote(ctx context.Context, prUrl string) error {
+	_, err := q.db.ExecContext(ctx, deleteNote, prUrl)
+	return err
+}
+
+const deletePr = `-- name: DeletePr :exec
+delete from prs where url = ?
+`
+
+func (q *Queries) DeletePr(ctx context.Context, url string) error {
+	_, err := q.db.ExecContext(ctx, deletePr, url)
+	return err
+}
+
+const deleteReviewThreads = `-- name: DeleteReviewThreads :exec
+delete from review_threads
+`
+
+func (q *Queries) DeleteReviewThreads(ctx context.Context) error {
+	_, err := q.db.ExecContext(ctx, deleteReviewThreads)
+	return err
+}
+
+const deleteRule = `-- name: DeleteRule :exec
+delete from rules where id = ?
+`
+
+func (q *Queries) DeleteRule(ctx context.Context, id int64) error {
+	_, err := q.db.ExecContext(ctx, deleteRule, id)
+	return err
+}
+
+const deleteTagPoints = `-- name: DeleteTagPoints :exec
+delete from tag_points where tag = ?
 `
 
-func (q *Queries) DeletePrs(ctx context.Context) error {
-	_, err := q.db.ExecContext(ctx, deletePrs)
+func (q *Queries) DeleteTagPoints(ctx context.Context, tag string) error {
+	_, err := q.db.ExecContext(ctx, deleteTagPoints, tag)
 	return err
 }
 
@@ -196,6 +291,28 @@ func (q *Queries) GetActivePAT(ctx context.Context) (GetActivePATRow, error) {
 	return i, err
 }
 
+const getApiToken = `-- name: GetApiToken :one
+select value from meta where key = 'api_token' limit 1
+`
+
+func (q *Queries) GetApiToken(ctx context.Context) (string, error) {
+	row := q.db.QueryRowContext(ctx, getApiToken)
+	var value string
+	err := row.Scan(&value)
+	return value, err
+}
+
+const getBackoffState = `-- name: GetBackoffState :one
+select value from meta where key = 'backoff_state' limit 1
+`
+
+func (q *Queries) GetBackoffState(ctx context.Context) (string, error) {
+	row := q.db.QueryRowContext(ctx, getBackoffState)
+	var value string
+	err := row.Scan(&value)
+	return value, err
+}
+
 const getLastFetched = `-- name: GetLastFetched :one
 select value from meta where key = 'last_fetched' limit 1
 `
@@ -207,6 +324,33 @@ func (q *Queries) GetLastFetched(ctx context.Context) (string, error) {
 	return value, err
 }
 
+const getNote = `-- name: GetNote :one
+select pr_url, text, points, updated_at from notes where pr_url = ? limit 1
+`
+
+func (q *Queries) GetNote(ctx context.Context, prUrl string) (Note, error) {
+	row := q.db.QueryRowContext(ctx, getNote, prUrl)
+	var i Note
+	err := row.Scan(
+		&i.PrUrl,
+		&i.Text,
+		&i.Points,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const getPatExpiryNotified = `-- name: GetPatExpiryNotified :one
+select value from meta where key = 'pat_expiry_notified' limit 1
+`
+
+func (q *Queries) GetPatExpiryNotified(ctx context.Context) (string, error) {
+	row := q.db.QueryRowContext(ctx, getPatExpiryNotified)
+	var value string
+	err := row.Scan(&value)
+	return value, err
+}
+
 const getPr = `-- name: GetPr :one
 select url, review_status, title, author, repo_name, repo_owner, repo_url, is_draft, last_updated, last_pr_commenter, threads_actionable, threads_waiting, additions, deletions, review_requested_from_users, buried, raw_json_response from prs where url = ? limit 1
 `
@@ -236,6 +380,17 @@ func (q *Queries) GetPr(ctx context.Context, url string) (Pr, error) {
 	return i, err
 }
 
+const getRateLimitBudget = `-- name: GetRateLimitBudget :one
+select value from meta where key = 'rate_limit_budget' limit 1
+`
+
+func (q *Queries) GetRateLimitBudget(ctx context.Context) (string, error) {
+	row := q.db.QueryRowContext(ctx, getRateLimitBudget)
+	var value string
+	err := row.Scan(&value)
+	return value, err
+}
+
 const getRateLimitUntil = `-- name: GetRateLimitUntil :one
 select value from meta where key = 'rate_limit_until' limit 1
 `
@@ -262,6 +417,65 @@ func (q *Queries) InsertPAT(ctx context.Context, arg InsertPATParams) error {
 	return err
 }
 
+const listNotes = `-- name: ListNotes :many
+select pr_url, text, points, updated_at from notes order by pr_url
+`
+
+func (q *Queries) ListNotes(ctx context.Context) ([]Note, error) {
+	rows, err := q.db.QueryContext(ctx, listNotes)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Note
+	for rows.Next() {
+		var i Note
+		if err := rows.Scan(
+			&i.PrUrl,
+			&i.Text,
+			&i.Points,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listPrUrls = `-- name: ListPrUrls :many
+select url from prs
+`
+
+func (q *Queries) ListPrUrls(ctx context.Context) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, listPrUrls)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var url string
+		if err := rows.Scan(&url); err != nil {
+			return nil, err
+		}
+		items = append(items, url)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listPrs = `-- name: ListPrs :many
 select url, review_status, title, author, repo_name, repo_owner, repo_url, is_draft, last_updated, last_pr_commenter, threads_actionable, threads_waiting, additions, deletions, review_requested_from_users, buried, raw_json_response from prs
 `
@@ -307,6 +521,249 @@ func (q *Queries) ListPrs(ctx context.Context) ([]Pr, error) {
 	return items, nil
 }
 
+const listRefreshes = `-- name: ListRefreshes :many
+select id, started_at, duration_ms, kind, prs, outcome, error_class, error from refreshes order by id desc
+`
+
+func (q *Queries) ListRefreshes(ctx context.Context) ([]Refresh, error) {
+	rows, err := q.db.QueryContext(ctx, listRefreshes)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Refresh
+	for rows.Next() {
+		var i Refresh
+		if err := rows.Scan(
+			&i.ID,
+			&i.StartedAt,
+			&i.DurationMs,
+			&i.Kind,
+			&i.Prs,
+			&i.Outcome,
+			&i.ErrorClass,
+			&i.Error,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listReviewThreads = `-- name: ListReviewThreads :many
+select pr_url, url, actionable, reason, first_commenter, last_commenter, last_comment_excerpt, comments from review_threads order by rowid
+`
+
+func (q *Queries) ListReviewThreads(ctx context.Context) ([]ReviewThread, error) {
+	rows, err := q.db.QueryContext(ctx, listReviewThreads)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ReviewThread
+	for rows.Next() {
+		var i ReviewThread
+		if err := rows.Scan(
+			&i.PrUrl,
+			&i.Url,
+			&i.Actionable,
+			&i.Reason,
+			&i.FirstCommenter,
+			&i.LastCommenter,
+			&i.LastCommentExcerpt,
+			&i.Comments,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listReviewThreadsForPr = `-- name: ListReviewThreadsForPr :many
+select pr_url, url, actionable, reason, first_commenter, last_commenter, last_comment_excerpt, comments from review_threads where pr_url = ? order by rowid
+`
+
+func (q *Queries) ListReviewThreadsForPr(ctx context.Context, prUrl string) ([]ReviewThread, error) {
+	rows, err := q.db.QueryContext(ctx, listReviewThreadsForPr, prUrl)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ReviewThread
+	for rows.Next() {
+		var i ReviewThread
+		if err := rows.Scan(
+			&i.PrUrl,
+			&i.Url,
+			&i.Actionable,
+			&i.Reason,
+			&i.FirstCommenter,
+			&i.LastCommenter,
+			&i.LastCommentExcerpt,
+			&i.Comments,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listRules = `-- name: ListRules :many
+select id, repo, author, "action", points from rules order by id
+`
+
+func (q *Queries) ListRules(ctx context.Context) ([]Rule, error) {
+	rows, err := q.db.QueryContext(ctx, listRules)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Rule
+	for rows.Next() {
+		var i Rule
+		if err := rows.Scan(
+			&i.ID,
+			&i.Repo,
+			&i.Author,
+			&i.Action,
+			&i.Points,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listTagPoints = `-- name: ListTagPoints :many
+select tag, points from tag_points order by tag
+`
+
+func (q *Queries) ListTagPoints(ctx context.Context) ([]TagPoint, error) {
+	rows, err := q.db.QueryContext(ctx, listTagPoints)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []TagPoint
+	for rows.Next() {
+		var i TagPoint
+		if err := rows.Scan(&i.Tag, &i.Points); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listTags = `-- name: ListTags :many
+select pr_url, repo, tag from tags order by tag, pr_url, repo
+`
+
+func (q *Queries) ListTags(ctx context.Context) ([]Tag, error) {
+	rows, err := q.db.QueryContext(ctx, listTags)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Tag
+	for rows.Next() {
+		var i Tag
+		if err := rows.Scan(&i.PrUrl, &i.Repo, &i.Tag); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const removeTag = `-- name: RemoveTag :exec
+delete from tags where pr_url = ? and repo = ? and tag = ?
+`
+
+type RemoveTagParams struct {
+	PrUrl string
+	Repo  string
+	Tag   string
+}
+
+func (q *Queries) RemoveTag(ctx context.Context, arg RemoveTagParams) error {
+	_, err := q.db.ExecContext(ctx, removeTag, arg.PrUrl, arg.Repo, arg.Tag)
+	return err
+}
+
+const storeApiToken = `-- name: StoreApiToken :exec
+replace into meta (key, value) values ('api_token', ?)
+`
+
+func (q *Queries) StoreApiToken(ctx context.Context, value string) error {
+	_, err := q.db.ExecContext(ctx, storeApiToken, value)
+	return err
+}
+
+const storeBackoffState = `-- name: StoreBackoffState :exec
+replace into meta (key, value) values ('backoff_state', ?)
+`
+
+func (q *Queries) StoreBackoffState(ctx context.Context, value string) error {
+	_, err := q.db.ExecContext(ctx, storeBackoffState, value)
+	return err
+}
+
+const storeBuryDecision = `-- name: StoreBuryDecision :exec
+replace into bury_decisions (url, last_updated, buried_at) values (?, ?, ?)
+`
+
+type StoreBuryDecisionParams struct {
+	Url         string
+	LastUpdated string
+	BuriedAt    string
+}
+
+func (q *Queries) StoreBuryDecision(ctx context.Context, arg StoreBuryDecisionParams) error {
+	_, err := q.db.ExecContext(ctx, storeBuryDecision, arg.Url, arg.LastUpdated, arg.BuriedAt)
+	return err
+}
+
 const storeLastFetched = `-- name: StoreLastFetched :exec
 replace into meta (key, value) values ('last_fetched', ?)
 `
@@ -316,6 +773,45 @@ func (q *Queries) StoreLastFetched(ctx context.Context, value string) error {
 	return err
 }
 
+const storeNote = `-- name: StoreNote :exec
+replace into notes (pr_url, text, points, updated_at) values (?, ?, ?, ?)
+`
+
+type StoreNoteParams struct {
+	PrUrl     string
+	Text      string
+	Points    int64
+	UpdatedAt string
+}
+
+func (q *Queries) StoreNote(ctx context.Context, arg StoreNoteParams) error {
+	_, err := q.db.ExecContext(ctx, storeNote,
+		arg.PrUrl,
+		arg.Text,
+		arg.Points,
+		arg.UpdatedAt,
+	)
+	return err
+}
+
+const storePatExpiryNotified = `-- name: StorePatExpiryNotified :exec
+replace into meta (key, value) values ('pat_expiry_notified', ?)
+`
+
+func (q *Queries) StorePatExpiryNotified(ctx context.Context, value string) error {
+	_, err := q.db.ExecContext(ctx, storePatExpiryNotified, value)
+	return err
+}
+
+const storeRateLimitBudget = `-- name: StoreRateLimitBudget :exec
+replace into meta (key, value) values ('rate_limit_budget', ?)
+`
+
+func (q *Queries) StoreRateLimitBudget(ctx context.Context, value string) error {
+	_, err := q.db.ExecContext(ctx, storeRateLimitBudget, value)
+	return err
+}
+
 const storeRateLimitUntil = `-- name: StoreRateLimitUntil :exec
 replace into meta (key, value) values ('rate_limit_until', ?)
 `
@@ -325,6 +821,29 @@ func (q *Queries) StoreRateLimitUntil(ctx context.Context, value string) error {
 	return err
 }
 
+const storeTagPoints = `-- name: StoreTagPoints :exec
+replace into tag_points (tag, points) values (?, ?)
+`
+
+type StoreTagPointsParams struct {
+	Tag    string
+	Points int64
+}
+
+func (q *Queries) StoreTagPoints(ctx context.Context, arg StoreTagPointsParams) error {
+	_, err := q.db.ExecContext(ctx, storeTagPoints, arg.Tag, arg.Points)
+	return err
+}
+
+const trimRefreshes = `-- name: TrimRefreshes :exec
+delete from refreshes where id not in (select id from refreshes order by id desc limit ?)
+`
+
+func (q *Queries) TrimRefreshes(ctx context.Context, limit int64) error {
+	_, err := q.db.ExecContext(ctx, trimRefreshes, limit)
+	return err
+}
+
 const unbury = `-- name: Unbury :exec
 update prs set buried = false where url = ?
 `
@@ -333,3 +852,86 @@ func (q *Queries) Unbury(ctx context.Context, url string) error {
 	_, err := q.db.ExecContext(ctx, unbury, url)
 	return err
 }
+
+const upsertPr = `-- name: UpsertPr :exec
+insert into prs (
+    url,
+    review_status,
+    title,
+    author,
+    repo_name,
+    repo_owner,
+    repo_url,
+    is_draft,
+    last_updated,
+    last_pr_commenter,
+    threads_actionable,
+    threads_waiting,
+    additions,
+    deletions,
+    review_requested_from_users,
+    buried,
+    raw_json_response
+) values (
+    ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?
+) on conflict (url) do update set
+    review_status = excluded.review_status,
+    title = excluded.title,
+    author = excluded.author,
+    repo_name = excluded.repo_name,
+    repo_owner = excluded.repo_owner,
+    repo_url = excluded.repo_url,
+    is_draft = excluded.is_draft,
+    last_updated = excluded.last_updated,
+    last_pr_commenter = excluded.last_pr_commenter,
+    threads_actionable = excluded.threads_actionable,
+    threads_waiting = excluded.threads_waiting,
+    additions = excluded.additions,
+    deletions = excluded.deletions,
+    review_requested_from_users = excluded.review_requested_from_users,
+    buried = excluded.buried,
+    raw_json_response = excluded.raw_json_response
+`
+
+type UpsertPrParams struct {
+	Url                      string
+	ReviewStatus             string
+	Title                    string
+	Author                   string
+	RepoName                 string
+	RepoOwner                string
+	RepoUrl                  string
+	IsDraft                  bool
+	LastUpdated              string
+	LastPrCommenter          string
+	ThreadsActionable        int64
+	ThreadsWaiting           int64
+	Additions                int64
+	Deletions                int64
+	ReviewRequestedFromUsers string
+	Buried                   bool
+	RawJsonResponse          []byte
+}
+
+func (q *Queries) UpsertPr(ctx context.Context, arg UpsertPrParams) error {
+	_, err := q.db.ExecContext(ctx, upsertPr,
+		arg.Url,
+		arg.ReviewStatus,
+		arg.Title,
+		arg.Author,
+		arg.RepoName,
+		arg.RepoOwner,
+		arg.RepoUrl,
+		arg.IsDraft,
+		arg.LastUpdated,
+		arg.LastPrCommenter,
+		arg.ThreadsActionable,
+		arg.ThreadsWaiting,
+		arg.Additions,
+		arg.Deletions,
+		arg.ReviewRequestedFromUsers,
+		arg.Buried,
+		arg.RawJsonResponse,
+	)
+	return err
+}
@@ -30,3 +30,72 @@ create table if not exists pat (
     username text not null,
     active integer not null check (active in (0, 1))
 );
+
+-- lives next to prs, and is replaced together with it
+create table if not exists review_threads (
+    pr_url text not null,
+    url text not null,
+    actionable boolean not null,
+    reason text not null,
+    first_commenter text not null,
+    last_commenter text not null,
+    last_comment_excerpt text not null,
+    comments integer not null
+);
+
+-- outlives prs, so that bury decisions can be imported before the PRs are
+-- fetched. prs.buried is kept in sync, for reading
+create table if not exists bury_decisions (
+    url text not null primary key,
+    last_updated text not null, -- of the PR when it was buried
+    buried_at text not null
+);
+
+-- PRs buried before bury_decisions existed
+insert or ignore into bury_decisions (url, last_updated, buried_at)
+    select url, last_updated, last_updated from prs where buried = true;
+
+-- outlives prs, like bury_decisions. a note's points are added to the PR's
+create table if not exists notes (
+    pr_url text not null primary key,
+    text text not null,
+    points integer not null,
+    updated_at text not null
+);
+
+-- outlives prs. a tag is on either a single PR (pr_url) or on all PRs of a
+-- repo (repo, as "owner/name"), the other column is ''
+create table if not exists tags (
+    pr_url text not null,
+    repo text not null,
+    tag text not null,
+    primary key (pr_url, repo, tag)
+);
+
+-- points of every PR with the tag
+create table if not exists tag_points (
+    tag text not null primary key,
+    points integer not null
+);
+
+-- mute and boost PRs by repo and author, see types.Rule
+create table if not exists rules (
+    id integer primary key autoincrement,
+    repo text not null,
+    author text not null,
+    action text not null,
+    points integer not null
+);
+
+-- the latest attempts to fetch PRs, see types.Refresh. older ones are deleted
+-- as new ones are added
+create table if not exists refreshes (
+    id integer primary key autoincrement,
+    started_at text not null,
+    duration_ms integer not null,
+    kind text not null,
+    prs integer not null,
+    outcome text not null,
+    error_class text not null,
+    error text not null
+);
@@ -0,0 +1,236 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/chelmertz/elly/internal/types"
+)
+
+// ExportVersion is bumped when ExportedState changes in a way that older
+// versions of elly can't import.
+const ExportVersion = 1
+
+// ExportedState is what the user has curated, as opposed to the PRs, which
+// can be fetched again. Secrets (the PAT and the API token) are left out, so
+// that an export can be stored and moved around like any other file.
+type ExportedState struct {
+	Version    int            `json:"version"`
+	ExportedAt time.Time      `json:"exported_at"`
+	Buried     []ExportedBury `json:"buried"`
+	// Notes, tags and rules are missing from exports made before there were
+	// any.
+	Notes     []ExportedNote `json:"notes,omitempty"`
+	Tags      []ExportedTag  `json:"tags,omitempty"`
+	TagPoints map[string]int `json:"tag_points,omitempty"`
+	Rules     []ExportedRule `json:"rules,omitempty"`
+	// PAT is informational, it's not imported since the token itself isn't
+	// exported.
+	PAT            *ExportedPAT `json:"pat,omitempty"`
+	RateLimitUntil *time.Time   `json:"rate_limit_until,omitempty"`
+}
+
+// ErrInvalidState is returned by Import when the state itself is the problem,
+// rather than storing it.
+var ErrInvalidState = errors.New("invalid state")
+
+type ExportedBury struct {
+	Url         string    `json:"url"`
+	LastUpdated time.Time `json:"last_updated"` // of the PR, when it was buried
+	BuriedAt    time.Time `json:"buried_at"`
+}
+
+type ExportedNote struct {
+	PrUrl     string    `json:"pr_url"`
+	Text      string    `json:"text"`
+	Points    int       `json:"points"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ExportedTag is on either a PR or a repo.
+type ExportedTag struct {
+	PrUrl string `json:"pr_url,omitempty"`
+	Repo  string `json:"repo,omitempty"`
+	Tag   string `json:"tag"`
+}
+
+// ExportedRule has no id, since ids are given by the store it's imported to.
+type ExportedRule struct {
+	Repo   string `json:"repo,omitempty"`
+	Author string `json:"author,omitempty"`
+	Action string `json:"action"`
+	Points int    `json:"points,omitempty"`
+}
+
+func (r ExportedRule) rule() types.Rule {
+	return types.Rule{Repo: r.Repo, Author: r.Author, Action: r.Action, Points: r.Points}
+}
+
+// ImportCounts tells how much of each kind Import stored.
+type ImportCounts struct {
+	Buried    int `json:"buried"`
+	Notes     int `json:"notes"`
+	Tags      int `json:"tags"`
+	TagPoints int `json:"tag_points"`
+	Rules     int `json:"rules"` // those that weren't already stored
+}
+
+type ExportedPAT struct {
+	Username  string     `json:"username"`
+	SetAt     time.Time  `json:"set_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+func Export(store Storage, now time.Time) (ExportedState, error) {
+	state := ExportedState{
+		Version:    ExportVersion,
+		ExportedAt: now.UTC().Truncate(time.Second),
+		Buried:     []ExportedBury{},
+	}
+
+	buried, err := store.BuriedPrs()
+	if err != nil {
+		return ExportedState{}, err
+	}
+	for _, b := range buried {
+		state.Buried = append(state.Buried, ExportedBury(b))
+	}
+
+	notes, err := store.Notes()
+	if err != nil {
+		return ExportedState{}, err
+	}
+	for _, note := range notes {
+		state.Notes = append(state.Notes, ExportedNote(note))
+	}
+
+	tags, err := store.Tags()
+	if err != nil {
+		return ExportedState{}, err
+	}
+	for _, tag := range tags {
+		state.Tags = append(state.Tags, ExportedTag(tag))
+	}
+	if state.TagPoints, err = store.TagPoints(); err != nil {
+		return ExportedState{}, err
+	}
+
+	rules, err := store.Rules()
+	if err != nil {
+		return ExportedState{}, err
+	}
+	for _, rule := range rules {
+		state.Rules = append(state.Rules, ExportedRule{Repo: rule.Repo, Author: rule.Author, Action: rule.Action, Points: rule.Points})
+	}
+
+	pat, found, err := store.GetPAT()
+	if err != nil {
+		return ExportedState{}, err
+	}
+	if found {
+		state.PAT = &ExportedPAT{Username: pat.Username, SetAt: pat.SetAt}
+		if !pat.ExpiresAt.IsZero() {
+			state.PAT.ExpiresAt = &pat.ExpiresAt
+		}
+	}
+
+	if rateLimitUntil := store.GetRateLimitUntil(); rateLimitUntil.After(now) {
+		state.RateLimitUntil = &rateLimitUntil
+	}
+
+	return state, nil
+}
+
+// Import merges state into store: buried PRs, notes, tags and tag points are
+// added to (or replace) the ones already stored, rules that aren't already
+// stored are added, and a rate limit that hasn't expired is respected. The
+// state is held to the same limits as the API, and is imported all or
+// nothing.
+func Import(store Storage, state ExportedState, now time.Time) (ImportCounts, error) {
+	if state.Version < 1 || state.Version > ExportVersion {
+		return ImportCounts{}, fmt.Errorf("%w: unsupported export version %d, this elly supports 1 to %d", ErrInvalidState, state.Version, ExportVersion)
+	}
+
+	for _, note := range state.Notes {
+		if note.PrUrl == "" {
+			return ImportCounts{}, fmt.Errorf("%w: note without pr_url", ErrInvalidState)
+		}
+		if err := types.ValidateNote(note.Text, note.Points); err != nil {
+			return ImportCounts{}, fmt.Errorf("%w: note on %s: %v", ErrInvalidState, note.PrUrl, err)
+		}
+	}
+	tags := make([]StoredTag, 0, len(state.Tags))
+	for _, tag := range state.Tags {
+		if (tag.PrUrl == "") == (tag.Repo == "") {
+			return ImportCounts{}, fmt.Errorf("%w: tag %q must have either a pr_url or a repo", ErrInvalidState, tag.Tag)
+		}
+		name, err := types.NormalizeTag(tag.Tag)
+		if err != nil {
+			return ImportCounts{}, fmt.Errorf("%w: tag %q: %v", ErrInvalidState, tag.Tag, err)
+		}
+		// as tagged through the API
+		tags = append(tags, StoredTag{PrUrl: tag.PrUrl, Repo: strings.ToLower(tag.Repo), Tag: name})
+	}
+	tagPoints := make(map[string]int, len(state.TagPoints))
+	for tag, points := range state.TagPoints {
+		name, err := types.NormalizeTag(tag)
+		if err != nil {
+			return ImportCounts{}, fmt.Errorf("%w: tag %q: %v", ErrInvalidState, tag, err)
+		}
+		if err := types.ValidatePoints(points); err != nil {
+			return ImportCounts{}, fmt.Errorf("%w: tag %q: %v", ErrInvalidState, tag, err)
+		}
+		tagPoints[name] = points
+	}
+	for _, rule := range state.Rules {
+		if err := rule.rule().Validate(); err != nil {
+			return ImportCounts{}, fmt.Errorf("%w: rule for %s: %v", ErrInvalidState, rule.rule(), err)
+		}
+	}
+
+	imported := StateImport{Buried: make([]StoredBury, 0, len(state.Buried)), Tags: tags, TagPoints: tagPoints}
+	for _, b := range state.Buried {
+		if b.Url == "" {
+			return ImportCounts{}, fmt.Errorf("%w: buried PR without url", ErrInvalidState)
+		}
+		imported.Buried = append(imported.Buried, StoredBury(b))
+	}
+	for _, note := range state.Notes {
+		imported.Notes = append(imported.Notes, StoredNote(note))
+	}
+	for _, rule := range state.Rules {
+		imported.Rules = append(imported.Rules, rule.rule())
+	}
+	if state.RateLimitUntil != nil && state.RateLimitUntil.After(now) && state.RateLimitUntil.After(store.GetRateLimitUntil()) {
+		imported.RateLimitUntil = *state.RateLimitUntil
+	}
+
+	rulesAdded, err := store.ImportState(imported)
+	if err != nil {
+		return ImportCounts{}, fmt.Errorf("could not store the imported state: %w", err)
+	}
+	return ImportCounts{
+		Buried:    len(imported.Buried),
+		Notes:     len(imported.Notes),
+		Tags:      len(imported.Tags),
+		TagPoints: len(imported.TagPoints),
+		Rules:     rulesAdded,
+	}, nil
+}
+
+// newRules returns the rules of imported that aren't in existing, each once,
+// so that importing the same export twice doesn't double the rules.
+func newRules(existing, imported []types.Rule) []types.Rule {
+	var added []types.Rule
+	for _, rule := range imported {
+		same := func(r types.Rule) bool { r.Id = 0; return r == rule }
+		if slices.ContainsFunc(existing, same) || slices.ContainsFunc(added, same) {
+			continue
+		}
+		added = append(added, rule)
+	}
+	return added
+}
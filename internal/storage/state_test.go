@@ -0,0 +1,152 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chelmertz/elly/internal/types"
+)
+
+func TestExportImport_MovesBuriedPrsBetweenStores(t *testing.T) {
+	now := time.Date(2025, 6, 20, 12, 0, 0, 0, time.UTC)
+	from := NewMemoryStorage(conformanceLogger())
+	stored := conformancePr("1")
+	notYetFetched := conformancePr("2")
+	if err := from.StoreRepoPrs([]types.ViewPr{stored, notYetFetched}); err != nil {
+		t.Fatalf("StoreRepoPrs failed: %v", err)
+	}
+	for _, pr := range []types.ViewPr{stored, notYetFetched} {
+		if err := from.Bury(pr.Url); err != nil {
+			t.Fatalf("Bury failed: %v", err)
+		}
+	}
+	if err := from.StoreNote(StoredNote{PrUrl: stored.Url, Text: "after the release", Points: -20, UpdatedAt: now}); err != nil {
+		t.Fatalf("StoreNote failed: %v", err)
+	}
+	if err := from.AddTag(StoredTag{Repo: "o/r", Tag: "release-blocker"}); err != nil {
+		t.Fatalf("AddTag failed: %v", err)
+	}
+	if err := from.SetTagPoints("release-blocker", 200); err != nil {
+		t.Fatalf("SetTagPoints failed: %v", err)
+	}
+	if _, err := from.AddRule(types.Rule{Repo: "o/*", Action: types.RulePoints, Points: 30}); err != nil {
+		t.Fatalf("AddRule failed: %v", err)
+	}
+	if err := from.StorePAT("secret", "me", time.Time{}); err != nil {
+		t.Fatalf("StorePAT failed: %v", err)
+	}
+	rateLimitUntil := now.Add(time.Hour)
+	if err := from.SetRateLimitUntil(rateLimitUntil); err != nil {
+		t.Fatalf("SetRateLimitUntil failed: %v", err)
+	}
+
+	exported, err := Export(from, now)
+	if err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	encoded, err := json.Marshal(exported)
+	if err != nil {
+		t.Fatalf("could not encode the export: %v", err)
+	}
+	if strings.Contains(string(encoded), "secret") {
+		t.Errorf("the PAT must not be exported, got %s", encoded)
+	}
+
+	to := NewMemoryStorage(conformanceLogger())
+	if err := to.StoreRepoPrs([]types.ViewPr{stored}); err != nil {
+		t.Fatalf("StoreRepoPrs failed: %v", err)
+	}
+	var decoded ExportedState
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatalf("could not decode the export: %v", err)
+	}
+	// twice, to show that it doesn't duplicate anything
+	for range 2 {
+		if _, err := Import(to, decoded, now); err != nil {
+			t.Fatalf("Import failed: %v", err)
+		}
+	}
+
+	stored.Buried = true
+	stored.Note, stored.NotePoints = "after the release", -20
+	stored.Tags = []types.Tag{{Name: "release-blocker", Points: 200, OnRepo: true}}
+	stored.Rules = []types.Rule{{Id: 1, Repo: "o/*", Action: types.RulePoints, Points: 30}}
+	assertPrs(t, to, stored)
+	if err := to.StoreRepoPrs([]types.ViewPr{stored, notYetFetched}); err != nil {
+		t.Fatalf("StoreRepoPrs failed: %v", err)
+	}
+	notYetFetched.Buried = true
+	notYetFetched.Tags = stored.Tags
+	notYetFetched.Rules = stored.Rules
+	assertPrs(t, to, stored, notYetFetched)
+
+	if !to.IsRateLimitActive(now) || !to.GetRateLimitUntil().Equal(rateLimitUntil) {
+		t.Errorf("expected the rate limit to be imported, got %v", to.GetRateLimitUntil())
+	}
+	if _, found, _ := to.GetPAT(); found {
+		t.Error("expected no PAT to be imported")
+	}
+}
+
+func TestImport_RejectsInvalidState(t *testing.T) {
+	const pr = "https://github.com/o/r/pull/1"
+	for name, state := range map[string]ExportedState{
+		"missing version": {},
+		"future version":  {Version: ExportVersion + 1},
+		"missing url":     {Version: ExportVersion, Buried: []ExportedBury{{LastUpdated: time.Now()}}},
+		"note without pr": {Version: ExportVersion, Notes: []ExportedNote{{Text: "orphan"}}},
+		"tag on nothing":  {Version: ExportVersion, Tags: []ExportedTag{{Tag: "orphan"}}},
+		"rule for all":    {Version: ExportVersion, Rules: []ExportedRule{{Action: "exclude"}}},
+		// held to the same limits as the API
+		"too long note":          {Version: ExportVersion, Notes: []ExportedNote{{PrUrl: pr, Text: strings.Repeat("x", types.MaxNoteBytes+1)}}},
+		"note above the bury":    {Version: ExportVersion, Notes: []ExportedNote{{PrUrl: pr, Points: types.MaxAdjustmentPoints + 1}}},
+		"note below the limit":   {Version: ExportVersion, Notes: []ExportedNote{{PrUrl: pr, Points: -types.MaxAdjustmentPoints - 1}}},
+		"tag with markup":        {Version: ExportVersion, Tags: []ExportedTag{{PrUrl: pr, Tag: "<b>x</b>"}}},
+		"tag without name":       {Version: ExportVersion, Tags: []ExportedTag{{PrUrl: pr}}},
+		"tag points with markup": {Version: ExportVersion, TagPoints: map[string]int{"<b>x</b>": 1}},
+		"tag above the bury":     {Version: ExportVersion, TagPoints: map[string]int{"urgent": 5000}},
+		"rule above the bury":    {Version: ExportVersion, Rules: []ExportedRule{{Repo: "acme/*", Action: "points", Points: 5000}}},
+		"rule with markup":       {Version: ExportVersion, Rules: []ExportedRule{{Author: "<img>", Action: "exclude"}}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			store := NewMemoryStorage(conformanceLogger())
+			_, err := Import(store, state, time.Now())
+			if !errors.Is(err, ErrInvalidState) {
+				t.Errorf("expected ErrInvalidState, got %v", err)
+			}
+			// nothing is imported from an invalid state
+			if notes, _ := store.Notes(); len(notes) > 0 {
+				t.Errorf("expected no notes to be imported, got %+v", notes)
+			}
+			if tagPoints, _ := store.TagPoints(); len(tagPoints) > 0 {
+				t.Errorf("expected no tag points to be imported, got %+v", tagPoints)
+			}
+		})
+	}
+}
+
+func TestImport_NormalizesTags(t *testing.T) {
+	store := NewMemoryStorage(conformanceLogger())
+	state := ExportedState{
+		Version:   ExportVersion,
+		Tags:      []ExportedTag{{Repo: "Acme/Web", Tag: "Release"}},
+		TagPoints: map[string]int{"Release": 100},
+	}
+	if _, err := Import(store, state, time.Now()); err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	tags, err := store.Tags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []StoredTag{{Repo: "acme/web", Tag: "release"}}; !slices.Equal(tags, want) {
+		t.Errorf("expected %+v, got %+v", want, tags)
+	}
+	if tagPoints, _ := store.TagPoints(); tagPoints["release"] != 100 {
+		t.Errorf("expected the points of the lower cased tag, got %+v", tagPoints)
+	}
+}
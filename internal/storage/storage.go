@@ -4,9 +4,12 @@ import (
 	"context"
 	"database/sql"
 	_ "embed"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
+	"math"
+	"slices"
 	"strings"
 	"time"
 
@@ -14,12 +17,6 @@ import (
 	_ "modernc.org/sqlite"
 )
 
-func check(err error) {
-	if err != nil {
-		panic(err)
-	}
-}
-
 // StoredPAT represents a stored PAT with metadata.
 type StoredPAT struct {
 	Token     string
@@ -28,12 +25,102 @@ type StoredPAT struct {
 	ExpiresAt time.Time // Zero time if non-expiring
 }
 
+// PatExpiryWarningDays is how many days before the PAT expires the user is
+// warned about it.
+const PatExpiryWarningDays = 10
+
+// ExpiresInDays returns the whole days left until the PAT expires, negative
+// once it has, and false if it never expires.
+func (p StoredPAT) ExpiresInDays(now time.Time) (int, bool) {
+	if p.ExpiresAt.IsZero() {
+		return 0, false
+	}
+	return int(math.Floor(p.ExpiresAt.Sub(now).Hours() / 24)), true
+}
+
+// ExpiresSoon returns true when the user should be warned that the PAT
+// expires, or has expired.
+func (p StoredPAT) ExpiresSoon(now time.Time) bool {
+	days, expires := p.ExpiresInDays(now)
+	return expires && days < PatExpiryWarningDays
+}
+
+// StoredBury is a decision to bury a PR until it's updated after
+// LastUpdated.
+type StoredBury struct {
+	Url         string
+	LastUpdated time.Time // of the PR, when it was buried
+	BuriedAt    time.Time
+}
+
+// StoredNote is a private note about a PR. Points are added to the PR's
+// points, with the note as the reason.
+type StoredNote struct {
+	PrUrl     string
+	Text      string
+	Points    int
+	UpdatedAt time.Time
+}
+
+// StoredTag labels either a single PR (PrUrl), or all PRs of a repo (Repo, as
+// "owner/name").
+type StoredTag struct {
+	PrUrl string
+	Repo  string
+	Tag   string
+}
+
+// StateImport is what Import stores, once it's validated. RateLimitUntil is
+// zero unless it should replace the stored rate limit.
+type StateImport struct {
+	Buried         []StoredBury
+	Notes          []StoredNote
+	Tags           []StoredTag
+	TagPoints      map[string]int
+	Rules          []types.Rule
+	RateLimitUntil time.Time
+}
+
 type Storage interface {
-	Prs() StoredState
+	Prs() (StoredState, error)
 	StoreRepoPrs(orderedPrs []types.ViewPr) error
 	Bury(prUrl string) error
 	Unbury(prUrl string) error
-	GetPr(prUrl string) (Pr, error)
+	// BuriedPrs returns the buried PRs, including imported ones that haven't
+	// been fetched yet.
+	BuriedPrs() ([]StoredBury, error)
+	// ImportState stores what the user curated in another elly, all of it
+	// or, on error, none of it. Stored PRs are buried right away, unless
+	// they were updated since, and rules that are already stored are
+	// skipped. Returns how many rules were added.
+	ImportState(state StateImport) (int, error)
+	// Notes returns all notes, including those of PRs that aren't stored
+	// (anymore, or yet).
+	Notes() ([]StoredNote, error)
+	// StoreNote creates or replaces the note of note.PrUrl.
+	StoreNote(note StoredNote) error
+	// DeleteNote removes the note of a PR, if there is one.
+	DeleteNote(prUrl string) error
+	// Tags returns all tags of PRs and repos, including those of PRs that
+	// aren't stored.
+	Tags() ([]StoredTag, error)
+	// AddTag tags a PR or a repo, it's a no-op if it's already tagged.
+	AddTag(tag StoredTag) error
+	// RemoveTag removes a tag from a PR or a repo, if it has it.
+	RemoveTag(tag StoredTag) error
+	// TagPoints returns the points of every tag that has any.
+	TagPoints() (map[string]int, error)
+	// SetTagPoints sets the points of every PR with the tag, 0 removes them.
+	SetTagPoints(tag string, points int) error
+	// Rules returns all rules, oldest first.
+	Rules() ([]types.Rule, error)
+	// AddRule stores a new rule, and returns it with its Id.
+	AddRule(rule types.Rule) (types.Rule, error)
+	// DeleteRule removes a rule, if it exists.
+	DeleteRule(id int64) error
+	// GetPr returns a single PR. Returns (pr, true, nil) if found, (zero,
+	// false, nil) if there is no such PR, or (zero, false, err) on error.
+	GetPr(prUrl string) (types.ViewPr, bool, error)
 	// SetRateLimitUntil stores the rate limit expiry time.
 	SetRateLimitUntil(t time.Time) error
 	// IsRateLimitActive returns true if a rate limit is in effect (caller should skip querying).
@@ -41,6 +128,32 @@ type Storage interface {
 	IsRateLimitActive(now time.Time) bool
 	// GetRateLimitUntil returns the rate limit expiry time, or zero time if not rate limited.
 	GetRateLimitUntil() time.Time
+	// StoreRateLimitBudget stores what's left of Github's rate limit, as told
+	// by the latest query.
+	StoreRateLimitBudget(budget types.RateLimitBudget) error
+	// GetRateLimitBudget returns the stored budget. Returns (budget, true,
+	// nil) if found, (zero, false, nil) if none has been stored, or (zero,
+	// false, err) on error.
+	GetRateLimitBudget() (types.RateLimitBudget, bool, error)
+	// StoreBackoffState stores how polling Github backs off, to be restored
+	// after a restart.
+	StoreBackoffState(state types.BackoffState) error
+	// GetBackoffState returns the stored state. Returns (state, true, nil) if
+	// found, (zero, false, nil) if none has been stored, or (zero, false,
+	// err) on error.
+	GetBackoffState() (types.BackoffState, bool, error)
+	// StoreRefresh adds an attempt to fetch PRs to the history of refreshes,
+	// which keeps the latest refreshesKept.
+	StoreRefresh(refresh types.Refresh) error
+	// Refreshes returns the history of refreshes, latest first.
+	Refreshes() ([]types.Refresh, error)
+	// StorePatExpiryNotified remembers that the user was notified that the
+	// PAT expiring at expiresAt is about to expire.
+	StorePatExpiryNotified(expiresAt time.Time) error
+	// GetPatExpiryNotified returns the expiry of the PAT the user was last
+	// notified about. Returns (expiresAt, true, nil) if found, (zero, false,
+	// nil) if the user was never notified, or (zero, false, err) on error.
+	GetPatExpiryNotified() (time.Time, bool, error)
 	// StorePAT stores a new PAT, deactivating any existing active PAT.
 	StorePAT(token, username string, expiresAt time.Time) error
 	// GetPAT returns the active PAT. Returns (pat, true, nil) if found,
@@ -48,6 +161,15 @@ type Storage interface {
 	GetPAT() (StoredPAT, bool, error)
 	// ClearPAT deactivates the active PAT.
 	ClearPAT() error
+	// Close releases the underlying database, nothing may be called after it.
+	Close() error
+	// StoreApiToken stores the token that clients of elly's own API must
+	// present, when authentication is enabled.
+	StoreApiToken(token string) error
+	// GetApiToken returns the stored API token. Returns (token, true, nil) if
+	// found, ("", false, nil) if none has been stored, or ("", false, err) on
+	// error.
+	GetApiToken() (string, bool, error)
 }
 
 type DbStorage struct {
@@ -63,12 +185,20 @@ type StoredState struct {
 	LastFetched time.Time
 }
 
+// refreshesKept is how many refreshes the history keeps, about a day's worth
+// at the default interval.
+const refreshesKept = 100
+
 //go:embed schema.sql
 var ddl string
 
-func NewStorage(logger *slog.Logger, dbPath string) *DbStorage {
-	db, err := sql.Open("sqlite", fmt.Sprintf("file:%s?mode=rwc&_journal_mode=WAL&_synchronous=NORMAL", dbPath))
-	check(err)
+func NewStorage(logger *slog.Logger, dbPath string) (*DbStorage, error) {
+	// WAL lets the GUI read the previous PRs while new ones are being stored,
+	// and the busy timeout makes writers queue up rather than fail
+	db, err := sql.Open("sqlite", fmt.Sprintf("file:%s?mode=rwc&_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)&_pragma=busy_timeout(5000)", dbPath))
+	if err != nil {
+		return nil, fmt.Errorf("could not open database: %w", err)
+	}
 
 	// create tables
 	ctx := context.Background()
@@ -76,97 +206,274 @@ func NewStorage(logger *slog.Logger, dbPath string) *DbStorage {
 		// if this fails, we should drop the old file (throwing away buried data, sadly) and retry to create the tables
 
 		// adjust the schema.sql file by adding a column, to check the behavior. I think there's a NPE or such that we hit
-		check(err)
+		db.Close() //nolint:errcheck // the schema error is more interesting
+		return nil, fmt.Errorf("could not create tables: %w", err)
 	}
 
 	return &DbStorage{
 		db:     New(db),
 		rawDb:  db,
 		logger: logger,
+	}, nil
+}
+
+func (s *DbStorage) Close() error {
+	return s.rawDb.Close()
+}
+
+func viewPrFromDb(dbPr Pr) (types.ViewPr, error) {
+	lastUpdated, err := time.Parse(time.RFC3339, dbPr.LastUpdated)
+	if err != nil {
+		return types.ViewPr{}, fmt.Errorf("could not parse last_updated of %s: %w", dbPr.Url, err)
+	}
+	return types.ViewPr{
+		Url:                      dbPr.Url,
+		ReviewStatus:             dbPr.ReviewStatus,
+		Title:                    dbPr.Title,
+		Author:                   dbPr.Author,
+		RepoName:                 dbPr.RepoName,
+		RepoOwner:                dbPr.RepoOwner,
+		RepoUrl:                  dbPr.RepoUrl,
+		IsDraft:                  dbPr.IsDraft,
+		LastUpdated:              lastUpdated,
+		LastPrCommenter:          dbPr.LastPrCommenter,
+		ThreadsActionable:        int(dbPr.ThreadsActionable),
+		ThreadsWaiting:           int(dbPr.ThreadsWaiting),
+		Additions:                int(dbPr.Additions),
+		Deletions:                int(dbPr.Deletions),
+		ReviewRequestedFromUsers: strings.Split(dbPr.ReviewRequestedFromUsers, ","),
+		Buried:                   dbPr.Buried,
+		RawJsonResponse:          dbPr.RawJsonResponse,
+	}, nil
+}
+
+func reviewThreadFromDb(dbThread ReviewThread) types.ReviewThread {
+	return types.ReviewThread{
+		Url:                dbThread.Url,
+		Actionable:         dbThread.Actionable,
+		Reason:             dbThread.Reason,
+		FirstCommenter:     dbThread.FirstCommenter,
+		LastCommenter:      dbThread.LastCommenter,
+		LastCommentExcerpt: dbThread.LastCommentExcerpt,
+		Comments:           int(dbThread.Comments),
 	}
 }
 
-func (s *DbStorage) Prs() StoredState {
-	dbPrs, err := s.db.ListPrs(context.Background())
-	check(err)
+// Prs returns all stored PRs. PRs that can't be read are skipped, and
+// logged, so that a single corrupt row doesn't hide all the others.
+func (s *DbStorage) Prs() (StoredState, error) {
+	// a single transaction, so that PRs, threads and the fetch time are all
+	// from the same StoreRepoPrs
+	tx, err := s.rawDb.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return StoredState{}, fmt.Errorf("could not begin transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck // read only
+	q := s.db.WithTx(tx)
+
+	dbPrs, err := q.ListPrs(context.Background())
+	if err != nil {
+		return StoredState{}, fmt.Errorf("could not list prs: %w", err)
+	}
+	dbThreads, err := q.ListReviewThreads(context.Background())
+	if err != nil {
+		return StoredState{}, fmt.Errorf("could not list review threads: %w", err)
+	}
+	threadsPerPrUrl := make(map[string][]types.ReviewThread)
+	for _, dbThread := range dbThreads {
+		threadsPerPrUrl[dbThread.PrUrl] = append(threadsPerPrUrl[dbThread.PrUrl], reviewThreadFromDb(dbThread))
+	}
+	dbNotes, err := q.ListNotes(context.Background())
+	if err != nil {
+		return StoredState{}, fmt.Errorf("could not list notes: %w", err)
+	}
+	notesPerPrUrl := make(map[string]Note, len(dbNotes))
+	for _, dbNote := range dbNotes {
+		notesPerPrUrl[dbNote.PrUrl] = dbNote
+	}
+
 	prs := make([]types.ViewPr, 0)
 	for _, dbPr := range dbPrs {
-		lastUpdated, err := time.Parse(time.RFC3339, dbPr.LastUpdated)
-		check(err)
-		prs = append(prs, types.ViewPr{
-			Url:                      dbPr.Url,
-			ReviewStatus:             dbPr.ReviewStatus,
-			Title:                    dbPr.Title,
-			Author:                   dbPr.Author,
-			RepoName:                 dbPr.RepoName,
-			RepoOwner:                dbPr.RepoOwner,
-			RepoUrl:                  dbPr.RepoUrl,
-			IsDraft:                  dbPr.IsDraft,
-			LastUpdated:              lastUpdated,
-			LastPrCommenter:          dbPr.LastPrCommenter,
-			ThreadsActionable:        int(dbPr.ThreadsActionable),
-			ThreadsWaiting:           int(dbPr.ThreadsWaiting),
-			Additions:                int(dbPr.Additions),
-			Deletions:                int(dbPr.Deletions),
-			ReviewRequestedFromUsers: strings.Split(dbPr.ReviewRequestedFromUsers, ","),
-			Buried:                   dbPr.Buried,
-			RawJsonResponse:          dbPr.RawJsonResponse,
-		})
+		pr, err := viewPrFromDb(dbPr)
+		if err != nil {
+			s.logger.Warn("skipping corrupt pr", slog.String("pr_url", dbPr.Url), slog.Any("error", err))
+			corruptPrsSkippedTotal.Inc()
+			continue
+		}
+		pr.ReviewThreads = threadsPerPrUrl[pr.Url]
+		if note, ok := notesPerPrUrl[pr.Url]; ok {
+			pr.Note, pr.NotePoints = note.Text, int(note.Points)
+		}
+		prs = append(prs, pr)
+	}
+	tags, pointsPerTag, err := sqliteTags(context.Background(), q)
+	if err != nil {
+		return StoredState{}, err
+	}
+	withTags(prs, tags, pointsPerTag)
+	rules, err := sqliteRules(context.Background(), q)
+	if err != nil {
+		return StoredState{}, err
 	}
+	withRules(prs, rules)
 
 	state := StoredState{
 		Prs: prs,
 	}
-	if dbLastFetched, err := s.db.GetLastFetched(context.Background()); err == nil {
+	if dbLastFetched, err := q.GetLastFetched(context.Background()); err == nil {
 		if lastFetched, err := time.Parse(time.RFC3339, dbLastFetched); err == nil {
 			state.LastFetched = lastFetched
 		}
 	}
 
-	return state
+	return state, nil
+}
+
+// keepBuried marks orderedPrs as buried if they were buried before, and
+// haven't been updated since. lastUpdatedPerBuriedUrl holds the RFC3339
+// last updated time of the buried PRs, as it was when they were stored.
+func keepBuried(logger *slog.Logger, orderedPrs []types.ViewPr, lastUpdatedPerBuriedUrl map[string]string) {
+	for i, pr := range orderedPrs {
+		storedLastUpdated, buried := lastUpdatedPerBuriedUrl[pr.Url]
+		if !buried {
+			continue
+		}
+		buriedLastUpdated, err := time.Parse(time.RFC3339, storedLastUpdated)
+		if err != nil {
+			// just ignore the stored & old last updated time
+			logger.Info("unburying pr, old last updated time is invalid", slog.String("pr_url", pr.Url))
+			orderedPrs[i].Buried = false
+			continue
+		}
+		if pr.LastUpdated.After(buriedLastUpdated) {
+			// the pr was updated since it was buried
+			logger.Info("unburying pr, it was updated since it was buried",
+				slog.String("pr_url", pr.Url),
+				slog.Time("stored_at", buriedLastUpdated),
+				slog.Time("new_updated_at", pr.LastUpdated),
+			)
+			orderedPrs[i].Buried = false
+			continue
+		}
+		orderedPrs[i].Buried = true
+	}
+}
+
+// withTags sets the Tags of prs, from the tags of the PRs themselves and of
+// their repos. A tag that is on both the PR and its repo is only listed once.
+func withTags(prs []types.ViewPr, tags []StoredTag, pointsPerTag map[string]int) {
+	tagsPerPrUrl := make(map[string][]string)
+	tagsPerRepo := make(map[string][]string)
+	for _, t := range tags {
+		if t.PrUrl != "" {
+			tagsPerPrUrl[t.PrUrl] = append(tagsPerPrUrl[t.PrUrl], t.Tag)
+		} else {
+			// Github doesn't care about the case of owners and repos
+			repo := strings.ToLower(t.Repo)
+			tagsPerRepo[repo] = append(tagsPerRepo[repo], t.Tag)
+		}
+	}
+
+	for i, pr := range prs {
+		var prTags []types.Tag
+		for _, name := range tagsPerPrUrl[pr.Url] {
+			prTags = append(prTags, types.Tag{Name: name, Points: pointsPerTag[name]})
+		}
+		for _, name := range tagsPerRepo[strings.ToLower(pr.RepoOwner+"/"+pr.RepoName)] {
+			if !slices.ContainsFunc(prTags, func(t types.Tag) bool { return t.Name == name }) {
+				prTags = append(prTags, types.Tag{Name: name, Points: pointsPerTag[name], OnRepo: true})
+			}
+		}
+		slices.SortFunc(prTags, func(a, b types.Tag) int { return strings.Compare(a.Name, b.Name) })
+		prs[i].Tags = prTags
+	}
+}
+
+// withRules sets the Rules of prs to the rules that match them.
+func withRules(prs []types.ViewPr, rules []types.Rule) {
+	for i, pr := range prs {
+		var matching []types.Rule
+		for _, rule := range rules {
+			if rule.Matches(pr) {
+				matching = append(matching, rule)
+			}
+		}
+		prs[i].Rules = matching
+	}
+}
+
+// outdatedBuries returns the buried PRs that keepBuried didn't keep buried,
+// since they were either updated or are gone.
+func outdatedBuries(orderedPrs []types.ViewPr, lastUpdatedPerBuriedUrl map[string]string) []string {
+	stillBuried := make(map[string]bool)
+	for _, pr := range orderedPrs {
+		if pr.Buried {
+			stillBuried[pr.Url] = true
+		}
+	}
+	var outdated []string
+	for url := range lastUpdatedPerBuriedUrl {
+		if !stillBuried[url] {
+			outdated = append(outdated, url)
+		}
+	}
+	return outdated
 }
 
+// StoreRepoPrs replaces the stored PRs with orderedPrs, in a single
+// transaction so that readers see either the old or the new PRs, never a mix
+// of them or none at all.
 func (s *DbStorage) StoreRepoPrs(orderedPrs []types.ViewPr) error {
 	s.logger.Debug("storing prs", slog.Int("prs", len(orderedPrs)))
+	ctx := context.Background()
 
-	buriedPrs, err := s.db.BuriedPrs(context.Background())
+	tx, err := s.rawDb.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck // no-op after commit
+	q := s.db.WithTx(tx)
+
+	buriedPrs, err := q.BuryDecisions(ctx)
 	if err != nil {
 		s.logger.Error("could not fetch buried prs, throwing away old buried-status", slog.Any("err", err))
 	} else {
-		// O(n^2) but n is always small, in my case (and the amount of buried prs is usually super small)
-		for i, pr := range orderedPrs {
-			for _, buriedPr := range buriedPrs {
-				if buriedPr.Url == pr.Url {
-					buriedLastUpdated, err := time.Parse(time.RFC3339, buriedPr.LastUpdated)
-					if err != nil {
-						// just ignore the stored & old last updated time
-						s.logger.Info("unburying pr, old last updated time is invalid", slog.String("pr_url", pr.Url))
-						orderedPrs[i].Buried = false
-						break
-					}
-					if pr.LastUpdated.After(buriedLastUpdated) {
-						// the pr was updated since it was buried
-						s.logger.Info("unburying pr, it was updated since it was buried",
-							slog.String("pr_url", pr.Url),
-							slog.Time("stored_at", buriedLastUpdated),
-							slog.Time("new_updated_at", pr.LastUpdated),
-						)
-						orderedPrs[i].Buried = false
-						break
-					}
-					orderedPrs[i].Buried = true
-					break
-				}
+		lastUpdatedPerBuriedUrl := make(map[string]string, len(buriedPrs))
+		for _, buriedPr := range buriedPrs {
+			lastUpdatedPerBuriedUrl[buriedPr.Url] = buriedPr.LastUpdated
+		}
+		keepBuried(s.logger, orderedPrs, lastUpdatedPerBuriedUrl)
+		for _, url := range outdatedBuries(orderedPrs, lastUpdatedPerBuriedUrl) {
+			if err := q.DeleteBuryDecision(ctx, url); err != nil {
+				return fmt.Errorf("could not delete outdated bury of %s: %w", url, err)
 			}
 		}
 	}
 
-	if err := s.db.DeletePrs(context.Background()); err != nil {
-		return fmt.Errorf("could not delete old prs, in preparation of storing new ones: %w", err)
+	storedUrls, err := q.ListPrUrls(ctx)
+	if err != nil {
+		return fmt.Errorf("could not list stored prs: %w", err)
+	}
+	fetchedUrls := make(map[string]bool, len(orderedPrs))
+	for _, pr := range orderedPrs {
+		fetchedUrls[pr.Url] = true
+	}
+	for _, url := range storedUrls {
+		if fetchedUrls[url] {
+			continue
+		}
+		if err := q.DeletePr(ctx, url); err != nil {
+			return fmt.Errorf("could not delete pr %s: %w", url, err)
+		}
+	}
+
+	// threads have no identity of their own, they're replaced wholesale
+	if err := q.DeleteReviewThreads(ctx); err != nil {
+		return fmt.Errorf("could not delete old review threads, in preparation of storing new ones: %w", err)
 	}
 
 	for _, pr := range orderedPrs {
-		_, err := s.db.CreatePr(context.Background(), CreatePrParams{
+		err := q.UpsertPr(ctx, UpsertPrParams{
 			Url:                      pr.Url,
 			ReviewStatus:             pr.ReviewStatus,
 			Title:                    pr.Title,
@@ -185,30 +492,340 @@ func (s *DbStorage) StoreRepoPrs(orderedPrs []types.ViewPr) error {
 			Buried:                   pr.Buried,
 			RawJsonResponse:          pr.RawJsonResponse,
 		})
-		check(err)
+		if err != nil {
+			return fmt.Errorf("could not store pr %s: %w", pr.Url, err)
+		}
+
+		for _, t := range pr.ReviewThreads {
+			err := q.CreateReviewThread(ctx, CreateReviewThreadParams{
+				PrUrl:              pr.Url,
+				Url:                t.Url,
+				Actionable:         t.Actionable,
+				Reason:             t.Reason,
+				FirstCommenter:     t.FirstCommenter,
+				LastCommenter:      t.LastCommenter,
+				LastCommentExcerpt: t.LastCommentExcerpt,
+				Comments:           int64(t.Comments),
+			})
+			if err != nil {
+				return fmt.Errorf("could not store review thread %s: %w", t.Url, err)
+			}
+		}
 	}
 
 	now := time.Now()
 	nowFormatted := now.Format(time.RFC3339)
-	if err := s.db.StoreLastFetched(context.Background(), nowFormatted); err != nil {
+	if err := q.StoreLastFetched(ctx, nowFormatted); err != nil {
 		return fmt.Errorf("could not store last fetched time: %w", err)
 	}
 
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("could not commit prs: %w", err)
+	}
+
 	trackPRs(orderedPrs)
 
 	return nil
 }
 
 func (s *DbStorage) Bury(prUrl string) error {
-	return s.db.Bury(context.Background(), prUrl)
+	ctx := context.Background()
+	tx, err := s.rawDb.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck // no-op after commit
+	q := s.db.WithTx(tx)
+
+	if err := q.BuryStoredPr(ctx, BuryStoredPrParams{BuriedAt: time.Now().UTC().Format(time.RFC3339), Url: prUrl}); err != nil {
+		return fmt.Errorf("could not store bury of %s: %w", prUrl, err)
+	}
+	if err := q.Bury(ctx, prUrl); err != nil {
+		return fmt.Errorf("could not bury %s: %w", prUrl, err)
+	}
+	return tx.Commit()
 }
 
 func (s *DbStorage) Unbury(prUrl string) error {
-	return s.db.Unbury(context.Background(), prUrl)
+	ctx := context.Background()
+	tx, err := s.rawDb.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck // no-op after commit
+	q := s.db.WithTx(tx)
+
+	if err := q.DeleteBuryDecision(ctx, prUrl); err != nil {
+		return fmt.Errorf("could not delete bury of %s: %w", prUrl, err)
+	}
+	if err := q.Unbury(ctx, prUrl); err != nil {
+		return fmt.Errorf("could not unbury %s: %w", prUrl, err)
+	}
+	return tx.Commit()
+}
+
+func (s *DbStorage) BuriedPrs() ([]StoredBury, error) {
+	rows, err := s.db.BuryDecisions(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("could not list buried prs: %w", err)
+	}
+	buried := make([]StoredBury, 0, len(rows))
+	for _, row := range rows {
+		lastUpdated, err := time.Parse(time.RFC3339, row.LastUpdated)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse last_updated of buried %s: %w", row.Url, err)
+		}
+		buriedAt, err := time.Parse(time.RFC3339, row.BuriedAt)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse buried_at of %s: %w", row.Url, err)
+		}
+		buried = append(buried, StoredBury{Url: row.Url, LastUpdated: lastUpdated, BuriedAt: buriedAt})
+	}
+	return buried, nil
+}
+
+func (s *DbStorage) ImportState(state StateImport) (int, error) {
+	ctx := context.Background()
+	tx, err := s.rawDb.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("could not begin transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck // no-op after commit
+	q := s.db.WithTx(tx)
+
+	for _, b := range state.Buried {
+		lastUpdated := b.LastUpdated.Format(time.RFC3339)
+		err := q.StoreBuryDecision(ctx, StoreBuryDecisionParams{
+			Url:         b.Url,
+			LastUpdated: lastUpdated,
+			BuriedAt:    b.BuriedAt.UTC().Format(time.RFC3339),
+		})
+		if err != nil {
+			return 0, fmt.Errorf("could not store bury of %s: %w", b.Url, err)
+		}
+		if err := q.BuryIfUnchanged(ctx, BuryIfUnchangedParams{Url: b.Url, LastUpdated: lastUpdated}); err != nil {
+			return 0, fmt.Errorf("could not bury %s: %w", b.Url, err)
+		}
+	}
+	for _, note := range state.Notes {
+		err := q.StoreNote(ctx, StoreNoteParams{
+			PrUrl:     note.PrUrl,
+			Text:      note.Text,
+			Points:    int64(note.Points),
+			UpdatedAt: note.UpdatedAt.UTC().Format(time.RFC3339),
+		})
+		if err != nil {
+			return 0, fmt.Errorf("could not store note of %s: %w", note.PrUrl, err)
+		}
+	}
+	for _, tag := range state.Tags {
+		if err := q.AddTag(ctx, AddTagParams(tag)); err != nil {
+			return 0, fmt.Errorf("could not add tag %s: %w", tag.Tag, err)
+		}
+	}
+	for tag, points := range state.TagPoints {
+		var err error
+		if points == 0 {
+			err = q.DeleteTagPoints(ctx, tag)
+		} else {
+			err = q.StoreTagPoints(ctx, StoreTagPointsParams{Tag: tag, Points: int64(points)})
+		}
+		if err != nil {
+			return 0, fmt.Errorf("could not store points of tag %s: %w", tag, err)
+		}
+	}
+	existing, err := sqliteRules(ctx, q)
+	if err != nil {
+		return 0, err
+	}
+	added := newRules(existing, state.Rules)
+	for _, rule := range added {
+		if _, err := q.AddRule(ctx, AddRuleParams{Repo: rule.Repo, Author: rule.Author, Action: rule.Action, Points: int64(rule.Points)}); err != nil {
+			return 0, fmt.Errorf("could not add rule: %w", err)
+		}
+	}
+	if !state.RateLimitUntil.IsZero() {
+		if err := q.StoreRateLimitUntil(ctx, state.RateLimitUntil.Format(time.RFC3339)); err != nil {
+			return 0, fmt.Errorf("could not store rate limit: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("could not commit import: %w", err)
+	}
+	return len(added), nil
+}
+
+func (s *DbStorage) Notes() ([]StoredNote, error) {
+	rows, err := s.db.ListNotes(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("could not list notes: %w", err)
+	}
+	notes := make([]StoredNote, 0, len(rows))
+	for _, row := range rows {
+		updatedAt, err := time.Parse(time.RFC3339, row.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse updated_at of the note of %s: %w", row.PrUrl, err)
+		}
+		notes = append(notes, StoredNote{PrUrl: row.PrUrl, Text: row.Text, Points: int(row.Points), UpdatedAt: updatedAt})
+	}
+	return notes, nil
+}
+
+func (s *DbStorage) StoreNote(note StoredNote) error {
+	err := s.db.StoreNote(context.Background(), StoreNoteParams{
+		PrUrl:     note.PrUrl,
+		Text:      note.Text,
+		Points:    int64(note.Points),
+		UpdatedAt: note.UpdatedAt.UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return fmt.Errorf("could not store note of %s: %w", note.PrUrl, err)
+	}
+	return nil
+}
+
+func (s *DbStorage) DeleteNote(prUrl string) error {
+	if err := s.db.DeleteNote(context.Background(), prUrl); err != nil {
+		return fmt.Errorf("could not delete note of %s: %w", prUrl, err)
+	}
+	return nil
+}
+
+func (s *DbStorage) GetPr(prUrl string) (types.ViewPr, bool, error) {
+	tx, err := s.rawDb.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return types.ViewPr{}, false, fmt.Errorf("could not begin transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck // read only
+	q := s.db.WithTx(tx)
+
+	dbPr, err := q.GetPr(context.Background(), prUrl)
+	if errors.Is(err, sql.ErrNoRows) {
+		return types.ViewPr{}, false, nil
+	}
+	if err != nil {
+		return types.ViewPr{}, false, fmt.Errorf("could not get pr: %w", err)
+	}
+	pr, err := viewPrFromDb(dbPr)
+	if err != nil {
+		return types.ViewPr{}, false, err
+	}
+	dbThreads, err := q.ListReviewThreadsForPr(context.Background(), prUrl)
+	if err != nil {
+		return types.ViewPr{}, false, fmt.Errorf("could not get review threads of pr: %w", err)
+	}
+	for _, dbThread := range dbThreads {
+		pr.ReviewThreads = append(pr.ReviewThreads, reviewThreadFromDb(dbThread))
+	}
+	note, err := q.GetNote(context.Background(), prUrl)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return types.ViewPr{}, false, fmt.Errorf("could not get note of pr: %w", err)
+	}
+	pr.Note, pr.NotePoints = note.Text, int(note.Points)
+	tags, pointsPerTag, err := sqliteTags(context.Background(), q)
+	if err != nil {
+		return types.ViewPr{}, false, err
+	}
+	rules, err := sqliteRules(context.Background(), q)
+	if err != nil {
+		return types.ViewPr{}, false, err
+	}
+	prs := []types.ViewPr{pr}
+	withTags(prs, tags, pointsPerTag)
+	withRules(prs, rules)
+	return prs[0], true, nil
+}
+
+func sqliteRules(ctx context.Context, q *Queries) ([]types.Rule, error) {
+	dbRules, err := q.ListRules(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not list rules: %w", err)
+	}
+	rules := make([]types.Rule, 0, len(dbRules))
+	for _, dbRule := range dbRules {
+		rules = append(rules, ruleFromDb(dbRule))
+	}
+	return rules, nil
+}
+
+func ruleFromDb(dbRule Rule) types.Rule {
+	return types.Rule{Id: dbRule.ID, Repo: dbRule.Repo, Author: dbRule.Author, Action: dbRule.Action, Points: int(dbRule.Points)}
+}
+
+func (s *DbStorage) Rules() ([]types.Rule, error) {
+	return sqliteRules(context.Background(), s.db)
+}
+
+func (s *DbStorage) AddRule(rule types.Rule) (types.Rule, error) {
+	dbRule, err := s.db.AddRule(context.Background(), AddRuleParams{Repo: rule.Repo, Author: rule.Author, Action: rule.Action, Points: int64(rule.Points)})
+	if err != nil {
+		return types.Rule{}, fmt.Errorf("could not add rule: %w", err)
+	}
+	return ruleFromDb(dbRule), nil
+}
+
+func (s *DbStorage) DeleteRule(id int64) error {
+	if err := s.db.DeleteRule(context.Background(), id); err != nil {
+		return fmt.Errorf("could not delete rule %d: %w", id, err)
+	}
+	return nil
+}
+
+func sqliteTags(ctx context.Context, q *Queries) ([]StoredTag, map[string]int, error) {
+	dbTags, err := q.ListTags(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not list tags: %w", err)
+	}
+	tags := make([]StoredTag, 0, len(dbTags))
+	for _, dbTag := range dbTags {
+		tags = append(tags, StoredTag(dbTag))
+	}
+	dbPoints, err := q.ListTagPoints(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not list tag points: %w", err)
+	}
+	pointsPerTag := make(map[string]int, len(dbPoints))
+	for _, p := range dbPoints {
+		pointsPerTag[p.Tag] = int(p.Points)
+	}
+	return tags, pointsPerTag, nil
+}
+
+func (s *DbStorage) Tags() ([]StoredTag, error) {
+	tags, _, err := sqliteTags(context.Background(), s.db)
+	return tags, err
+}
+
+func (s *DbStorage) AddTag(tag StoredTag) error {
+	if err := s.db.AddTag(context.Background(), AddTagParams(tag)); err != nil {
+		return fmt.Errorf("could not add tag %s: %w", tag.Tag, err)
+	}
+	return nil
+}
+
+func (s *DbStorage) RemoveTag(tag StoredTag) error {
+	if err := s.db.RemoveTag(context.Background(), RemoveTagParams(tag)); err != nil {
+		return fmt.Errorf("could not remove tag %s: %w", tag.Tag, err)
+	}
+	return nil
+}
+
+func (s *DbStorage) TagPoints() (map[string]int, error) {
+	_, pointsPerTag, err := sqliteTags(context.Background(), s.db)
+	return pointsPerTag, err
 }
 
-func (s *DbStorage) GetPr(prUrl string) (Pr, error) {
-	return s.db.GetPr(context.Background(), prUrl)
+func (s *DbStorage) SetTagPoints(tag string, points int) error {
+	var err error
+	if points == 0 {
+		err = s.db.DeleteTagPoints(context.Background(), tag)
+	} else {
+		err = s.db.StoreTagPoints(context.Background(), StoreTagPointsParams{Tag: tag, Points: int64(points)})
+	}
+	if err != nil {
+		return fmt.Errorf("could not store points of tag %s: %w", tag, err)
+	}
+	return nil
 }
 
 func (s *DbStorage) SetRateLimitUntil(t time.Time) error {
@@ -254,6 +871,130 @@ func (s *DbStorage) GetRateLimitUntil() time.Time {
 	return rateLimitUntil
 }
 
+func (s *DbStorage) StoreRateLimitBudget(budget types.RateLimitBudget) error {
+	val, err := metaToJson(budget, "rate limit budget")
+	if err != nil {
+		return err
+	}
+	if err := s.db.StoreRateLimitBudget(context.Background(), val); err != nil {
+		return fmt.Errorf("could not store rate limit budget: %w", err)
+	}
+	return nil
+}
+
+func (s *DbStorage) GetRateLimitBudget() (types.RateLimitBudget, bool, error) {
+	val, err := s.db.GetRateLimitBudget(context.Background())
+	return metaFromJson[types.RateLimitBudget](val, err, "rate limit budget")
+}
+
+func (s *DbStorage) StoreBackoffState(state types.BackoffState) error {
+	val, err := metaToJson(state, "backoff state")
+	if err != nil {
+		return err
+	}
+	if err := s.db.StoreBackoffState(context.Background(), val); err != nil {
+		return fmt.Errorf("could not store backoff state: %w", err)
+	}
+	return nil
+}
+
+func (s *DbStorage) GetBackoffState() (types.BackoffState, bool, error) {
+	val, err := s.db.GetBackoffState(context.Background())
+	return metaFromJson[types.BackoffState](val, err, "backoff state")
+}
+
+func (s *DbStorage) StorePatExpiryNotified(expiresAt time.Time) error {
+	val, err := metaToJson(expiresAt, "PAT expiry notification")
+	if err != nil {
+		return err
+	}
+	if err := s.db.StorePatExpiryNotified(context.Background(), val); err != nil {
+		return fmt.Errorf("could not store PAT expiry notification: %w", err)
+	}
+	return nil
+}
+
+func (s *DbStorage) GetPatExpiryNotified() (time.Time, bool, error) {
+	val, err := s.db.GetPatExpiryNotified(context.Background())
+	return metaFromJson[time.Time](val, err, "PAT expiry notification")
+}
+
+func (s *DbStorage) StoreRefresh(refresh types.Refresh) error {
+	ctx := context.Background()
+	tx, err := s.rawDb.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck // no-op after commit
+	q := s.db.WithTx(tx)
+
+	if err := q.AddRefresh(ctx, AddRefreshParams{
+		StartedAt:  refresh.StartedAt.UTC().Format(time.RFC3339Nano),
+		DurationMs: refresh.Duration.Milliseconds(),
+		Kind:       refresh.Kind,
+		Prs:        int64(refresh.Prs),
+		Outcome:    refresh.Outcome,
+		ErrorClass: refresh.ErrorClass,
+		Error:      refresh.Error,
+	}); err != nil {
+		return fmt.Errorf("could not store refresh: %w", err)
+	}
+	if err := q.TrimRefreshes(ctx, refreshesKept); err != nil {
+		return fmt.Errorf("could not forget old refreshes: %w", err)
+	}
+	return tx.Commit()
+}
+
+func (s *DbStorage) Refreshes() ([]types.Refresh, error) {
+	rows, err := s.db.ListRefreshes(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("could not list refreshes: %w", err)
+	}
+	refreshes := make([]types.Refresh, 0, len(rows))
+	for _, row := range rows {
+		startedAt, err := time.Parse(time.RFC3339Nano, row.StartedAt)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse started_at of refresh %d: %w", row.ID, err)
+		}
+		refreshes = append(refreshes, types.Refresh{
+			StartedAt:  startedAt,
+			Duration:   time.Duration(row.DurationMs) * time.Millisecond,
+			Kind:       row.Kind,
+			Prs:        int(row.Prs),
+			Outcome:    row.Outcome,
+			ErrorClass: row.ErrorClass,
+			Error:      row.Error,
+		})
+	}
+	return refreshes, nil
+}
+
+// metaToJson and metaFromJson are for the meta values that are structs, what
+// names the value in errors.
+func metaToJson(v any, what string) (string, error) {
+	val, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("could not marshal %s: %w", what, err)
+	}
+	return string(val), nil
+}
+
+// metaFromJson takes the result of reading the meta value, and returns it like
+// the storage getters do.
+func metaFromJson[T any](val string, err error, what string) (T, bool, error) {
+	var v T
+	if errors.Is(err, sql.ErrNoRows) {
+		return v, false, nil
+	}
+	if err != nil {
+		return v, false, fmt.Errorf("could not read %s: %w", what, err)
+	}
+	if err := json.Unmarshal([]byte(val), &v); err != nil {
+		return v, false, fmt.Errorf("could not unmarshal %s: %w", what, err)
+	}
+	return v, true, nil
+}
+
 func (s *DbStorage) StorePAT(token, username string, expiresAt time.Time) error {
 	ctx := context.Background()
 	tx, err := s.rawDb.BeginTx(ctx, nil)
@@ -326,3 +1067,21 @@ func (s *DbStorage) ClearPAT() error {
 	}
 	return nil
 }
+
+func (s *DbStorage) StoreApiToken(token string) error {
+	if err := s.db.StoreApiToken(context.Background(), token); err != nil {
+		return fmt.Errorf("could not store API token: %w", err)
+	}
+	return nil
+}
+
+func (s *DbStorage) GetApiToken() (string, bool, error) {
+	token, err := s.db.GetApiToken(context.Background())
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("could not get API token: %w", err)
+	}
+	return token, true, nil
+}
@@ -16,10 +16,16 @@ func NewStorageDemo() *StorageDemo {
 	return &StorageDemo{}
 }
 
-func (s *StorageDemo) Prs() StoredState {
+func (s *StorageDemo) Prs() (StoredState, error) {
 	prs := make([]types.ViewPr, 0)
 	lastUpdated := time.Now().UTC()
 
+	pr1Threads := []types.ReviewThread{
+		{Url: "#1", Actionable: true, Reason: "Someone else commented last on our PR", FirstCommenter: "channy2011", LastCommenter: "channy2011", LastCommentExcerpt: "Should the template live in the repo root instead?", Comments: 1},
+		{Url: "#2", Actionable: true, Reason: "Someone reacted to our comment on our PR", FirstCommenter: "bierden22", LastCommenter: "chelmertz", LastCommentExcerpt: "Good catch, renamed it", Comments: 2},
+		{Url: "#3", Actionable: false, Reason: "We commented last, waiting for a reply or a resolve", FirstCommenter: "chelmertz", LastCommenter: "chelmertz", LastCommentExcerpt: "Can we drop the bash version now?", Comments: 1},
+	}
+
 	pr1 := types.ViewPr{
 		Url:                      "1", // points is calculated based on PR URL, must be unique
 		ReviewStatus:             "",
@@ -31,8 +37,9 @@ func (s *StorageDemo) Prs() StoredState {
 		IsDraft:                  false,
 		LastUpdated:              lastUpdated,
 		LastPrCommenter:          "",
-		ThreadsActionable:        3,
-		ThreadsWaiting:           2,
+		ThreadsActionable:        2,
+		ThreadsWaiting:           1,
+		ReviewThreads:            pr1Threads,
 		Additions:                32,
 		Deletions:                15,
 		ReviewRequestedFromUsers: []string{},
@@ -103,7 +110,7 @@ func (s *StorageDemo) Prs() StoredState {
 		LastFetched: time.Now().UTC(),
 	}
 
-	return state
+	return state, nil
 }
 
 func (s *StorageDemo) StoreRepoPrs(orderedPrs []types.ViewPr) error {
@@ -118,8 +125,66 @@ func (s *StorageDemo) Unbury(prUrl string) error {
 	return nil
 }
 
-func (s *StorageDemo) GetPr(prUrl string) (Pr, error) {
-	return Pr{}, nil
+func (s *StorageDemo) BuriedPrs() ([]StoredBury, error) {
+	return nil, nil
+}
+
+func (s *StorageDemo) ImportState(state StateImport) (int, error) {
+	return 0, nil
+}
+
+func (s *StorageDemo) Notes() ([]StoredNote, error) {
+	return nil, nil
+}
+
+func (s *StorageDemo) StoreNote(note StoredNote) error {
+	return nil
+}
+
+func (s *StorageDemo) DeleteNote(prUrl string) error {
+	return nil
+}
+
+func (s *StorageDemo) Tags() ([]StoredTag, error) {
+	return nil, nil
+}
+
+func (s *StorageDemo) AddTag(tag StoredTag) error {
+	return nil
+}
+
+func (s *StorageDemo) RemoveTag(tag StoredTag) error {
+	return nil
+}
+
+func (s *StorageDemo) TagPoints() (map[string]int, error) {
+	return nil, nil
+}
+
+func (s *StorageDemo) SetTagPoints(tag string, points int) error {
+	return nil
+}
+
+func (s *StorageDemo) Rules() ([]types.Rule, error) {
+	return nil, nil
+}
+
+func (s *StorageDemo) AddRule(rule types.Rule) (types.Rule, error) {
+	return rule, nil
+}
+
+func (s *StorageDemo) DeleteRule(id int64) error {
+	return nil
+}
+
+func (s *StorageDemo) GetPr(prUrl string) (types.ViewPr, bool, error) {
+	state, _ := s.Prs()
+	for _, pr := range state.Prs {
+		if pr.Url == prUrl {
+			return pr, true, nil
+		}
+	}
+	return types.ViewPr{}, false, nil
 }
 
 func (s *StorageDemo) SetRateLimitUntil(t time.Time) error {
@@ -134,6 +199,41 @@ func (s *StorageDemo) GetRateLimitUntil() time.Time {
 	return time.Time{}
 }
 
+func (s *StorageDemo) StoreRateLimitBudget(budget types.RateLimitBudget) error {
+	return nil
+}
+
+func (s *StorageDemo) GetRateLimitBudget() (types.RateLimitBudget, bool, error) {
+	return types.RateLimitBudget{Cost: 1, Remaining: 4321, Limit: 5000, ResetAt: time.Now().Add(42 * time.Minute)}, true, nil
+}
+
+func (s *StorageDemo) StoreBackoffState(state types.BackoffState) error {
+	return nil
+}
+
+func (s *StorageDemo) GetBackoffState() (types.BackoffState, bool, error) {
+	return types.BackoffState{}, false, nil
+}
+
+func (s *StorageDemo) StorePatExpiryNotified(expiresAt time.Time) error {
+	return nil
+}
+
+func (s *StorageDemo) GetPatExpiryNotified() (time.Time, bool, error) {
+	return time.Time{}, false, nil
+}
+
+func (s *StorageDemo) StoreRefresh(refresh types.Refresh) error {
+	return nil
+}
+
+func (s *StorageDemo) Refreshes() ([]types.Refresh, error) {
+	return []types.Refresh{
+		{StartedAt: time.Now().Add(-2 * time.Minute), Duration: 1200 * time.Millisecond, Kind: types.RefreshChanged, Prs: 3, Outcome: types.RefreshSucceeded},
+		{StartedAt: time.Now().Add(-12 * time.Minute), Duration: 10 * time.Second, Kind: types.RefreshFull, Outcome: types.RefreshFailed, ErrorClass: types.ErrorClassServer, Error: "github returned server error: github response code 502"},
+	}, nil
+}
+
 func (s *StorageDemo) StorePAT(token, username string, expiresAt time.Time) error {
 	return nil
 }
@@ -150,3 +250,15 @@ func (s *StorageDemo) GetPAT() (StoredPAT, bool, error) {
 func (s *StorageDemo) ClearPAT() error {
 	return nil
 }
+
+func (s *StorageDemo) Close() error {
+	return nil
+}
+
+func (s *StorageDemo) StoreApiToken(token string) error {
+	return nil
+}
+
+func (s *StorageDemo) GetApiToken() (string, bool, error) {
+	return "", false, nil
+}
@@ -19,6 +19,21 @@ var (
 		Help: "Total number of unique PRs seen since startup.",
 	})
 
+	corruptPrsSkippedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "elly_corrupt_prs_skipped_total",
+		Help: "Total number of stored PRs that could not be read, and were left out.",
+	})
+
+	backupsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "elly_backups_total",
+		Help: "Total number of database backups, by result.",
+	}, []string{"result"})
+
+	lastBackupTimestamp = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "elly_last_backup_timestamp_seconds",
+		Help: "Unix time of the last successful database backup.",
+	})
+
 	seenMu  sync.Mutex
 	seenPRs = make(map[string]struct{})
 )
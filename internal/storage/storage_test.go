@@ -1,20 +1,36 @@
 package storage
 
 import (
+	"fmt"
 	"io"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"log/slog"
+
+	"github.com/chelmertz/elly/internal/types"
 )
 
 func setupTestStorage(t *testing.T) *DbStorage {
 	t.Helper()
 	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
-	store := NewStorage(logger, ":memory:")
+	store, err := NewStorage(logger, ":memory:")
+	if err != nil {
+		t.Fatalf("NewStorage failed: %v", err)
+	}
 	return store
 }
 
+func storedPrs(t *testing.T, store *DbStorage) []types.ViewPr {
+	t.Helper()
+	state, err := store.Prs()
+	if err != nil {
+		t.Fatalf("Prs failed: %v", err)
+	}
+	return state.Prs
+}
+
 func TestStorePAT_InsertsNewPATAsActive(t *testing.T) {
 	store := setupTestStorage(t)
 
@@ -165,3 +181,272 @@ func TestStorePAT_PreservesExpirationTime(t *testing.T) {
 		t.Errorf("expected expiration %v, got %v", expiresAt, got.ExpiresAt)
 	}
 }
+
+func TestStoredPAT_ExpiresInDays(t *testing.T) {
+	now := time.Date(2025, 6, 15, 12, 0, 0, 0, time.UTC)
+	for _, tt := range []struct {
+		expiresAt  time.Time
+		wantDays   int
+		wantSoon   bool
+		wantExpiry bool
+	}{
+		{expiresAt: time.Time{}, wantDays: 0, wantSoon: false, wantExpiry: false},
+		{expiresAt: now.Add(30 * 24 * time.Hour), wantDays: 30, wantSoon: false, wantExpiry: true},
+		{expiresAt: now.Add(10 * 24 * time.Hour), wantDays: 10, wantSoon: false, wantExpiry: true},
+		{expiresAt: now.Add(10*24*time.Hour - time.Minute), wantDays: 9, wantSoon: true, wantExpiry: true},
+		{expiresAt: now.Add(time.Hour), wantDays: 0, wantSoon: true, wantExpiry: true},
+		{expiresAt: now.Add(-time.Hour), wantDays: -1, wantSoon: true, wantExpiry: true},
+	} {
+		pat := StoredPAT{ExpiresAt: tt.expiresAt}
+		days, expires := pat.ExpiresInDays(now)
+		if days != tt.wantDays || expires != tt.wantExpiry {
+			t.Errorf("expiring at %v: got %d days (expires: %v), want %d (%v)", tt.expiresAt, days, expires, tt.wantDays, tt.wantExpiry)
+		}
+		if soon := pat.ExpiresSoon(now); soon != tt.wantSoon {
+			t.Errorf("expiring at %v: got ExpiresSoon %v, want %v", tt.expiresAt, soon, tt.wantSoon)
+		}
+	}
+}
+
+func TestGetPr_FindsStoredPr(t *testing.T) {
+	store := setupTestStorage(t)
+
+	lastUpdated := time.Date(2025, 6, 15, 12, 0, 0, 0, time.UTC)
+	err := store.StoreRepoPrs([]types.ViewPr{
+		{Url: "https://github.com/o/r/pull/1", Title: "a title", LastUpdated: lastUpdated, RawJsonResponse: []byte(`{}`)},
+	})
+	if err != nil {
+		t.Fatalf("StoreRepoPrs failed: %v", err)
+	}
+
+	got, found, err := store.GetPr("https://github.com/o/r/pull/1")
+	if err != nil {
+		t.Fatalf("GetPr failed: %v", err)
+	}
+	if !found {
+		t.Fatal("expected PR to be found")
+	}
+	if got.Title != "a title" || !got.LastUpdated.Equal(lastUpdated) {
+		t.Errorf("unexpected PR: %+v", got)
+	}
+
+	_, found, err = store.GetPr("https://github.com/o/r/pull/2")
+	if err != nil {
+		t.Fatalf("GetPr returned unexpected error: %v", err)
+	}
+	if found {
+		t.Fatal("expected found=false for an unknown PR")
+	}
+}
+
+func TestStoreRepoPrs_ReplacesReviewThreads(t *testing.T) {
+	store := setupTestStorage(t)
+
+	thread := types.ReviewThread{Url: "https://github.com/o/r/pull/1#discussion_r1", Actionable: true, Reason: "a reason", FirstCommenter: "a", LastCommenter: "b", LastCommentExcerpt: "what?", Comments: 2}
+	pr := types.ViewPr{Url: "https://github.com/o/r/pull/1", LastUpdated: time.Now(), RawJsonResponse: []byte(`{}`), ReviewThreads: []types.ReviewThread{thread}}
+	if err := store.StoreRepoPrs([]types.ViewPr{pr}); err != nil {
+		t.Fatalf("StoreRepoPrs failed: %v", err)
+	}
+
+	prs := storedPrs(t, store)
+	if len(prs) != 1 || len(prs[0].ReviewThreads) != 1 || prs[0].ReviewThreads[0] != thread {
+		t.Fatalf("expected the review thread to be stored with the PR, got %+v", prs)
+	}
+
+	pr.ReviewThreads = nil
+	if err := store.StoreRepoPrs([]types.ViewPr{pr}); err != nil {
+		t.Fatalf("StoreRepoPrs failed: %v", err)
+	}
+	got, _, err := store.GetPr(pr.Url)
+	if err != nil {
+		t.Fatalf("GetPr failed: %v", err)
+	}
+	if len(got.ReviewThreads) != 0 {
+		t.Errorf("expected old review threads to be replaced, got %+v", got.ReviewThreads)
+	}
+}
+
+func TestStoreRepoPrs_UpsertsAndDeletesGonePrs(t *testing.T) {
+	store := setupTestStorage(t)
+
+	lastUpdated := time.Now().Truncate(time.Second)
+	gone := types.ViewPr{Url: "https://github.com/o/r/pull/1", Title: "gone", LastUpdated: lastUpdated, RawJsonResponse: []byte(`{}`)}
+	kept := types.ViewPr{Url: "https://github.com/o/r/pull/2", Title: "old title", LastUpdated: lastUpdated, RawJsonResponse: []byte(`{}`)}
+	if err := store.StoreRepoPrs([]types.ViewPr{gone, kept}); err != nil {
+		t.Fatalf("StoreRepoPrs failed: %v", err)
+	}
+	if err := store.Bury(kept.Url); err != nil {
+		t.Fatalf("Bury failed: %v", err)
+	}
+
+	kept.Title = "new title"
+	added := types.ViewPr{Url: "https://github.com/o/r/pull/3", Title: "added", LastUpdated: lastUpdated, RawJsonResponse: []byte(`{}`)}
+	if err := store.StoreRepoPrs([]types.ViewPr{kept, added}); err != nil {
+		t.Fatalf("StoreRepoPrs failed: %v", err)
+	}
+
+	prs := storedPrs(t, store)
+	titles := make(map[string]string)
+	for _, pr := range prs {
+		titles[pr.Url] = pr.Title
+	}
+	if len(prs) != 2 || titles[kept.Url] != "new title" || titles[added.Url] != "added" {
+		t.Fatalf("expected the kept PR to be updated and the gone PR to be deleted, got %v", titles)
+	}
+
+	got, _, err := store.GetPr(kept.Url)
+	if err != nil {
+		t.Fatalf("GetPr failed: %v", err)
+	}
+	if !got.Buried {
+		t.Error("expected the kept PR to still be buried, it wasn't updated")
+	}
+}
+
+func TestStoreRepoPrs_FailureKeepsOldPrs(t *testing.T) {
+	store := setupTestStorage(t)
+
+	old := types.ViewPr{Url: "https://github.com/o/r/pull/1", Title: "old", LastUpdated: time.Now(), RawJsonResponse: []byte(`{}`)}
+	if err := store.StoreRepoPrs([]types.ViewPr{old}); err != nil {
+		t.Fatalf("StoreRepoPrs failed: %v", err)
+	}
+
+	// raw_json_response is not null, so the second PR can't be stored
+	valid := types.ViewPr{Url: "https://github.com/o/r/pull/2", LastUpdated: time.Now(), RawJsonResponse: []byte(`{}`)}
+	invalid := types.ViewPr{Url: "https://github.com/o/r/pull/3", LastUpdated: time.Now()}
+	if err := store.StoreRepoPrs([]types.ViewPr{valid, invalid}); err == nil {
+		t.Fatal("expected an error when a PR can't be stored")
+	}
+
+	prs := storedPrs(t, store)
+	if len(prs) != 1 || prs[0].Url != old.Url {
+		t.Fatalf("expected the old PRs to be left as they were, got %+v", prs)
+	}
+}
+
+func TestImportState_FailureImportsNothing(t *testing.T) {
+	store := setupTestStorage(t)
+
+	// the rules are imported last, so the rest has been written when it fails
+	if _, err := store.rawDb.Exec("drop table rules"); err != nil {
+		t.Fatalf("could not drop the rules: %v", err)
+	}
+	_, err := store.ImportState(StateImport{
+		Buried: []StoredBury{{Url: "https://github.com/o/r/pull/1", LastUpdated: time.Now(), BuriedAt: time.Now()}},
+		Notes:  []StoredNote{{PrUrl: "https://github.com/o/r/pull/1", Text: "later", UpdatedAt: time.Now()}},
+		Rules:  []types.Rule{{Author: "*[bot]", Action: types.RuleExclude}},
+	})
+	if err == nil {
+		t.Fatal("expected an error when the rules can't be stored")
+	}
+
+	if buried, err := store.BuriedPrs(); err != nil || len(buried) > 0 {
+		t.Errorf("expected no buried PRs to be imported, got %+v, %v", buried, err)
+	}
+	if notes, err := store.Notes(); err != nil || len(notes) > 0 {
+		t.Errorf("expected no notes to be imported, got %+v, %v", notes, err)
+	}
+}
+
+func TestStoreRepoPrs_ReadersSeeAllOrNothing(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	store, err := NewStorage(logger, filepath.Join(t.TempDir(), "elly.db"))
+	if err != nil {
+		t.Fatalf("NewStorage failed: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	prsOfSize := func(n int) []types.ViewPr {
+		prs := make([]types.ViewPr, n)
+		for i := range prs {
+			prs[i] = types.ViewPr{Url: fmt.Sprintf("https://github.com/o/r/pull/%d", i), LastUpdated: time.Now(), RawJsonResponse: []byte(`{}`)}
+		}
+		return prs
+	}
+	small, large := prsOfSize(5), prsOfSize(50)
+	if err := store.StoreRepoPrs(small); err != nil {
+		t.Fatalf("StoreRepoPrs failed: %v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := range 20 {
+			prs := small
+			if i%2 == 0 {
+				prs = large
+			}
+			if err := store.StoreRepoPrs(prs); err != nil {
+				t.Errorf("StoreRepoPrs failed: %v", err)
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		state, err := store.Prs()
+		if err != nil {
+			t.Fatalf("Prs failed: %v", err)
+		}
+		if n := len(state.Prs); n != len(small) && n != len(large) {
+			t.Fatalf("read a partially stored set of %d PRs", n)
+		}
+	}
+}
+
+func TestPrs_SkipsCorruptPrs(t *testing.T) {
+	store := setupTestStorage(t)
+
+	ok := types.ViewPr{Url: "https://github.com/o/r/pull/1", LastUpdated: time.Now(), RawJsonResponse: []byte(`{}`)}
+	corrupt := types.ViewPr{Url: "https://github.com/o/r/pull/2", LastUpdated: time.Now(), RawJsonResponse: []byte(`{}`)}
+	if err := store.StoreRepoPrs([]types.ViewPr{ok, corrupt}); err != nil {
+		t.Fatalf("StoreRepoPrs failed: %v", err)
+	}
+	if _, err := store.rawDb.Exec("update prs set last_updated = 'yesterday' where url = ?", corrupt.Url); err != nil {
+		t.Fatal(err)
+	}
+
+	prs := storedPrs(t, store)
+	if len(prs) != 1 || prs[0].Url != ok.Url {
+		t.Fatalf("expected only the readable PR, got %+v", prs)
+	}
+}
+
+func TestNewStorage_KeepsPrsBuriedBeforeBuryDecisions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "elly.db")
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	store, err := NewStorage(logger, path)
+	if err != nil {
+		t.Fatalf("NewStorage failed: %v", err)
+	}
+	pr := types.ViewPr{Url: "https://github.com/o/r/pull/1", LastUpdated: time.Now(), RawJsonResponse: []byte(`{}`)}
+	if err := store.StoreRepoPrs([]types.ViewPr{pr}); err != nil {
+		t.Fatalf("StoreRepoPrs failed: %v", err)
+	}
+	if err := store.Bury(pr.Url); err != nil {
+		t.Fatalf("Bury failed: %v", err)
+	}
+	// as if buried by an elly from before bury_decisions
+	if _, err := store.rawDb.Exec("delete from bury_decisions"); err != nil {
+		t.Fatalf("could not delete bury decisions: %v", err)
+	}
+	store.Close() //nolint:errcheck // reopened below
+
+	store, err = NewStorage(logger, path)
+	if err != nil {
+		t.Fatalf("NewStorage failed: %v", err)
+	}
+	defer store.Close() //nolint:errcheck // test cleanup
+	buried, err := store.BuriedPrs()
+	if err != nil {
+		t.Fatalf("BuriedPrs failed: %v", err)
+	}
+	if len(buried) != 1 || buried[0].Url != pr.Url {
+		t.Fatalf("expected the buried PR to be kept, got %+v", buried)
+	}
+}
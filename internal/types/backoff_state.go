@@ -0,0 +1,14 @@
+package types
+
+import "time"
+
+// BackoffState is what the polling of Github remembers across restarts, so
+// that a restart doesn't start polling as if Github was fine.
+type BackoffState struct {
+	Multiplier          float64
+	ConsecutiveOK       int
+	ConsecutiveFailures int
+	CircuitOpenUntil    time.Time // zero while the circuit is closed
+	NextPollAt          time.Time
+	NextPollReason      string
+}
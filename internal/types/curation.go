@@ -0,0 +1,43 @@
+package types
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// The limits of what the user curates, whether it's through the API or an
+// import.
+const (
+	MaxNoteBytes = 4096
+	// of notes, tags and rules, stays below the penalty of a buried PR
+	MaxAdjustmentPoints = 999
+)
+
+var validTag = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,49}$`)
+
+// NormalizeTag returns tag lower cased, or what's wrong with it.
+func NormalizeTag(tag string) (string, error) {
+	tag = strings.ToLower(tag)
+	if !validTag.MatchString(tag) {
+		return "", fmt.Errorf("tag must be 1-50 letters, digits, '.', '_' or '-', starting with a letter or digit")
+	}
+	return tag, nil
+}
+
+// ValidateNote returns what's wrong with a note, if anything.
+func ValidateNote(text string, points int) error {
+	if len(text) > MaxNoteBytes {
+		return fmt.Errorf("text must be at most %d bytes", MaxNoteBytes)
+	}
+	return ValidatePoints(points)
+}
+
+// ValidatePoints returns an error unless points are within
+// ±MaxAdjustmentPoints.
+func ValidatePoints(points int) error {
+	if points < -MaxAdjustmentPoints || points > MaxAdjustmentPoints {
+		return fmt.Errorf("points must be between %d and %d", -MaxAdjustmentPoints, MaxAdjustmentPoints)
+	}
+	return nil
+}
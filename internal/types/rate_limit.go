@@ -0,0 +1,12 @@
+package types
+
+import "time"
+
+// RateLimitBudget is what's left of Github's GraphQL rate limit, in points, as
+// told by the latest query. The budget is refilled at ResetAt.
+type RateLimitBudget struct {
+	Cost      int // of the latest query
+	Remaining int
+	Limit     int
+	ResetAt   time.Time
+}
@@ -0,0 +1,31 @@
+package types
+
+import "time"
+
+const (
+	RefreshFull    = "full"    // every PR was fetched
+	RefreshChanged = "changed" // only the PRs updated since the last refresh
+	RefreshProbe   = "probe"   // a single query to see if Github is back
+
+	RefreshSucceeded = "succeeded"
+	RefreshFailed    = "failed"
+
+	ErrorClassRateLimited = "rate limited"
+	ErrorClassClient      = "client error" // retrying won't help, e.g. the PAT lacks permissions
+	ErrorClassServer      = "server error"
+	ErrorClassNetwork     = "network error" // Github couldn't be reached
+	ErrorClassStorage     = "storage error" // the PRs were fetched, but not stored
+	ErrorClassOther       = "other"
+)
+
+// Refresh is an attempt to fetch PRs from Github, as shown in the history of
+// refreshes.
+type Refresh struct {
+	StartedAt  time.Time
+	Duration   time.Duration
+	Kind       string // RefreshFull, RefreshChanged or RefreshProbe
+	Prs        int    // fetched, 0 if fetching failed
+	Outcome    string // RefreshSucceeded or RefreshFailed
+	ErrorClass string // one of the ErrorClass consts, only when failed
+	Error      string
+}
@@ -0,0 +1,103 @@
+package types
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+const (
+	RuleExclude = "exclude" // never list the PR
+	RuleBury    = "bury"    // as if the PR was buried, for good
+	RulePoints  = "points"  // add Points, which may be negative
+)
+
+// What Github allows in owners, repo names and logins, plus "*" for globs.
+// Bots' logins end with "[bot]".
+var (
+	ruleRepoPattern   = regexp.MustCompile(`^[A-Za-z0-9*-]+(/[A-Za-z0-9._*-]+)?$`)
+	ruleAuthorPattern = regexp.MustCompile(`^[A-Za-z0-9*-]+(\[bot\])?$`)
+)
+
+// Rule mutes or boosts every PR in matching repos and/or by matching authors,
+// e.g. all of dependabot's PRs, or everything in a docs monorepo. Repo and
+// Author are case insensitive globs where "*" matches anything, "" matches
+// any repo or author. A Repo without a name matches all of the owner's repos.
+type Rule struct {
+	Id     int64
+	Repo   string // "owner/name" or "owner", e.g. "acme/*"
+	Author string // e.g. "*[bot]"
+	Action string // RuleExclude, RuleBury or RulePoints
+	Points int    // only for RulePoints
+}
+
+func (r Rule) Matches(pr ViewPr) bool {
+	repo := r.Repo
+	if repo != "" && !strings.Contains(repo, "/") {
+		repo += "/*"
+	}
+	return globMatches(repo, pr.RepoOwner+"/"+pr.RepoName) && globMatches(r.Author, pr.Author)
+}
+
+// Validate returns what's wrong with r, if anything.
+func (r Rule) Validate() error {
+	if r.Repo == "" && r.Author == "" {
+		return fmt.Errorf("a rule needs a repo or an author, or it matches every PR")
+	}
+	if len(r.Repo) > 200 || len(r.Author) > 200 {
+		return fmt.Errorf("repo and author must be at most 200 characters")
+	}
+	if r.Repo != "" && !ruleRepoPattern.MatchString(r.Repo) {
+		return fmt.Errorf("repo must be \"owner/name\" or \"owner\", of letters, digits, '-', '.', '_' and '*'")
+	}
+	if r.Author != "" && !ruleAuthorPattern.MatchString(r.Author) {
+		return fmt.Errorf("author must be a login, of letters, digits, '-' and '*', optionally ending with \"[bot]\"")
+	}
+	switch r.Action {
+	case RuleExclude, RuleBury:
+		if r.Points != 0 {
+			return fmt.Errorf("only %q rules have points", RulePoints)
+		}
+	case RulePoints:
+		if r.Points == 0 {
+			return fmt.Errorf("a %q rule needs points", RulePoints)
+		}
+		if err := ValidatePoints(r.Points); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("action must be %s, %s or %s", RuleExclude, RuleBury, RulePoints)
+	}
+	return nil
+}
+
+// String describes what the rule matches, for showing it as a reason.
+func (r Rule) String() string {
+	var parts []string
+	if r.Repo != "" {
+		parts = append(parts, "repo "+r.Repo)
+	}
+	if r.Author != "" {
+		parts = append(parts, "author "+r.Author)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// compiledGlobs caches the regexp of each glob, since every rule is matched
+// against every PR whenever the PRs are listed.
+var compiledGlobs sync.Map // glob -> *regexp.Regexp
+
+// globMatches is like path.Match with only "*", since "[bot]" in an author
+// must be taken literally.
+func globMatches(glob, s string) bool {
+	if glob == "" {
+		return true
+	}
+	if re, ok := compiledGlobs.Load(glob); ok {
+		return re.(*regexp.Regexp).MatchString(s)
+	}
+	quoted := strings.ReplaceAll(regexp.QuoteMeta(glob), `\*`, ".*")
+	re, _ := compiledGlobs.LoadOrStore(glob, regexp.MustCompile("(?i)^"+quoted+"$"))
+	return re.(*regexp.Regexp).MatchString(s)
+}
@@ -0,0 +1,65 @@
+package types
+
+import "testing"
+
+func TestRule_Matches(t *testing.T) {
+	pr := ViewPr{RepoOwner: "acme", RepoName: "docs-site", Author: "dependabot[bot]"}
+	tests := []struct {
+		rule Rule
+		want bool
+	}{
+		{Rule{Repo: "acme/docs-site"}, true},
+		{Rule{Repo: "ACME/*"}, true},
+		{Rule{Repo: "*/docs-*"}, true},
+		{Rule{Repo: "acme/docs"}, false},
+		// a bare owner matches all of its repos
+		{Rule{Repo: "acme"}, true},
+		{Rule{Repo: "ACME"}, true},
+		{Rule{Repo: "acm"}, false},
+		{Rule{Repo: "docs-site"}, false},
+		{Rule{Author: "dependabot[bot]"}, true},
+		{Rule{Author: "*[bot]"}, true},
+		// "[bot]" is not a character class
+		{Rule{Author: "dependabot[bt]"}, false},
+		{Rule{Repo: "acme/*", Author: "renovate*"}, false},
+		{Rule{Repo: "acme/*", Author: "*bot*"}, true},
+	}
+	for _, tt := range tests {
+		if got := tt.rule.Matches(pr); got != tt.want {
+			t.Errorf("%+v.Matches(%s/%s by %s) = %v, want %v", tt.rule, pr.RepoOwner, pr.RepoName, pr.Author, got, tt.want)
+		}
+	}
+}
+
+func TestRule_Validate(t *testing.T) {
+	valid := []Rule{
+		{Repo: "acme/docs", Action: RuleExclude},
+		{Author: "*[bot]", Action: RuleBury},
+		{Repo: "acme/core", Action: RulePoints, Points: 100},
+		{Repo: "*/docs.github.io", Author: "dependabot[bot]", Action: RuleBury},
+		{Repo: "acme*", Author: "renovate-*", Action: RuleExclude},
+		{Repo: "acme", Action: RuleBury},
+	}
+	for _, rule := range valid {
+		if err := rule.Validate(); err != nil {
+			t.Errorf("expected %+v to be valid, got %v", rule, err)
+		}
+	}
+	invalid := []Rule{
+		{Action: RuleExclude},
+		{Repo: "acme/docs", Action: "hide"},
+		{Repo: "acme/docs", Action: RulePoints},
+		{Repo: "acme/docs", Action: RuleBury, Points: 10},
+		// shown as reasons in the GUI
+		{Repo: "acme/<script>", Action: RuleExclude},
+		{Author: `"><img src=x onerror=alert(1)>`, Action: RuleExclude},
+		{Repo: "acme/docs/more", Action: RuleExclude},
+		{Author: "me[bot]x", Action: RuleExclude},
+		{Author: "with space", Action: RuleExclude},
+	}
+	for _, rule := range invalid {
+		if err := rule.Validate(); err == nil {
+			t.Errorf("expected %+v to be invalid", rule)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"slices"
 	"time"
 )
 
@@ -22,11 +23,35 @@ type ViewPr struct {
 	LastPrCommenter          string
 	ThreadsActionable        int
 	ThreadsWaiting           int
+	ReviewThreads            []ReviewThread // the threads behind ThreadsActionable and ThreadsWaiting
 	Additions                int
 	Deletions                int
 	ReviewRequestedFromUsers []string
 	Buried                   bool
 	RawJsonResponse          json.RawMessage
+	Note                     string // our private note, not from Github
+	NotePoints               int    // added to the PR's points, with Note as the reason
+	Tags                     []Tag  // our own labels, not Github's
+	Rules                    []Rule // the rules that match the PR
+}
+
+// Tag is a local label of a PR, or of all PRs in a repo.
+type Tag struct {
+	Name   string
+	Points int  // added to the points of every PR with the tag
+	OnRepo bool // the PR has the tag through its repo
+}
+
+// ReviewThread is an open review thread that is either waiting for us
+// (Actionable) or for someone else.
+type ReviewThread struct {
+	Url                string // of the last comment, i.e. where the conversation continues
+	Actionable         bool
+	Reason             string
+	FirstCommenter     string
+	LastCommenter      string
+	LastCommentExcerpt string
+	Comments           int
 }
 
 // URL- and filesystem friendly ID of a PR.
@@ -46,6 +71,12 @@ func (pr ViewPr) ToggleBuryUrl() string {
 	}
 }
 
+// IsBuried reports whether pr is buried, by the user or by a rule. Buried
+// only tells the former, which is what the user can unbury.
+func (pr ViewPr) IsBuried() bool {
+	return pr.Buried || slices.ContainsFunc(pr.Rules, func(r Rule) bool { return r.Action == RuleBury })
+}
+
 func (pr ViewPr) GoldenUrl() string {
 	return fmt.Sprintf("/api/v0/prs/%s/golden", pr.Id())
 }
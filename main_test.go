@@ -2,14 +2,22 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"database/sql"
 	"encoding/json"
 	"errors"
+	"io"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/chelmertz/elly/internal/backoff"
 	"github.com/chelmertz/elly/internal/github"
 	"github.com/chelmertz/elly/internal/storage"
 	"github.com/chelmertz/elly/internal/types"
@@ -62,14 +70,62 @@ func (s *testStorage) ClearPAT() error {
 	return nil
 }
 
-func (s *testStorage) Prs() storage.StoredState                      { return storage.StoredState{} }
+func (s *testStorage) StoreRateLimitBudget(types.RateLimitBudget) error {
+	return nil
+}
+
+func (s *testStorage) GetRateLimitBudget() (types.RateLimitBudget, bool, error) {
+	return types.RateLimitBudget{}, false, nil
+}
+
+func (s *testStorage) StoreBackoffState(types.BackoffState) error {
+	return nil
+}
+
+func (s *testStorage) GetBackoffState() (types.BackoffState, bool, error) {
+	return types.BackoffState{}, false, nil
+}
+
+func (s *testStorage) StorePatExpiryNotified(time.Time) error {
+	return nil
+}
+
+func (s *testStorage) GetPatExpiryNotified() (time.Time, bool, error) {
+	return time.Time{}, false, nil
+}
+
+func (s *testStorage) StoreRefresh(types.Refresh) error {
+	return nil
+}
+
+func (s *testStorage) Refreshes() ([]types.Refresh, error) {
+	return nil, nil
+}
+
+func (s *testStorage) Prs() (storage.StoredState, error)             { return storage.StoredState{}, nil }
 func (s *testStorage) StoreRepoPrs([]types.ViewPr) error             { return nil }
 func (s *testStorage) Bury(string) error                             { return nil }
 func (s *testStorage) Unbury(string) error                           { return nil }
-func (s *testStorage) GetPr(string) (storage.Pr, error)              { return storage.Pr{}, nil }
+func (s *testStorage) BuriedPrs() ([]storage.StoredBury, error)      { return nil, nil }
+func (s *testStorage) ImportState(storage.StateImport) (int, error)  { return 0, nil }
+func (s *testStorage) Notes() ([]storage.StoredNote, error)          { return nil, nil }
+func (s *testStorage) StoreNote(storage.StoredNote) error            { return nil }
+func (s *testStorage) DeleteNote(string) error                       { return nil }
+func (s *testStorage) Tags() ([]storage.StoredTag, error)            { return nil, nil }
+func (s *testStorage) AddTag(storage.StoredTag) error                { return nil }
+func (s *testStorage) RemoveTag(storage.StoredTag) error             { return nil }
+func (s *testStorage) TagPoints() (map[string]int, error)            { return nil, nil }
+func (s *testStorage) SetTagPoints(string, int) error                { return nil }
+func (s *testStorage) Rules() ([]types.Rule, error)                  { return nil, nil }
+func (s *testStorage) AddRule(r types.Rule) (types.Rule, error)      { return r, nil }
+func (s *testStorage) DeleteRule(int64) error                        { return nil }
+func (s *testStorage) GetPr(string) (types.ViewPr, bool, error)      { return types.ViewPr{}, false, nil }
 func (s *testStorage) SetRateLimitUntil(time.Time) error             { return nil }
 func (s *testStorage) IsRateLimitActive(time.Time) bool              { return false }
 func (s *testStorage) GetRateLimitUntil() time.Time                  { return time.Time{} }
+func (s *testStorage) StoreApiToken(string) error                    { return nil }
+func (s *testStorage) GetApiToken() (string, bool, error)            { return "", false, nil }
+func (s *testStorage) Close() error                                  { return nil }
 
 var _ storage.Storage = (*testStorage)(nil)
 
@@ -234,3 +290,361 @@ func TestErrInvalidToken_WrappedCorrectly(t *testing.T) {
 		t.Error("expected errors.Is to find ErrInvalidToken")
 	}
 }
+
+// cancellingStorage cancels the daemon's context as soon as a store begins,
+// like a SIGTERM arriving mid-refresh.
+type cancellingStorage struct {
+	storage.Storage
+	cancel context.CancelFunc
+}
+
+func (s *cancellingStorage) StoreRepoPrs(prs []types.ViewPr) error {
+	s.cancel()
+	return s.Storage.StoreRepoPrs(prs)
+}
+
+func openStorage(t *testing.T, dbPath string) *storage.DbStorage {
+	t.Helper()
+	store, err := storage.NewStorage(testLogger(t), dbPath)
+	if err != nil {
+		t.Fatalf("NewStorage failed: %v", err)
+	}
+	return store
+}
+
+func storedState(t *testing.T, store storage.Storage) storage.StoredState {
+	t.Helper()
+	state, err := store.Prs()
+	if err != nil {
+		t.Fatalf("Prs failed: %v", err)
+	}
+	return state
+}
+
+func runRefreshLoop(t *testing.T, ctx context.Context, store storage.Storage, githubURL string) <-chan struct{} {
+	t.Helper()
+	logger := testLogger(t)
+	tracker := backoff.New(logger, time.Millisecond, backoff.Schedule{}, types.BackoffState{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		startRefreshLoop(ctx, store, tracker, githubURL, github.Bots{}, time.Hour, logger)
+	}()
+	return done
+}
+
+func waitForShutdown(t *testing.T, done <-chan struct{}) {
+	t.Helper()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("refresh loop did not stop after shutdown")
+	}
+}
+
+func TestRefreshLoop_ShutdownAbortsGithubRequest(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "elly.db")
+	store := openStorage(t, dbPath)
+	if err := store.StorePAT("token", "me", time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	thread := types.ReviewThread{Url: "https://github.com/o/r/pull/1#discussion_r1", Actionable: true, Comments: 1}
+	pr := types.ViewPr{Url: "https://github.com/o/r/pull/1", LastUpdated: time.Now(), RawJsonResponse: []byte(`{}`), ReviewThreads: []types.ReviewThread{thread}}
+	if err := store.StoreRepoPrs([]types.ViewPr{pr}); err != nil {
+		t.Fatal(err)
+	}
+
+	requested := make(chan struct{})
+	var once sync.Once
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the server only notices the client going away once the body is read
+		io.Copy(io.Discard, r.Body)
+		once.Do(func() { close(requested) })
+		// github is slow today
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := runRefreshLoop(t, ctx, store, srv.URL)
+
+	select {
+	case <-requested:
+	case <-time.After(5 * time.Second):
+		t.Fatal("github was never queried")
+	}
+	cancel()
+	waitForShutdown(t, done)
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	reopened := openStorage(t, dbPath)
+	defer reopened.Close()
+	prs := storedState(t, reopened).Prs
+	if len(prs) != 1 || len(prs[0].ReviewThreads) != 1 {
+		t.Fatalf("expected the previously stored PR and thread to be intact, got %+v", prs)
+	}
+}
+
+func TestRefreshLoop_ShutdownLetsStoreFinish(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "elly.db")
+	dbStore := openStorage(t, dbPath)
+	if err := dbStore.StorePAT("token", "me", time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	stale := types.ViewPr{Url: "https://github.com/o/r/pull/1", LastUpdated: time.Now(), RawJsonResponse: []byte(`{}`)}
+	if err := dbStore.StoreRepoPrs([]types.ViewPr{stale}); err != nil {
+		t.Fatal(err)
+	}
+	// LastFetched is stored with second precision, so it's set in the past
+	// for the refresh to tell from it
+	before := time.Now().Add(-time.Hour).Truncate(time.Second)
+	raw, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := raw.Exec("update meta set value = ? where key = 'last_fetched'", before.Format(time.RFC3339)); err != nil {
+		t.Fatal(err)
+	}
+	raw.Close() //nolint:errcheck // test setup
+	if got := storedState(t, dbStore).LastFetched; !got.Equal(before) {
+		t.Fatalf("expected LastFetched to be seeded as %v, got %v", before, got)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(graphqlSearchResponse())
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := runRefreshLoop(t, ctx, &cancellingStorage{Storage: dbStore, cancel: cancel}, srv.URL)
+
+	waitForShutdown(t, done)
+	if err := dbStore.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	reopened := openStorage(t, dbPath)
+	defer reopened.Close()
+	state := storedState(t, reopened)
+	if len(state.Prs) != 0 {
+		t.Errorf("expected the store started before shutdown to have replaced the old PRs, got %+v", state.Prs)
+	}
+	if !state.LastFetched.After(before) {
+		t.Errorf("expected LastFetched to be updated, got %v (was %v)", state.LastFetched, before)
+	}
+}
+
+func TestRefreshLoop_ProbesGithubAfterTheCircuitOpened(t *testing.T) {
+	store := storage.NewMemoryStorage(testLogger(t))
+	if err := store.StorePAT("token", "me", time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var queries []string
+	refreshed := make(chan struct{})
+	var once sync.Once
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct{ Query string }
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("could not decode request: %v", err)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		queries = append(queries, strings.Fields(request.Query)[1])
+		if len(queries) == 1 {
+			// still down
+			w.WriteHeader(http.StatusBadGateway)
+			io.WriteString(w, `{}`) //nolint:errcheck // test server
+			return
+		}
+		if strings.HasPrefix(request.Query, "query {") {
+			once.Do(func() { close(refreshed) })
+		}
+		io.WriteString(w, `{"data": {"search": {"edges": []}}}`) //nolint:errcheck // test server
+	}))
+	defer srv.Close()
+
+	// the circuit opened before a restart, and the pause is over
+	logger := testLogger(t)
+	tracker := backoff.New(logger, time.Millisecond, backoff.Schedule{}, types.BackoffState{Multiplier: 4, ConsecutiveFailures: 5, CircuitOpenUntil: time.Now().Add(-time.Second)})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		startRefreshLoop(ctx, store, tracker, srv.URL, github.Bots{}, time.Hour, logger)
+	}()
+
+	select {
+	case <-refreshed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("github was never refreshed from")
+	}
+	// the refresh is stored after the search
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		state, found, _ := store.GetBackoffState()
+		if found && state.CircuitOpenUntil.IsZero() {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected a closed circuit to be stored, got %+v (found: %v)", state, found)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	waitForShutdown(t, done)
+
+	mu.Lock()
+	defer mu.Unlock()
+	// the failed probe opened the circuit again, the next one closed it
+	if want := []string{"probe", "probe", "{"}; len(queries) < 3 || !slices.Equal(queries[:3], want) {
+		t.Errorf("expected the queries %v, got %v", want, queries)
+	}
+}
+
+func TestRefreshLoop_ClientErrorPausesUntilResumed(t *testing.T) {
+	store := storage.NewMemoryStorage(testLogger(t))
+	if err := store.StorePAT("token", "me", time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	requests := 0
+	refreshed := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+		if requests == 1 {
+			// e.g. a PAT without access to pull requests
+			w.WriteHeader(http.StatusForbidden)
+			io.WriteString(w, `{"message": "Resource not accessible by personal access token"}`) //nolint:errcheck // test server
+			return
+		}
+		if requests == 2 {
+			close(refreshed)
+		}
+		io.WriteString(w, `{"data": {"search": {"edges": []}}}`) //nolint:errcheck // test server
+	}))
+	defer srv.Close()
+
+	logger := testLogger(t)
+	tracker := backoff.New(logger, time.Hour, backoff.Schedule{}, types.BackoffState{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		startRefreshLoop(ctx, store, tracker, srv.URL, github.Bots{}, time.Hour, logger)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for tracker.Attention() == "" {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the client error to need attention")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if !strings.Contains(tracker.Attention(), "403") {
+		t.Errorf("expected the reason to tell the response code, got %q", tracker.Attention())
+	}
+
+	// e.g. the user stored a new PAT, the loop is still there to use it
+	tracker.Resume()
+	select {
+	case <-refreshed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("github was never refreshed from after resuming")
+	}
+	// both attempts are in the history, latest first, once the PRs are stored
+	var refreshes []types.Refresh
+	deadline = time.Now().Add(5 * time.Second)
+	for len(refreshes) < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+		refreshes, _ = store.Refreshes()
+	}
+	cancel()
+	waitForShutdown(t, done)
+
+	if len(refreshes) != 2 || refreshes[0].Outcome != types.RefreshSucceeded || refreshes[1].ErrorClass != types.ErrorClassClient || refreshes[1].Kind != types.RefreshFull {
+		t.Errorf("expected a failed and a successful refresh, got %+v", refreshes)
+	}
+}
+
+func TestDoctor_FailsOnMissingPermissions(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/user":
+			w.Write([]byte(`{"login": "me"}`)) //nolint:errcheck // test server
+		case "/search/issues":
+			w.Write([]byte(`{"items": [{"repository_url": "https://api.github.com/repos/acme/web"}]}`)) //nolint:errcheck // test server
+		case "/repos/acme/web/commits":
+			w.Write([]byte(`[{"sha": "abc123"}]`)) //nolint:errcheck // test server
+		case "/repos/acme/web/pulls":
+			w.WriteHeader(http.StatusForbidden)
+		default:
+			w.Write([]byte(`{}`)) //nolint:errcheck // test server
+		}
+	}))
+	defer srv.Close()
+	t.Setenv("GITHUB_PAT", "")
+
+	var out strings.Builder
+	err := runCommand(newTestStorage("github_pat_123", "me"), srv.URL, []string{"doctor"}, nil, &out, testLogger(t))
+	if err == nil || !strings.Contains(err.Error(), github.PermissionPullRequests) {
+		t.Errorf("expected the missing permission in the error, got %v", err)
+	}
+	if !strings.Contains(out.String(), "probed in:  acme/web") || !strings.Contains(out.String(), "MISSING") {
+		t.Errorf("expected a report of the permissions, got:\n%s", out.String())
+	}
+}
+
+func TestRefreshLoop_NetworkErrorsOpenTheCircuit(t *testing.T) {
+	store := storage.NewMemoryStorage(testLogger(t))
+	if err := store.StorePAT("token", "me", time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	// nothing listens there anymore, like during an outage
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+
+	logger := testLogger(t)
+	tracker := backoff.New(logger, time.Millisecond, backoff.Schedule{}, types.BackoffState{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		startRefreshLoop(ctx, store, tracker, srv.URL, github.Bots{}, time.Hour, logger)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for tracker.CircuitClosed() {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the network errors to open the circuit")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	waitForShutdown(t, done)
+
+	state, found, _ := store.GetBackoffState()
+	if !found || state.ConsecutiveFailures < 5 || state.Multiplier <= 1 {
+		t.Errorf("expected the failures and backoff to be stored, got %+v (found: %v)", state, found)
+	}
+	refreshes, _ := store.Refreshes()
+	if len(refreshes) == 0 || refreshes[0].ErrorClass != types.ErrorClassNetwork {
+		t.Errorf("expected network errors in the history, got %+v", refreshes)
+	}
+	// Github never told about the budget
+	if budget, found, _ := store.GetRateLimitBudget(); found {
+		t.Errorf("expected no rate limit budget to be stored, got %+v", budget)
+	}
+}
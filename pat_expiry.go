@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/chelmertz/elly/internal/storage"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var patExpirySeconds = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "elly_pat_expiry_seconds",
+	Help: "Seconds until the Github PAT expires, negative once it has. +Inf if it doesn't expire, or there is none.",
+})
+
+// patExpiryCheckInterval is how often elly_pat_expiry_seconds is updated, and
+// a failed notification is retried.
+const patExpiryCheckInterval = 15 * time.Minute
+
+var notifyClient = &http.Client{Timeout: 10 * time.Second}
+
+// patExpiryNotification is what's POSTed to -pat-expiry-notify-url. Chat
+// webhooks (Slack, Mattermost, ...) show the text.
+type patExpiryNotification struct {
+	Text          string    `json:"text"`
+	Username      string    `json:"username"`
+	ExpiresAt     time.Time `json:"expires_at"`
+	ExpiresInDays int       `json:"expires_in_days"`
+}
+
+// watchPatExpiry keeps elly_pat_expiry_seconds up to date, and notifies
+// notifyURL (unless empty) once per PAT, notifyDays before it expires. Returns
+// when ctx is cancelled.
+func watchPatExpiry(ctx context.Context, store storage.Storage, notifyURL string, notifyDays int, logger *slog.Logger) {
+	ticker := time.NewTicker(patExpiryCheckInterval)
+	defer ticker.Stop()
+	for {
+		checkPatExpiry(ctx, store, notifyURL, notifyDays, time.Now(), logger)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func checkPatExpiry(ctx context.Context, store storage.Storage, notifyURL string, notifyDays int, now time.Time, logger *slog.Logger) {
+	pat, found, err := store.GetPAT()
+	if err != nil {
+		logger.Warn("could not read PAT to check its expiry", slog.Any("error", err))
+		return
+	}
+	if !found || pat.ExpiresAt.IsZero() {
+		patExpirySeconds.Set(math.Inf(1))
+		return
+	}
+	patExpirySeconds.Set(pat.ExpiresAt.Sub(now).Seconds())
+
+	days, _ := pat.ExpiresInDays(now)
+	if notifyURL == "" || days >= notifyDays {
+		return
+	}
+	notified, found, err := store.GetPatExpiryNotified()
+	if err != nil {
+		logger.Warn("could not read whether the PAT expiry was notified about", slog.Any("error", err))
+		return
+	}
+	if found && notified.Equal(pat.ExpiresAt) {
+		return
+	}
+	if err := notifyPatExpiry(ctx, notifyURL, pat, days); err != nil {
+		logger.Warn("could not notify that the PAT expires soon, retrying later", slog.Any("error", err))
+		return
+	}
+	logger.Info("notified that the PAT expires soon", slog.Time("expires_at", pat.ExpiresAt), slog.Int("days_left", days))
+	if err := store.StorePatExpiryNotified(pat.ExpiresAt); err != nil {
+		logger.Warn("could not store that the PAT expiry was notified about", slog.Any("error", err))
+	}
+}
+
+func notifyPatExpiry(ctx context.Context, notifyURL string, pat storage.StoredPAT, days int) error {
+	notification := patExpiryNotification{
+		Text:          fmt.Sprintf("elly: the Github PAT of %s expires in %d days, on %s. Store a new one in elly's settings.", pat.Username, days, pat.ExpiresAt.Format(time.DateOnly)),
+		Username:      pat.Username,
+		ExpiresAt:     pat.ExpiresAt,
+		ExpiresInDays: days,
+	}
+	if days < 0 {
+		notification.Text = fmt.Sprintf("elly: the Github PAT of %s has expired. Store a new one in elly's settings.", pat.Username)
+	}
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return fmt.Errorf("could not marshal notification: %w", err)
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, notifyURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("could not create request: %w", err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	response, err := notifyClient.Do(request)
+	if err != nil {
+		return fmt.Errorf("could not send notification: %w", err)
+	}
+	defer response.Body.Close() //nolint:errcheck // error on close is not actionable
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("notification got response code %d", response.StatusCode)
+	}
+	return nil
+}
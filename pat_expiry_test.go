@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chelmertz/elly/internal/storage"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCheckPatExpiry_NotifiesOncePerPat(t *testing.T) {
+	var mu sync.Mutex
+	var notifications []patExpiryNotification
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n patExpiryNotification
+		if err := json.NewDecoder(r.Body).Decode(&n); err != nil {
+			t.Errorf("could not decode notification: %v", err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		notifications = append(notifications, n)
+	}))
+	defer srv.Close()
+
+	store := storage.NewMemoryStorage(testLogger(t))
+	now := time.Now()
+	expiresAt := now.Add(10 * 24 * time.Hour).Truncate(time.Second)
+	if err := store.StorePAT("token", "me", expiresAt); err != nil {
+		t.Fatal(err)
+	}
+	check := func(now time.Time) int {
+		checkPatExpiry(context.Background(), store, srv.URL, 7, now, testLogger(t))
+		mu.Lock()
+		defer mu.Unlock()
+		return len(notifications)
+	}
+
+	if got := check(now); got != 0 {
+		t.Fatalf("expected no notification 10 days before, got %d", got)
+	}
+	if got, want := testutil.ToFloat64(patExpirySeconds), expiresAt.Sub(now).Seconds(); got != want {
+		t.Errorf("expected %v seconds until expiry, got %v", want, got)
+	}
+
+	// 6 days and some hours left
+	if got := check(now.Add(3*24*time.Hour + time.Hour)); got != 1 {
+		t.Fatalf("expected a notification within 7 days, got %d", got)
+	}
+	if n := notifications[0]; n.Username != "me" || n.ExpiresInDays != 6 || !n.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("unexpected notification %+v", n)
+	}
+	if got := check(now.Add(4 * 24 * time.Hour)); got != 1 {
+		t.Errorf("expected a single notification per PAT, got %d", got)
+	}
+
+	// a new PAT that expires soon is notified about as well
+	if err := store.StorePAT("token2", "me", expiresAt.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if got := check(now.Add(4 * 24 * time.Hour)); got != 2 {
+		t.Errorf("expected a notification for the new PAT, got %d", got)
+	}
+
+	if err := store.StorePAT("token3", "me", time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	check(now)
+	if got := testutil.ToFloat64(patExpirySeconds); !math.IsInf(got, 1) {
+		t.Errorf("expected +Inf for a PAT that doesn't expire, got %v", got)
+	}
+}
+
+func TestCheckPatExpiry_RetriesFailedNotifications(t *testing.T) {
+	var mu sync.Mutex
+	status := http.StatusBadGateway
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	store := storage.NewMemoryStorage(testLogger(t))
+	expiresAt := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+	if err := store.StorePAT("token", "me", expiresAt); err != nil {
+		t.Fatal(err)
+	}
+
+	checkPatExpiry(context.Background(), store, srv.URL, 7, time.Now(), testLogger(t))
+	if _, found, _ := store.GetPatExpiryNotified(); found {
+		t.Fatal("a failed notification shouldn't count as notified")
+	}
+
+	mu.Lock()
+	status = http.StatusOK
+	mu.Unlock()
+	checkPatExpiry(context.Background(), store, srv.URL, 7, time.Now(), testLogger(t))
+	if notified, found, _ := store.GetPatExpiryNotified(); !found || !notified.Equal(expiresAt) {
+		t.Errorf("expected the retry to be notified about, got %v (found: %v)", notified, found)
+	}
+}